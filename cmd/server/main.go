@@ -1,11 +1,16 @@
 package main
 
 import (
+	"crypto/rand"
 	"log"
 	"net/http"
 	"os"
+	"pos-app/internal/auth"
 	"pos-app/internal/database"
+	"pos-app/internal/events"
+	"pos-app/internal/handler"
 	"pos-app/internal/router"
+	"time"
 )
 
 func main() {
@@ -17,12 +22,51 @@ func main() {
 		dbPath = "/app/data/pos.db"
 	}
 
+	// Session signing secret. Without one, tokens are invalidated on every restart.
+	secret := []byte(os.Getenv("SESSION_SECRET"))
+	if len(secret) == 0 {
+		log.Println("SESSION_SECRET not set, generating a random one; sessions will not survive a restart")
+		secret = make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			log.Fatalf("Could not generate session secret: %s\n", err)
+		}
+	}
+
+	// Sessions are kept short by default because tills sit on shared counters
+	sessionTTL := 8 * time.Hour
+	if v := os.Getenv("SESSION_TTL"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			log.Fatalf("Invalid SESSION_TTL %q: %s\n", v, err)
+		}
+		sessionTTL = d
+	}
+
+	// Sales can be voided by a manager for a short while after they are rung up
+	voidWindow := handler.DefaultVoidWindow
+	if v := os.Getenv("SALE_VOID_WINDOW"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			log.Fatalf("Invalid SALE_VOID_WINDOW %q: %s\n", v, err)
+		}
+		voidWindow = d
+	}
+
 	// Initialize database
 	db := database.InitDB(dbPath)
 	defer db.Close()
 
+	sessions := &auth.Sessions{DB: db, Secret: secret, TTL: sessionTTL}
+
+	// Event bus for alerts; webhook and notification consumers subscribe here
+	bus := &events.Bus{}
+	bus.Subscribe(events.TypeLowStock, func(e events.Event) {
+		ls := e.Payload.(events.LowStock)
+		log.Printf("Low stock: %s (%s) has %d left, reorder point %d", ls.Name, ls.SKU, ls.Quantity, ls.ReorderPoint)
+	})
+
 	// Setup router
-	r := router.SetupRouter(db)
+	r := router.SetupRouter(db, sessions, bus, voidWindow)
 
 	// Start server
 	log.Println("Starting server on :8081")
@@ -8,12 +8,12 @@ import Layout from '@/components/Layout';
 import { User, UserPlus, AlertCircle } from 'lucide-react';
 
 export default function LoginPage() {
-  const [loginUserId, setLoginUserId] = useState('');
-  const [registerData, setRegisterData] = useState({
+  const [loginData, setLoginData] = useState({ username: '', password: '' });
+  const [setupData, setSetupData] = useState({
     username: '',
     password: '',
-    role: 'cashier'
   });
+  const [setupRequired, setSetupRequired] = useState(false);
   const [error, setError] = useState('');
   const [success, setSuccess] = useState('');
   const [isLoading, setIsLoading] = useState(false);
@@ -27,31 +27,45 @@ export default function LoginPage() {
     }
   }, [isLoggedIn, router]);
 
+  useEffect(() => {
+    api.getBootstrapStatus()
+      .then((status) => setSetupRequired(status.required))
+      .catch(() => setSetupRequired(false));
+  }, []);
+
   const handleLogin = async (e: React.FormEvent) => {
     e.preventDefault();
     setError('');
     
-    if (!loginUserId) {
-      setError('Please enter a User ID');
+    if (!loginData.username || !loginData.password) {
+      setError('Please enter your username and password');
       return;
     }
 
-    login(loginUserId);
-    router.push('/pos');
+    setIsLoading(true);
+    try {
+      await login(loginData.username, loginData.password);
+      router.push('/pos');
+    } catch (error) {
+      setError(error instanceof Error ? error.message : 'Login failed');
+    } finally {
+      setIsLoading(false);
+    }
   };
 
-  const handleRegister = async (e: React.FormEvent) => {
+  const handleSetup = async (e: React.FormEvent) => {
     e.preventDefault();
     setError('');
     setSuccess('');
     setIsLoading(true);
 
     try {
-      const result = await api.registerUser(registerData);
-      setSuccess(`User registered successfully! Your new User ID is: ${result.user_id}. Please log in with it.`);
-      setRegisterData({ username: '', password: '', role: 'cashier' });
+      await api.bootstrap(setupData.username, setupData.password);
+      setSuccess('Admin account created. You can now log in with your username.');
+      setSetupData({ username: '', password: '' });
+      setSetupRequired(false);
     } catch (error) {
-      setError(error instanceof Error ? error.message : 'Registration failed');
+      setError(error instanceof Error ? error.message : 'Setup failed');
     } finally {
       setIsLoading(false);
     }
@@ -76,7 +90,7 @@ export default function LoginPage() {
               Welcome to GoPOS
             </h2>
             <p className="mt-2 text-center text-sm text-gray-600">
-              Please sign in to your account or register a new one
+              Please sign in to your account
             </p>
           </div>
 
@@ -111,23 +125,33 @@ export default function LoginPage() {
             </h3>
             <form onSubmit={handleLogin} className="space-y-4">
               <div>
-                <label htmlFor="login-user-id" className="block text-sm font-medium text-gray-700">
-                  User ID
+                <label htmlFor="login-username" className="block text-sm font-medium text-gray-700">
+                  Username
+                </label>
+                <input
+                  id="login-username"
+                  type="text"
+                  value={loginData.username}
+                  onChange={(e) => setLoginData({ ...loginData, username: e.target.value })}
+                  className="mt-1 block w-full px-3 py-2 border border-gray-300 rounded-md shadow-sm focus:outline-none focus:ring-blue-500 focus:border-blue-500"
+                  placeholder="Enter username"
+                  required
+                />
+              </div>
+              <div>
+                <label htmlFor="login-password" className="block text-sm font-medium text-gray-700">
+                  Password
                 </label>
                 <input
-                  id="login-user-id"
-                  type="number"
-                  value={loginUserId}
-                  onChange={(e) => setLoginUserId(e.target.value)}
+                  id="login-password"
+                  type="password"
+                  value={loginData.password}
+                  onChange={(e) => setLoginData({ ...loginData, password: e.target.value })}
                   className="mt-1 block w-full px-3 py-2 border border-gray-300 rounded-md shadow-sm focus:outline-none focus:ring-blue-500 focus:border-blue-500"
-                  placeholder="Enter your User ID"
+                  placeholder="Enter password"
                   required
                 />
               </div>
-              <p className="text-sm text-gray-500">
-                Since this is a lightweight demo without full authentication, please enter your User ID to &apos;log in&apos;.
-                You can create a user via the registration form below or assume User ID 1 exists.
-              </p>
               <button
                 type="submit"
                 className="w-full flex justify-center py-2 px-4 border border-transparent rounded-md shadow-sm text-sm font-medium text-white bg-blue-600 hover:bg-blue-700 focus:outline-none focus:ring-2 focus:ring-offset-2 focus:ring-blue-500"
@@ -137,65 +161,55 @@ export default function LoginPage() {
             </form>
           </div>
 
-          {/* Register Form */}
+          {/* First-run Setup Form */}
+          {setupRequired && (
           <div className="bg-white py-8 px-6 shadow rounded-lg">
             <h3 className="text-lg font-medium text-gray-900 mb-4 flex items-center">
               <UserPlus className="w-5 h-5 mr-2" />
-              Register New User
+              Create Admin Account
             </h3>
-            <form onSubmit={handleRegister} className="space-y-4">
+            <p className="text-sm text-gray-500 mb-4">
+              No users exist yet. Create the first admin account; further users can then be added by an admin.
+            </p>
+            <form onSubmit={handleSetup} className="space-y-4">
               <div>
-                <label htmlFor="register-username" className="block text-sm font-medium text-gray-700">
+                <label htmlFor="setup-username" className="block text-sm font-medium text-gray-700">
                   Username
                 </label>
                 <input
-                  id="register-username"
+                  id="setup-username"
                   type="text"
-                  value={registerData.username}
-                  onChange={(e) => setRegisterData({ ...registerData, username: e.target.value })}
+                  value={setupData.username}
+                  onChange={(e) => setSetupData({ ...setupData, username: e.target.value })}
                   className="mt-1 block w-full px-3 py-2 border border-gray-300 rounded-md shadow-sm focus:outline-none focus:ring-blue-500 focus:border-blue-500"
                   placeholder="Enter username"
                   required
                 />
               </div>
               <div>
-                <label htmlFor="register-password" className="block text-sm font-medium text-gray-700">
+                <label htmlFor="setup-password" className="block text-sm font-medium text-gray-700">
                   Password
                 </label>
                 <input
-                  id="register-password"
+                  id="setup-password"
                   type="password"
-                  value={registerData.password}
-                  onChange={(e) => setRegisterData({ ...registerData, password: e.target.value })}
+                  value={setupData.password}
+                  onChange={(e) => setSetupData({ ...setupData, password: e.target.value })}
                   className="mt-1 block w-full px-3 py-2 border border-gray-300 rounded-md shadow-sm focus:outline-none focus:ring-blue-500 focus:border-blue-500"
                   placeholder="Enter password"
                   required
                 />
               </div>
-              <div>
-                <label htmlFor="register-role" className="block text-sm font-medium text-gray-700">
-                  Role
-                </label>
-                <select
-                  id="register-role"
-                  value={registerData.role}
-                  onChange={(e) => setRegisterData({ ...registerData, role: e.target.value })}
-                  className="mt-1 block w-full px-3 py-2 border border-gray-300 rounded-md shadow-sm focus:outline-none focus:ring-blue-500 focus:border-blue-500"
-                >
-                  <option value="cashier">Cashier</option>
-                  <option value="manager">Manager</option>
-                  <option value="admin">Admin</option>
-                </select>
-              </div>
               <button
                 type="submit"
                 disabled={isLoading}
                 className="w-full flex justify-center py-2 px-4 border border-transparent rounded-md shadow-sm text-sm font-medium text-white bg-green-600 hover:bg-green-700 focus:outline-none focus:ring-2 focus:ring-offset-2 focus:ring-green-500 disabled:opacity-50 disabled:cursor-not-allowed"
               >
-                {isLoading ? 'Registering...' : 'Register'}
+                {isLoading ? 'Creating...' : 'Create Admin'}
               </button>
             </form>
           </div>
+          )}
         </div>
       </div>
     </Layout>
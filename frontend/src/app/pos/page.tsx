@@ -4,7 +4,7 @@ import React, { useState, useEffect } from 'react';
 import { useRouter } from 'next/navigation';
 import { useAuth } from '@/contexts/AuthContext';
 import { api } from '@/lib/api';
-import { Product, CartItem, PaymentMethod } from '@/types';
+import { Product, CartItem, PaymentMethod, Shift } from '@/types';
 import Layout from '@/components/Layout';
 import ProductGrid from '@/components/pos/ProductGrid';
 import Cart from '@/components/pos/Cart';
@@ -16,6 +16,7 @@ export default function POSPage() {
   const [loading, setLoading] = useState(true);
   const [error, setError] = useState('');
   const [checkoutLoading, setCheckoutLoading] = useState(false);
+  const [shift, setShift] = useState<Shift | null>(null);
   
   const { isLoggedIn, userId } = useAuth();
   const router = useRouter();
@@ -26,8 +27,42 @@ export default function POSPage() {
       return;
     }
     loadProducts();
+    loadShift();
   }, [isLoggedIn, router]);
 
+  const loadShift = async () => {
+    try {
+      setShift(await api.getCurrentShift());
+    } catch {
+      // No open shift on this till
+      setShift(null);
+    }
+  };
+
+  const openShift = async () => {
+    const input = window.prompt('Opening float', '0');
+    if (input === null) return;
+    try {
+      setShift(await api.openShift(parseFloat(input) || 0));
+      setError('');
+    } catch (error) {
+      setError(error instanceof Error ? error.message : 'Failed to open shift');
+    }
+  };
+
+  const closeShift = async () => {
+    if (!shift) return;
+    const input = window.prompt('Counted cash in drawer');
+    if (input === null) return;
+    try {
+      const report = await api.closeShift(shift.id, parseFloat(input) || 0);
+      alert(`Shift closed. Expected: ${report.expected_cash.toFixed(2)}, counted: ${(report.counted_cash ?? 0).toFixed(2)}, over/short: ${(report.over_short ?? 0).toFixed(2)}`);
+      setShift(null);
+    } catch (error) {
+      setError(error instanceof Error ? error.message : 'Failed to close shift');
+    }
+  };
+
   const loadProducts = async () => {
     try {
       setLoading(true);
@@ -113,7 +148,6 @@ export default function POSPage() {
 
     try {
       const saleData = {
-        user_id: parseInt(userId),
         customer_id: customerId ? parseInt(customerId) : undefined,
         payment_method: paymentMethod,
         items: cart.map(item => ({
@@ -163,6 +197,18 @@ export default function POSPage() {
           </div>
         )}
         
+        <div className="mx-6 mt-4 flex items-center justify-between rounded-md bg-gray-50 px-4 py-2 text-sm">
+          <span className="text-gray-700">
+            {shift ? `Shift #${shift.id} open, float ${shift.opening_float.toFixed(2)}` : 'No shift open on this till'}
+          </span>
+          <button
+            onClick={shift ? closeShift : openShift}
+            className="rounded-md bg-blue-600 px-3 py-1 font-medium text-white hover:bg-blue-700"
+          >
+            {shift ? 'Close shift' : 'Open shift'}
+          </button>
+        </div>
+
         <div className="flex-1 grid grid-cols-1 lg:grid-cols-3 gap-6 p-6 overflow-hidden">
           {/* Products Section */}
           <div className="lg:col-span-2">
@@ -1,7 +1,8 @@
 'use client';
 
-import React, { useState } from 'react';
-import { CartItem, PaymentMethod } from '@/types';
+import React, { useEffect, useState } from 'react';
+import { CartItem, PaymentMethod, SaleQuote } from '@/types';
+import { api } from '@/lib/api';
 import { formatCurrency } from '@/lib/utils';
 import { 
   ShoppingCart, 
@@ -35,7 +36,27 @@ export default function Cart({
   const [paymentMethod, setPaymentMethod] = useState<PaymentMethod>('cash');
   const [discountCode, setDiscountCode] = useState('');
 
-  const total = items.reduce((sum, item) => sum + (item.price * item.quantity), 0);
+  const [quote, setQuote] = useState<SaleQuote | null>(null);
+
+  // Totals come from the server so they match what the sale will charge
+  useEffect(() => {
+    if (items.length === 0) {
+      setQuote(null);
+      return;
+    }
+    let cancelled = false;
+    api.quoteSale({
+      items: items.map(item => ({ product_id: item.id, quantity: item.quantity })),
+      discount_codes: discountCode ? [discountCode] : [],
+    })
+      .then(q => { if (!cancelled) setQuote(q); })
+      .catch(() => { if (!cancelled) setQuote(null); });
+    return () => { cancelled = true; };
+  }, [items, discountCode]);
+
+  const total = quote
+    ? quote.final_amount
+    : items.reduce((sum, item) => sum + (item.price * item.quantity), 0);
 
   const handleCheckout = (e: React.FormEvent) => {
     e.preventDefault();
@@ -77,6 +98,25 @@ export default function Cart({
       {items.length > 0 && (
         <>
           <div className="border-t pt-4 mb-4">
+            {quote && quote.discount_amount > 0 && (
+              <>
+                <div className="flex justify-between items-center text-sm text-gray-600">
+                  <span>Subtotal:</span>
+                  <span>{formatCurrency(quote.total_amount)}</span>
+                </div>
+                {quote.discounts.map((d) => (
+                  <div key={d.discount_id} className="flex justify-between items-center text-sm text-green-700">
+                    <span>Discount ({d.code}):</span>
+                    <span>-{formatCurrency(d.amount)}</span>
+                  </div>
+                ))}
+              </>
+            )}
+            {quote && quote.unapplied_codes.length > 0 && (
+              <p className="text-xs text-red-600">
+                Code not valid: {quote.unapplied_codes.join(', ')}
+              </p>
+            )}
             <div className="flex justify-between items-center">
               <span className="text-lg font-semibold text-gray-900">Total:</span>
               <span className="text-xl font-bold text-blue-600">
@@ -1,11 +1,12 @@
 'use client';
 
 import React, { createContext, useContext, useState, useEffect } from 'react';
+import { api, SESSION_TOKEN_KEY } from '@/lib/api';
 
 interface AuthContextType {
   userId: string | null;
-  login: (userId: string) => void;
-  logout: () => void;
+  login: (username: string, password: string) => Promise<void>;
+  logout: () => Promise<void>;
   isLoggedIn: boolean;
 }
 
@@ -18,19 +19,27 @@ export function AuthProvider({ children }: { children: React.ReactNode }) {
   useEffect(() => {
     // Check for existing login on mount
     const storedUserId = localStorage.getItem('loggedInUserId');
-    if (storedUserId) {
+    if (storedUserId && localStorage.getItem(SESSION_TOKEN_KEY)) {
       setUserId(storedUserId);
     }
     setIsLoaded(true);
   }, []);
 
-  const login = (userId: string) => {
-    setUserId(userId);
-    localStorage.setItem('loggedInUserId', userId);
+  const login = async (username: string, password: string) => {
+    const result = await api.login(username, password);
+    localStorage.setItem(SESSION_TOKEN_KEY, result.token);
+    localStorage.setItem('loggedInUserId', String(result.user.id));
+    setUserId(String(result.user.id));
   };
 
-  const logout = () => {
+  const logout = async () => {
+    try {
+      await api.logout();
+    } catch {
+      // The session may already be expired; clear local state regardless.
+    }
     setUserId(null);
+    localStorage.removeItem(SESSION_TOKEN_KEY);
     localStorage.removeItem('loggedInUserId');
   };
 
@@ -8,9 +8,15 @@ import {
   CreateProductRequest,
   CreateCustomerRequest,
   RegisterUserRequest,
+  LoginResponse,
+  Shift,
+  ZReport,
+  PaymentMethodOption,
+  SaleQuote,
 } from '@/types';
 
 const API_BASE_URL = '/api';
+export const SESSION_TOKEN_KEY = 'sessionToken';
 
 class ApiService {
   private async request<T>(
@@ -18,13 +24,15 @@ class ApiService {
     options: RequestInit = {}
   ): Promise<T> {
     const url = `${API_BASE_URL}${endpoint}`;
+    const token = typeof window !== 'undefined' ? localStorage.getItem(SESSION_TOKEN_KEY) : null;
     
     const config: RequestInit = {
+      ...options,
       headers: {
         'Content-Type': 'application/json',
+        ...(token ? { Authorization: `Bearer ${token}` } : {}),
         ...options.headers,
       },
-      ...options,
     };
 
     try {
@@ -48,6 +56,31 @@ class ApiService {
     }
   }
 
+  // Auth API
+  async login(username: string, password: string): Promise<LoginResponse> {
+    return this.request<LoginResponse>('/auth/login', {
+      method: 'POST',
+      body: JSON.stringify({ username, password }),
+    });
+  }
+
+  async logout(): Promise<void> {
+    return this.request<void>('/auth/logout', {
+      method: 'POST',
+    });
+  }
+
+  async getBootstrapStatus(): Promise<{ required: boolean }> {
+    return this.request<{ required: boolean }>('/auth/bootstrap');
+  }
+
+  async bootstrap(username: string, password: string): Promise<{ user_id: number }> {
+    return this.request<{ user_id: number }>('/auth/bootstrap', {
+      method: 'POST',
+      body: JSON.stringify({ username, password }),
+    });
+  }
+
   // Products API
   async getProducts(): Promise<Product[]> {
     return this.request<Product[]>('/products');
@@ -107,8 +140,15 @@ class ApiService {
   }
 
   // Sales API
-  async createSale(sale: CreateSaleRequest): Promise<{ sale_id: number }> {
-    return this.request<{ sale_id: number }>('/sales', {
+  async createSale(sale: CreateSaleRequest): Promise<{ sale_id: number; change_due: number }> {
+    return this.request<{ sale_id: number; change_due: number }>('/sales', {
+      method: 'POST',
+      body: JSON.stringify(sale),
+    });
+  }
+
+  async quoteSale(sale: CreateSaleRequest): Promise<SaleQuote> {
+    return this.request<SaleQuote>('/sales/quote', {
       method: 'POST',
       body: JSON.stringify(sale),
     });
@@ -122,6 +162,30 @@ class ApiService {
     return this.request<Sale>(`/sales/${id}`);
   }
 
+  // Payment methods API
+  async getPaymentMethods(): Promise<PaymentMethodOption[]> {
+    return this.request<PaymentMethodOption[]>('/payment-methods?active=true');
+  }
+
+  // Shifts API
+  async getCurrentShift(): Promise<Shift> {
+    return this.request<Shift>('/shifts/current');
+  }
+
+  async openShift(openingFloat: number): Promise<Shift> {
+    return this.request<Shift>('/shifts', {
+      method: 'POST',
+      body: JSON.stringify({ opening_float: openingFloat }),
+    });
+  }
+
+  async closeShift(id: number, countedCash: number): Promise<ZReport> {
+    return this.request<ZReport>(`/shifts/${id}/close`, {
+      method: 'POST',
+      body: JSON.stringify({ counted_cash: countedCash }),
+    });
+  }
+
   // Users API
   async registerUser(user: RegisterUserRequest): Promise<{ user_id: number }> {
     return this.request<{ user_id: number }>('/users/register', {
@@ -5,7 +5,10 @@ export interface Product {
   name: string;
   sku: string;
   price: number;
+  cost_price?: number;
   quantity: number;
+  reorder_point?: number | null;
+  reorder_quantity?: number | null;
   description?: string;
   created_at?: string;
 }
@@ -23,9 +26,18 @@ export interface User {
   id: number;
   username: string;
   role: string;
+  store_id?: number;
   created_at?: string;
 }
 
+export interface LoginResponse {
+  token: string;
+  expires_at: string;
+  location_id: number;
+  terminal_id?: number | null;
+  user: User;
+}
+
 export interface CartItem extends Product {
   quantity: number;
 }
@@ -42,8 +54,96 @@ export interface Sale {
   total_amount: number;
   final_amount: number;
   payment_method: string;
+  store_id?: number;
+  location_id?: number;
+  terminal_id?: number | null;
+  shift_id?: number | null;
+  change_due?: number;
+  status?: 'completed' | 'voided';
+  voided_at?: string;
+  voided_by?: number;
+  void_approved_by?: number;
+  void_reason?: string;
   transaction_time: string;
   items?: SaleItem[];
+  payments?: SalePayment[];
+  returns?: SaleReturn[];
+}
+
+export interface SaleReturn {
+  id: number;
+  sale_id: number;
+  user_id: number;
+  store_id: number;
+  location_id: number;
+  terminal_id?: number | null;
+  shift_id?: number | null;
+  refund_amount: number;
+  payment_method: string;
+  reference?: string | null;
+  reason?: string | null;
+  created_at: string;
+  items: {
+    product_id: number;
+    quantity: number;
+    price_at_sale: number;
+    discount_amount: number;
+    refund_amount: number;
+    damaged: boolean;
+  }[];
+}
+
+export interface PaymentMethodOption {
+  id: number;
+  code: string;
+  name: string;
+  opens_drawer: boolean;
+  allows_change: boolean;
+  is_active: boolean;
+  created_at: string;
+}
+
+export interface SalePayment {
+  id: number;
+  sale_id: number;
+  payment_method: string;
+  amount: number;
+  tendered: number;
+  reference?: string | null;
+  created_at: string;
+}
+
+export interface Shift {
+  id: number;
+  status: 'open' | 'closed';
+  location_id: number;
+  terminal_id?: number | null;
+  opening_float: number;
+  opened_at: string;
+  closed_at?: string | null;
+  counted_cash?: number | null;
+  expected_cash?: number | null;
+  over_short?: number | null;
+}
+
+export interface ZReport {
+  shift: Shift;
+  total_transactions: number;
+  total_revenue: number;
+  sales_by_method: {
+    payment_method: string;
+    name: string;
+    total_transactions: number;
+    total_revenue: number;
+  }[];
+  cash_sales: number;
+  refunds: number;
+  cash_refunds: number;
+  paid_in: number;
+  paid_out: number;
+  expected_cash: number;
+  counted_cash?: number | null;
+  over_short?: number | null;
 }
 
 export interface SalesReport {
@@ -51,22 +151,91 @@ export interface SalesReport {
   end_date: string;
   total_revenue: number;
   total_transactions: number;
+  total_returns: number;
+  net_revenue: number;
+  total_cost: number;
+  gross_profit: number;
+  gross_margin: number;
   top_selling_products: {
     product_id: number;
     product_name: string;
     total_sold: number;
     total_value: number;
+    total_cost: number;
+    gross_profit: number;
+    gross_margin: number;
+  }[];
+  sales_by_day?: {
+    date: string;
+    total_transactions: number;
+    total_revenue: number;
+    total_cost: number;
+    gross_profit: number;
+    gross_margin: number;
+  }[];
+  sales_by_store?: {
+    store_id: number;
+    store_name: string;
+    total_transactions: number;
+    total_revenue: number;
   }[];
+  sales_by_method?: {
+    payment_method: string;
+    name: string;
+    total_transactions: number;
+    total_revenue: number;
+  }[];
+}
+
+export interface HeldCart {
+  id: number;
+  status: 'held' | 'completed' | 'discarded';
+  store_id: number;
+  location_id: number;
+  terminal_id?: number | null;
+  customer_id?: number | null;
+  note?: string | null;
+  held_at: string;
+  sale_id?: number | null;
+  items: SaleItem[];
+  discount_codes: string[];
+  quote?: SaleQuote; // Only while the cart is held
 }
 
 export interface CreateSaleRequest {
-  user_id: number;
   customer_id?: number;
-  payment_method: string;
+  payment_method?: string;
+  payments?: {
+    payment_method: string;
+    amount: number;
+    reference?: string;
+  }[];
   items: SaleItem[];
   discount_codes?: string[];
 }
 
+export interface SaleQuote {
+  lines: {
+    product_id: number;
+    name: string;
+    quantity: number;
+    unit_price: number;
+    line_total: number;
+    available: number;
+  }[];
+  discounts: {
+    discount_id: number;
+    code: string;
+    discount_type: 'percentage' | 'fixed_amount';
+    value: number;
+    amount: number;
+  }[];
+  unapplied_codes: string[];
+  total_amount: number;
+  discount_amount: number;
+  final_amount: number;
+}
+
 export interface CreateProductRequest {
   name: string;
   sku: string;
@@ -86,6 +255,7 @@ export interface RegisterUserRequest {
   username: string;
   password: string;
   role?: string;
+  store_id?: number;
 }
 
 export type PaymentMethod = 'cash' | 'credit_card';
@@ -0,0 +1,218 @@
+package audit
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"pos-app/internal/auth"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+// snapshotQueries maps the entity type (the path segment after /api) to a
+// query returning the entity's current state by ID. Entities without an entry
+// are still logged, just without before/after state. Amounts are stored in
+// cents and snapshotted in major units, as the API shows them.
+var snapshotQueries = map[string]string{
+	"products":  "SELECT p.id, p.sku, p.name, p.description, p.price / 100.0 AS price, p.cost_price / 100.0 AS cost_price, i.quantity FROM products p LEFT JOIN inventory i ON p.id = i.product_id WHERE p.id = ?",
+	"customers": "SELECT id, name, phone_number, email, address FROM customers WHERE id = ?",
+	"discounts": "SELECT id, code, store_id, description, discount_type, value, is_active, valid_from, valid_until FROM discounts WHERE id = ?",
+	"users":     "SELECT id, username, role, store_id, is_active, deactivated_at, pin_hash IS NOT NULL AS has_pin FROM users WHERE id = ?",
+	"suppliers": "SELECT id, name, contact_name, phone_number, email, address FROM suppliers WHERE id = ?",
+	"purchase-orders": "SELECT po.id, po.supplier_id, po.store_id, po.status, po.notes, " +
+		"(SELECT json_group_array(json_object('product_id', product_id, 'ordered', quantity_ordered, 'received', quantity_received, 'unit_cost', unit_cost / 100.0)) " +
+		"FROM purchase_order_items WHERE purchase_order_id = po.id) AS items FROM purchase_orders po WHERE po.id = ?",
+	"locations":       "SELECT id, store_id, name, is_active FROM locations WHERE id = ?",
+	"stores":          "SELECT id, name, is_active FROM stores WHERE id = ?",
+	"payment-methods": "SELECT id, code, name, opens_drawer, allows_change, is_active FROM payment_methods WHERE id = ?",
+	"held-carts": "SELECT c.id, c.status, c.store_id, c.location_id, c.customer_id, c.sale_id, " +
+		"(SELECT json_group_array(json_object('product_id', product_id, 'quantity', quantity)) FROM held_cart_items WHERE cart_id = c.id) AS items " +
+		"FROM held_carts c WHERE c.id = ?",
+	"terminals": "SELECT id, location_id, name, is_active, enrolled_at FROM terminals WHERE id = ?",
+	"shifts": "SELECT sh.id, sh.status, sh.location_id, sh.terminal_id, sh.opening_float / 100.0 AS opening_float, sh.counted_cash / 100.0 AS counted_cash, " +
+		"sh.expected_cash / 100.0 AS expected_cash, sh.over_short / 100.0 AS over_short, " +
+		"(SELECT json_group_array(json_object('type', movement_type, 'amount', amount / 100.0, 'reason', reason)) " +
+		"FROM shift_cash_movements WHERE shift_id = sh.id) AS movements FROM shifts sh WHERE sh.id = ?",
+	"transfers": "SELECT t.id, t.from_location_id, t.to_location_id, t.status, t.notes, " +
+		"(SELECT json_group_array(json_object('product_id', product_id, 'quantity', quantity)) " +
+		"FROM stock_transfer_items WHERE transfer_id = t.id) AS items FROM stock_transfers t WHERE t.id = ?",
+	"stocktakes": "SELECT st.id, st.status, st.location_id, st.notes, " +
+		"(SELECT json_group_array(json_object('product_id', product_id, 'expected', expected_quantity, 'counted', counted_quantity, 'variance', variance)) " +
+		"FROM stocktake_items WHERE stocktake_id = st.id) AS items FROM stocktakes st WHERE st.id = ?",
+	"sales": "SELECT id, user_id, customer_id, total_amount / 100.0 AS total_amount, final_amount / 100.0 AS final_amount, payment_method, store_id, location_id, terminal_id, shift_id, change_due / 100.0 AS change_due, status, void_reason, transaction_time FROM sales WHERE id = ?",
+}
+
+// Recorder writes an audit_log row for every mutating request it wraps.
+type Recorder struct {
+	DB *sql.DB
+	// ReadOnly lists requests, as "METHOD /path", that are POSTs only to carry
+	// a body and change nothing, such as price quotes. They aren't logged.
+	ReadOnly map[string]bool
+}
+
+// Middleware records POST, PUT and DELETE requests together with the acting
+// user and the before/after state of the entity the path refers to. It must
+// run after auth.Sessions.Middleware.
+func (a *Recorder) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if (r.Method != http.MethodPost && r.Method != http.MethodPut && r.Method != http.MethodDelete) || a.ReadOnly[r.Method+" "+r.URL.Path] {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		entityType, entityID := parsePath(r.URL.Path)
+		before := a.snapshot(entityType, entityID)
+
+		var body bytes.Buffer
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		ww.Tee(&body)
+		next.ServeHTTP(ww, r)
+
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+		// Creates only learn their ID from the response body.
+		if entityID == nil && status < 300 {
+			entityID = idFromResponse(body.Bytes())
+		}
+		after := a.snapshot(entityType, entityID)
+
+		var userID *int
+		if u, ok := auth.UserFromContext(r.Context()); ok {
+			userID = &u.ID
+		}
+
+		_, err := a.DB.Exec(
+			"INSERT INTO audit_log(user_id, method, path, entity_type, entity_id, status, before_json, after_json, diff_json) VALUES(?, ?, ?, ?, ?, ?, ?, ?, ?)",
+			userID, r.Method, r.URL.Path, entityType, entityID, status, toJSON(before), toJSON(after), toJSON(diff(before, after)),
+		)
+		if err != nil {
+			// The response has already been sent; don't fail the request over the audit trail.
+			log.Printf("Failed to write audit log for %s %s: %v", r.Method, r.URL.Path, err)
+		}
+	})
+}
+
+// parsePath extracts the entity type and numeric ID from /api/{entity}/{id}/...
+func parsePath(path string) (string, *int) {
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(path, "/api"), "/"), "/")
+	if len(parts) == 0 {
+		return "", nil
+	}
+	if len(parts) < 2 {
+		return parts[0], nil
+	}
+	id, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return parts[0], nil
+	}
+	return parts[0], &id
+}
+
+// idFromResponse finds the created entity's ID in a JSON response, either as
+// "id" or as a single "<entity>_id" key such as {"sale_id": 3}.
+func idFromResponse(body []byte) *int {
+	var m map[string]any
+	if err := json.Unmarshal(body, &m); err != nil {
+		return nil
+	}
+	if v, ok := m["id"].(float64); ok {
+		id := int(v)
+		return &id
+	}
+	// With several "_id" keys there's no telling which is the entity's own
+	var ids []int
+	for k, v := range m {
+		if f, ok := v.(float64); ok && strings.HasSuffix(k, "_id") {
+			ids = append(ids, int(f))
+		}
+	}
+	if len(ids) != 1 {
+		return nil
+	}
+	return &ids[0]
+}
+
+func (a *Recorder) snapshot(entityType string, id *int) map[string]any {
+	query, ok := snapshotQueries[entityType]
+	if !ok || id == nil {
+		return nil
+	}
+
+	rows, err := a.DB.Query(query, *id)
+	if err != nil {
+		log.Printf("Failed to snapshot %s %d for audit: %v", entityType, *id, err)
+		return nil
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		return nil
+	}
+	cols, err := rows.Columns()
+	if err != nil {
+		return nil
+	}
+	values := make([]any, len(cols))
+	ptrs := make([]any, len(cols))
+	for i := range values {
+		ptrs[i] = &values[i]
+	}
+	if err := rows.Scan(ptrs...); err != nil {
+		log.Printf("Failed to snapshot %s %d for audit: %v", entityType, *id, err)
+		return nil
+	}
+
+	state := make(map[string]any, len(cols))
+	for i, col := range cols {
+		if b, ok := values[i].([]byte); ok {
+			state[col] = string(b)
+		} else {
+			state[col] = values[i]
+		}
+	}
+	return state
+}
+
+// Change is a single field's value before and after a request.
+type Change struct {
+	Before any `json:"before"`
+	After  any `json:"after"`
+}
+
+// diff returns the fields whose values differ between before and after.
+func diff(before, after map[string]any) map[string]Change {
+	if before == nil && after == nil {
+		return nil
+	}
+	changes := map[string]Change{}
+	for k, b := range before {
+		if a, ok := after[k]; !ok || !reflect.DeepEqual(a, b) {
+			changes[k] = Change{Before: b, After: after[k]}
+		}
+	}
+	for k, a := range after {
+		if _, ok := before[k]; !ok {
+			changes[k] = Change{After: a}
+		}
+	}
+	return changes
+}
+
+func toJSON(v any) *string {
+	if v == nil || reflect.ValueOf(v).IsNil() {
+		return nil
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil
+	}
+	s := string(b)
+	return &s
+}
@@ -0,0 +1,35 @@
+package auth
+
+import (
+	"context"
+	"pos-app/internal/model"
+)
+
+type contextKey int
+
+const (
+	userKey contextKey = iota
+	sessionKey
+)
+
+// WithUser returns a copy of ctx carrying the authenticated user.
+func WithUser(ctx context.Context, u *model.User) context.Context {
+	return context.WithValue(ctx, userKey, u)
+}
+
+// UserFromContext returns the authenticated user set by Middleware, if any.
+func UserFromContext(ctx context.Context) (*model.User, bool) {
+	u, ok := ctx.Value(userKey).(*model.User)
+	return u, ok
+}
+
+// WithSession returns a copy of ctx carrying the current session.
+func WithSession(ctx context.Context, s *Session) context.Context {
+	return context.WithValue(ctx, sessionKey, s)
+}
+
+// SessionFromContext returns the current session set by Middleware, if any.
+func SessionFromContext(ctx context.Context) (*Session, bool) {
+	s, ok := ctx.Value(sessionKey).(*Session)
+	return s, ok
+}
@@ -0,0 +1,26 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/hex"
+)
+
+// NewSecret returns a random secret of n bytes, encoded so it can be typed in
+// on a till, together with the hash to store in its place.
+func NewSecret(n int) (secret, hash string, err error) {
+	raw := make([]byte, n)
+	if _, err := rand.Read(raw); err != nil {
+		return "", "", err
+	}
+	secret = base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(raw)
+	return secret, HashSecret(secret), nil
+}
+
+// HashSecret returns the hash a secret from NewSecret is stored and looked up by.
+// Secrets are long and random, so a plain SHA-256 is enough.
+func HashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
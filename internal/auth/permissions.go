@@ -0,0 +1,101 @@
+package auth
+
+import (
+	"net/http"
+)
+
+// Roles stored in users.role.
+const (
+	RoleAdmin   = "admin"
+	RoleManager = "manager"
+	RoleCashier = "cashier"
+)
+
+// Permission names a capability checked by Require.
+type Permission string
+
+const (
+	PermSalesCreate     Permission = "sales:create"
+	PermSalesRead       Permission = "sales:read"
+	PermSalesRefund     Permission = "sales:refund"
+	PermSalesVoid       Permission = "sales:void" // Approving voids with the manager's own credentials
+	PermProductsWrite   Permission = "products:write"
+	PermInventoryAdjust Permission = "inventory:adjust"
+	PermPurchasing      Permission = "purchasing:manage"
+	PermCustomersWrite  Permission = "customers:write"
+	PermCustomersDelete Permission = "customers:delete"
+	PermDiscountsWrite  Permission = "discounts:write"
+	PermUsersAdmin      Permission = "users:admin"
+	PermReportsRead     Permission = "reports:read"
+	PermAuditRead       Permission = "audit:read"
+	PermTerminalsManage Permission = "terminals:manage"
+	// PermShiftsManage allows recording cash movements on and closing shifts
+	// of other tills' drawers. Without it, only the till's own shift.
+	PermShiftsManage Permission = "shifts:manage"
+	// PermStoresAdmin allows managing stores and seeing data across all of them.
+	// Without it, users only see their own store.
+	PermStoresAdmin Permission = "stores:admin"
+	// PermPaymentsAdmin allows managing the payment method catalog, which all stores share.
+	PermPaymentsAdmin Permission = "payments:admin"
+)
+
+// rolePermissions is the permission matrix. Roles not listed here have no permissions.
+var rolePermissions = map[string][]Permission{
+	RoleAdmin: {
+		PermSalesCreate, PermSalesRead, PermSalesRefund, PermSalesVoid, PermProductsWrite, PermInventoryAdjust, PermPurchasing, PermCustomersWrite, PermCustomersDelete,
+		PermDiscountsWrite, PermUsersAdmin, PermReportsRead, PermAuditRead, PermTerminalsManage, PermStoresAdmin,
+		PermPaymentsAdmin, PermShiftsManage,
+	},
+	RoleManager: {
+		PermSalesCreate, PermSalesRead, PermSalesRefund, PermSalesVoid, PermProductsWrite, PermInventoryAdjust, PermPurchasing, PermCustomersWrite, PermCustomersDelete,
+		PermDiscountsWrite, PermReportsRead, PermAuditRead, PermTerminalsManage, PermShiftsManage,
+	},
+	RoleCashier: {
+		PermSalesCreate, PermSalesRead, PermCustomersWrite,
+	},
+}
+
+// ValidRole reports whether role is one of the known roles.
+func ValidRole(role string) bool {
+	_, ok := rolePermissions[role]
+	return ok
+}
+
+// HasPermission reports whether the role grants the permission.
+func HasPermission(role string, p Permission) bool {
+	for _, granted := range rolePermissions[role] {
+		if granted == p {
+			return true
+		}
+	}
+	return false
+}
+
+// RoleIncludes reports whether role grants every permission other does.
+func RoleIncludes(role, other string) bool {
+	for _, p := range rolePermissions[other] {
+		if !HasPermission(role, p) {
+			return false
+		}
+	}
+	return true
+}
+
+// Require returns middleware that rejects requests whose user lacks the permission.
+// It must run after Sessions.Middleware.
+func Require(p Permission) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			u, ok := UserFromContext(r.Context())
+			if !ok {
+				http.Error(w, "Authentication required", http.StatusUnauthorized)
+				return
+			}
+			if !HasPermission(u.Role, p) {
+				http.Error(w, "Forbidden: missing permission "+string(p), http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,178 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"pos-app/internal/database"
+	"pos-app/internal/model"
+	"strings"
+	"time"
+)
+
+// ErrInvalidSession is returned when a token is malformed, has a bad signature,
+// or refers to a session that is expired, revoked or unknown.
+var ErrInvalidSession = errors.New("invalid or expired session")
+
+// Sessions issues and verifies signed session tokens backed by the sessions table.
+type Sessions struct {
+	DB     *sql.DB
+	Secret []byte
+	TTL    time.Duration
+}
+
+// Session represents a row in the sessions table.
+type Session struct {
+	ID     string
+	UserID int // The user who logged in on this terminal
+	// ActiveUserID is the cashier currently working the terminal. It starts as
+	// UserID and changes when another cashier switches in with their PIN.
+	ActiveUserID int
+	LocationID   int  // Where the terminal is; sales take stock from here
+	StoreID      int  // The store LocationID belongs to
+	TerminalID   *int // The enrolled till the session was opened on, if any
+	ExpiresAt    time.Time
+}
+
+// Create starts a new session for the user at the given location, optionally
+// on an enrolled terminal, and returns its signed token.
+func (s *Sessions) Create(userID, locationID int, terminalID *int) (string, time.Time, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", time.Time{}, err
+	}
+	id := base64.RawURLEncoding.EncodeToString(raw)
+	now := time.Now().UTC()
+	expiresAt := now.Add(s.TTL)
+
+	// Housekeeping: drop sessions that can no longer be used.
+	if _, err := s.DB.Exec("DELETE FROM sessions WHERE expires_at < ? OR revoked_at IS NOT NULL", now.Format(database.TimeFormat)); err != nil {
+		return "", time.Time{}, err
+	}
+
+	_, err := s.DB.Exec("INSERT INTO sessions(id, user_id, location_id, terminal_id, expires_at) VALUES(?, ?, ?, ?, ?)",
+		id, userID, locationID, terminalID, expiresAt.Format(database.TimeFormat))
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	return id + "." + s.sign(id), expiresAt, nil
+}
+
+// Lookup verifies the token signature and returns the live session it refers
+// to. Sessions on a terminal that has since been deactivated are no longer live.
+func (s *Sessions) Lookup(token string) (*Session, error) {
+	id, ok := s.verify(token)
+	if !ok {
+		return nil, ErrInvalidSession
+	}
+
+	var sess Session
+	err := s.DB.QueryRow(
+		`SELECT s.id, s.user_id, COALESCE(s.active_user_id, s.user_id), COALESCE(s.location_id, ?), COALESCE(l.store_id, ?), s.terminal_id, s.expires_at
+		FROM sessions s
+		LEFT JOIN locations l ON l.id = COALESCE(s.location_id, ?)
+		LEFT JOIN terminals t ON t.id = s.terminal_id
+		WHERE s.id = ? AND s.revoked_at IS NULL AND s.expires_at > ? AND (s.terminal_id IS NULL OR t.is_active)`,
+		database.DefaultLocationID, database.DefaultStoreID, database.DefaultLocationID, id, time.Now().UTC().Format(database.TimeFormat),
+	).Scan(&sess.ID, &sess.UserID, &sess.ActiveUserID, &sess.LocationID, &sess.StoreID, &sess.TerminalID, &sess.ExpiresAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrInvalidSession
+		}
+		return nil, err
+	}
+	return &sess, nil
+}
+
+// Revoke ends the session so its token can no longer be used.
+func (s *Sessions) Revoke(sessionID string) error {
+	_, err := s.DB.Exec("UPDATE sessions SET revoked_at = ? WHERE id = ?", time.Now().UTC().Format(database.TimeFormat), sessionID)
+	return err
+}
+
+// SetActiveUser switches the cashier working on the session's terminal.
+func (s *Sessions) SetActiveUser(sessionID string, userID int) error {
+	_, err := s.DB.Exec("UPDATE sessions SET active_user_id = ? WHERE id = ?", userID, sessionID)
+	return err
+}
+
+// RevokeUser ends every open session belonging to the user.
+func (s *Sessions) RevokeUser(userID int) error {
+	_, err := s.DB.Exec("UPDATE sessions SET revoked_at = ? WHERE user_id = ? AND revoked_at IS NULL", time.Now().UTC().Format(database.TimeFormat), userID)
+	return err
+}
+
+// RevokeTerminal ends every open session on the terminal.
+func (s *Sessions) RevokeTerminal(terminalID int) error {
+	_, err := s.DB.Exec("UPDATE sessions SET revoked_at = ? WHERE terminal_id = ? AND revoked_at IS NULL", time.Now().UTC().Format(database.TimeFormat), terminalID)
+	return err
+}
+
+// Middleware rejects requests that do not carry a valid bearer token and
+// stores the session and its active user in the request context.
+func (s *Sessions) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := bearerToken(r)
+		if !ok {
+			http.Error(w, "Authentication required", http.StatusUnauthorized)
+			return
+		}
+
+		sess, err := s.Lookup(token)
+		if err != nil {
+			if err == ErrInvalidSession {
+				http.Error(w, "Invalid or expired session", http.StatusUnauthorized)
+			} else {
+				http.Error(w, "Failed to verify session", http.StatusInternalServerError)
+			}
+			return
+		}
+
+		var u model.User
+		err = s.DB.QueryRow("SELECT id, store_id, username, role, is_active, created_at FROM users WHERE id = ? AND is_active = TRUE", sess.ActiveUserID).
+			Scan(&u.ID, &u.StoreID, &u.Username, &u.Role, &u.IsActive, &u.CreatedAt)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				http.Error(w, "Invalid or expired session", http.StatusUnauthorized)
+			} else {
+				http.Error(w, "Failed to load session user", http.StatusInternalServerError)
+			}
+			return
+		}
+
+		ctx := WithSession(r.Context(), sess)
+		ctx = WithUser(ctx, &u)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func (s *Sessions) sign(id string) string {
+	mac := hmac.New(sha256.New, s.Secret)
+	mac.Write([]byte(id))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func (s *Sessions) verify(token string) (string, bool) {
+	id, sig, found := strings.Cut(token, ".")
+	if !found || id == "" {
+		return "", false
+	}
+	if !hmac.Equal([]byte(sig), []byte(s.sign(id))) {
+		return "", false
+	}
+	return id, true
+}
+
+func bearerToken(r *http.Request) (string, bool) {
+	h := r.Header.Get("Authorization")
+	token, found := strings.CutPrefix(h, "Bearer ")
+	if !found || token == "" {
+		return "", false
+	}
+	return token, true
+}
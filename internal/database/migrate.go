@@ -0,0 +1,357 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"pos-app/internal/money"
+	"regexp"
+	"strings"
+)
+
+// columnMigrations lists columns added after their table was first released.
+// CREATE TABLE IF NOT EXISTS leaves existing tables untouched, so databases
+// created by an older build get these columns added here.
+var columnMigrations = []struct {
+	table      string
+	column     string
+	definition string
+}{
+	{"users", "is_active", "BOOLEAN NOT NULL DEFAULT TRUE"},
+	{"users", "deactivated_at", "DATETIME"},
+	{"users", "pin_hash", "TEXT"},
+	{"sessions", "active_user_id", "INTEGER REFERENCES users(id)"},
+	{"inventory_movements", "note", "TEXT"},
+	{"inventory", "reorder_point", "INTEGER"},
+	{"inventory", "reorder_quantity", "INTEGER"},
+	{"inventory_movements", "unit_cost", "INTEGER"},
+	{"products", "cost_price", "INTEGER NOT NULL DEFAULT 0"},
+	{"sale_items", "cost_at_sale", "INTEGER"}, // NULL for sales made before costs were tracked
+	{"inventory_movements", "location_id", "INTEGER REFERENCES locations(id)"},
+	{"sales", "location_id", "INTEGER REFERENCES locations(id)"},
+	{"sessions", "location_id", "INTEGER REFERENCES locations(id)"},
+	{"stocktakes", "location_id", "INTEGER NOT NULL DEFAULT 1"},
+	{"users", "store_id", "INTEGER NOT NULL DEFAULT 1"},
+	{"locations", "store_id", "INTEGER NOT NULL DEFAULT 1"},
+	{"purchase_orders", "store_id", "INTEGER NOT NULL DEFAULT 1"},
+	{"discounts", "store_id", "INTEGER"}, // NULL means the discount applies in every store
+	{"sales", "store_id", "INTEGER"},
+	{"sales", "terminal_id", "INTEGER REFERENCES terminals(id)"},
+	{"sessions", "terminal_id", "INTEGER REFERENCES terminals(id)"},
+	{"sales", "shift_id", "INTEGER REFERENCES shifts(id)"},
+	{"sales", "change_due", "INTEGER NOT NULL DEFAULT 0"},
+	{"sales", "status", "TEXT NOT NULL DEFAULT 'completed'"},
+	{"sales", "voided_at", "DATETIME"},
+	{"sales", "voided_by", "INTEGER REFERENCES users(id)"},
+	{"sales", "void_approved_by", "INTEGER REFERENCES users(id)"},
+	{"sales", "void_reason", "TEXT"},
+	{"applied_discounts", "reversed_at", "DATETIME"}, // Set when the sale is voided
+}
+
+// migrateColumns adds any column from columnMigrations that is missing.
+func migrateColumns(db *sql.DB) {
+	for _, m := range columnMigrations {
+		exists, err := columnExists(db, m.table, m.column)
+		if err != nil {
+			log.Fatalf("Error inspecting table %s: %v", m.table, err)
+		}
+		if exists {
+			continue
+		}
+		if _, err := db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", m.table, m.column, m.definition)); err != nil {
+			log.Fatalf("Error adding column %s.%s: %v", m.table, m.column, err)
+		}
+	}
+}
+
+func columnExists(db *sql.DB, table, column string) (bool, error) {
+	_, types, err := tableColumns(db, table)
+	_, ok := types[column]
+	return ok, err
+}
+
+// tableColumns returns a table's column names in order, and their declared types.
+func tableColumns(db *sql.DB, table string) ([]string, map[string]string, error) {
+	rows, err := db.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	var names []string
+	types := map[string]string{}
+	for rows.Next() {
+		var (
+			cid       int
+			name      string
+			colType   string
+			notNull   bool
+			dfltValue sql.NullString
+			pk        int
+		)
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &dfltValue, &pk); err != nil {
+			return nil, nil, err
+		}
+		names = append(names, name)
+		types[name] = colType
+	}
+	return names, types, rows.Err()
+}
+
+// moneyColumns lists the columns holding amounts of money. They were REAL
+// holding major units and are now INTEGER cents; discounts.value is left
+// REAL as it holds a percentage for percentage discounts.
+var moneyColumns = []struct {
+	table   string
+	columns []string
+}{
+	{"products", []string{"price", "cost_price"}},
+	{"inventory_movements", []string{"unit_cost"}},
+	{"purchase_order_items", []string{"unit_cost"}},
+	{"sales", []string{"total_amount", "final_amount", "change_due"}},
+	{"sale_items", []string{"price_at_sale", "cost_at_sale"}},
+	{"sale_payments", []string{"amount", "tendered"}},
+	{"sale_returns", []string{"refund_amount"}},
+	{"sale_return_items", []string{"price_at_sale", "cost_at_sale", "discount_amount", "refund_amount"}},
+	{"applied_discounts", []string{"amount_discounted"}},
+	{"shifts", []string{"opening_float", "counted_cash", "expected_cash", "over_short"}},
+	{"shift_cash_movements", []string{"amount"}},
+}
+
+// migrateMoney converts money columns still declared REAL to INTEGER cents.
+// SQLite can't change a column's type, so each such table is copied into a
+// new one with the corrected declaration and swapped in with its indexes and
+// AUTOINCREMENT counter. Amounts are converted in Go with money.FromFloat, so
+// they round the way the rest of the app does. An amount that wasn't a whole
+// number of cents, such as an unrounded discount, is kept as it was in
+// money_migration_originals alongside the cents it became.
+func migrateMoney(db *sql.DB) {
+	for _, m := range moneyColumns {
+		if err := migrateMoneyTable(db, m.table, m.columns); err != nil {
+			log.Fatalf("Error converting %s to cents: %v", m.table, err)
+		}
+	}
+}
+
+func migrateMoneyTable(db *sql.DB, table string, moneyCols []string) error {
+	cols, types, err := tableColumns(db, table)
+	if err != nil {
+		return err
+	}
+	var convert []string
+	for _, c := range moneyCols {
+		if strings.EqualFold(types[c], "REAL") {
+			convert = append(convert, c)
+		}
+	}
+	if len(convert) == 0 {
+		return nil
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var createSQL string
+	if err := tx.QueryRow("SELECT sql FROM sqlite_master WHERE type = 'table' AND name = ?", table).Scan(&createSQL); err != nil {
+		return err
+	}
+	newTable := table + "_cents"
+	createSQL = regexp.MustCompile(`(?i)^CREATE TABLE\s+(IF NOT EXISTS\s+)?"?`+table+`"?`).ReplaceAllString(createSQL, "CREATE TABLE "+newTable)
+	selects := append([]string{}, cols...)
+	for _, c := range convert {
+		createSQL = regexp.MustCompile(`(?i)(\b`+c+`\s+)REAL\b`).ReplaceAllString(createSQL, "${1}INTEGER")
+		for i := range cols {
+			if cols[i] == c {
+				selects[i] = fmt.Sprintf("CAST(%s AS INTEGER)", c)
+			}
+		}
+		if err := convertToCents(tx, table, c); err != nil {
+			return err
+		}
+	}
+	// Tables without an id keep their rowids, so money_migration_originals
+	// still points at the right rows
+	if _, ok := types["id"]; !ok {
+		cols = append([]string{"rowid"}, cols...)
+		selects = append([]string{"rowid"}, selects...)
+	}
+
+	var indexes []string
+	rows, err := tx.Query("SELECT sql FROM sqlite_master WHERE type = 'index' AND tbl_name = ? AND sql IS NOT NULL", table)
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var idx string
+		if err := rows.Scan(&idx); err != nil {
+			rows.Close()
+			return err
+		}
+		indexes = append(indexes, idx)
+	}
+	rows.Close()
+
+	var seq sql.NullInt64
+	if err := tx.QueryRow("SELECT seq FROM sqlite_sequence WHERE name = ?", table).Scan(&seq); err != nil && err != sql.ErrNoRows {
+		return err
+	}
+
+	statements := []string{
+		createSQL,
+		fmt.Sprintf("INSERT INTO %s(%s) SELECT %s FROM %s", newTable, strings.Join(cols, ", "), strings.Join(selects, ", "), table),
+		fmt.Sprintf("DROP TABLE %s", table),
+		fmt.Sprintf("ALTER TABLE %s RENAME TO %s", newTable, table),
+	}
+	statements = append(statements, indexes...)
+	for _, stmt := range statements {
+		if _, err := tx.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	if seq.Valid {
+		if _, err := tx.Exec("UPDATE sqlite_sequence SET seq = MAX(seq, ?) WHERE name = ?", seq.Int64, table); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// convertToCents rewrites a REAL column of major units in place as whole
+// cents, ready to be copied across as INTEGER. Amounts that weren't whole
+// cents are saved to money_migration_originals first.
+func convertToCents(tx *sql.Tx, table, column string) error {
+	type amount struct {
+		rowID int64
+		value float64
+	}
+	var amounts []amount
+	rows, err := tx.Query(fmt.Sprintf("SELECT rowid, %s FROM %s WHERE %s IS NOT NULL", column, table, column))
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var a amount
+		if err := rows.Scan(&a.rowID, &a.value); err != nil {
+			rows.Close()
+			return err
+		}
+		amounts = append(amounts, a)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	kept := 0
+	for _, a := range amounts {
+		cents := money.FromFloat(a.value)
+		if cents.Float() != a.value {
+			if kept == 0 {
+				if _, err := tx.Exec(`CREATE TABLE IF NOT EXISTS money_migration_originals (
+					table_name TEXT NOT NULL,
+					column_name TEXT NOT NULL,
+					row_id INTEGER NOT NULL,
+					original REAL NOT NULL,
+					cents INTEGER NOT NULL,
+					migrated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+				)`); err != nil {
+					return err
+				}
+			}
+			if _, err := tx.Exec("INSERT INTO money_migration_originals(table_name, column_name, row_id, original, cents) VALUES(?, ?, ?, ?, ?)",
+				table, column, a.rowID, a.value, cents); err != nil {
+				return err
+			}
+			kept++
+		}
+		if _, err := tx.Exec(fmt.Sprintf("UPDATE %s SET %s = ? WHERE rowid = ?", table, column), int64(cents), a.rowID); err != nil {
+			return err
+		}
+	}
+	if kept > 0 {
+		log.Printf("%d amounts in %s.%s weren't whole cents; their original values are in money_migration_originals", kept, table, column)
+	}
+	return nil
+}
+
+// backfillInventoryLedger gives products that predate the inventory ledger an
+// opening-balance movement, so their stock reconciles against the ledger.
+func backfillInventoryLedger(db *sql.DB) {
+	_, err := db.Exec(`
+		INSERT INTO inventory_movements(product_id, quantity_change, quantity_after, movement_type, reason)
+		SELECT i.product_id, i.quantity, i.quantity, 'adjustment', 'opening balance'
+		FROM inventory i
+		WHERE i.quantity != 0
+			AND NOT EXISTS (SELECT 1 FROM inventory_movements m WHERE m.product_id = i.product_id)`)
+	if err != nil {
+		log.Fatalf("Error backfilling inventory ledger: %v", err)
+	}
+}
+
+// backfillLocations makes sure the default location exists and assigns stock,
+// movements and sales recorded before multi-location support to it.
+func backfillLocations(db *sql.DB) {
+	statements := []string{
+		fmt.Sprintf("INSERT OR IGNORE INTO locations(id, name) VALUES(%d, 'Main')", DefaultLocationID),
+		fmt.Sprintf(`INSERT INTO inventory_locations(product_id, location_id, quantity)
+			SELECT i.product_id, %d, i.quantity FROM inventory i
+			WHERE NOT EXISTS (SELECT 1 FROM inventory_locations il WHERE il.product_id = i.product_id)`, DefaultLocationID),
+		fmt.Sprintf("UPDATE inventory_movements SET location_id = %d WHERE location_id IS NULL", DefaultLocationID),
+		fmt.Sprintf("UPDATE sales SET location_id = %d WHERE location_id IS NULL", DefaultLocationID),
+	}
+	for _, stmt := range statements {
+		if _, err := db.Exec(stmt); err != nil {
+			log.Fatalf("Error backfilling locations: %v", err)
+		}
+	}
+}
+
+// backfillStores makes sure the default store exists and assigns sales made
+// before multi-store support to the store of the location they were made at.
+func backfillStores(db *sql.DB) {
+	statements := []string{
+		fmt.Sprintf("INSERT OR IGNORE INTO stores(id, name) VALUES(%d, 'Main Store')", DefaultStoreID),
+		fmt.Sprintf(`UPDATE sales SET store_id = COALESCE((SELECT l.store_id FROM locations l WHERE l.id = sales.location_id), %d)
+			WHERE store_id IS NULL`, DefaultStoreID),
+	}
+	for _, stmt := range statements {
+		if _, err := db.Exec(stmt); err != nil {
+			log.Fatalf("Error backfilling stores: %v", err)
+		}
+	}
+}
+
+// backfillSalePayments records sales made before split tender as a single
+// payment of their final amount in their payment method.
+func backfillSalePayments(db *sql.DB) {
+	_, err := db.Exec(`
+		INSERT INTO sale_payments(sale_id, payment_method, amount, tendered, created_at)
+		SELECT s.id, s.payment_method, s.final_amount, s.final_amount, s.transaction_time
+		FROM sales s
+		WHERE NOT EXISTS (SELECT 1 FROM sale_payments p WHERE p.sale_id = s.id)`)
+	if err != nil {
+		log.Fatalf("Error backfilling sale payments: %v", err)
+	}
+}
+
+// backfillPaymentMethods seeds the payment method catalog and brings sales
+// made before it existed into line: their methods are normalised to lower-case
+// codes, and any code not in the catalog is added to it as inactive.
+func backfillPaymentMethods(db *sql.DB) {
+	statements := []string{
+		`INSERT OR IGNORE INTO payment_methods(code, name, opens_drawer, allows_change)
+			VALUES('cash', 'Cash', TRUE, TRUE), ('credit_card', 'Credit card', FALSE, FALSE)`,
+		`UPDATE sale_payments SET payment_method = LOWER(TRIM(payment_method)) WHERE payment_method != LOWER(TRIM(payment_method))`,
+		`UPDATE sales SET payment_method = LOWER(TRIM(payment_method)) WHERE payment_method != LOWER(TRIM(payment_method))`,
+		`INSERT OR IGNORE INTO payment_methods(code, name, is_active)
+			SELECT DISTINCT payment_method, payment_method, FALSE FROM sale_payments WHERE payment_method != ''`,
+	}
+	for _, stmt := range statements {
+		if _, err := db.Exec(stmt); err != nil {
+			log.Fatalf("Error backfilling payment methods: %v", err)
+		}
+	}
+}
@@ -0,0 +1,178 @@
+package database
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+)
+
+// baselineSchema is the schema as first released, with money held as REAL
+// major units.
+var baselineSchema = []string{
+	`CREATE TABLE users (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		username TEXT NOT NULL UNIQUE,
+		password_hash TEXT NOT NULL,
+		role TEXT NOT NULL DEFAULT 'cashier',
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);`,
+	`CREATE TABLE customers (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		name TEXT NOT NULL,
+		phone_number TEXT UNIQUE,
+		email TEXT UNIQUE,
+		address TEXT,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);`,
+	`CREATE TABLE products (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		sku TEXT NOT NULL UNIQUE,
+		name TEXT NOT NULL,
+		description TEXT,
+		price REAL NOT NULL,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);`,
+	`CREATE TABLE inventory (
+		product_id INTEGER NOT NULL,
+		quantity INTEGER NOT NULL DEFAULT 0,
+		last_updated DATETIME DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (product_id) REFERENCES products(id)
+	);`,
+	`CREATE TABLE discounts (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		code TEXT NOT NULL UNIQUE,
+		description TEXT,
+		discount_type TEXT NOT NULL,
+		value REAL NOT NULL,
+		is_active BOOLEAN NOT NULL DEFAULT TRUE,
+		valid_from DATETIME,
+		valid_until DATETIME,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);`,
+	`CREATE TABLE sales (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id INTEGER NOT NULL,
+		customer_id INTEGER,
+		total_amount REAL NOT NULL,
+		final_amount REAL NOT NULL,
+		payment_method TEXT NOT NULL,
+		transaction_time DATETIME DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (user_id) REFERENCES users(id),
+		FOREIGN KEY (customer_id) REFERENCES customers(id)
+	);`,
+	`CREATE TABLE sale_items (
+		sale_id INTEGER NOT NULL,
+		product_id INTEGER NOT NULL,
+		quantity INTEGER NOT NULL,
+		price_at_sale REAL NOT NULL,
+		FOREIGN KEY (sale_id) REFERENCES sales(id),
+		FOREIGN KEY (product_id) REFERENCES products(id)
+	);`,
+	`CREATE TABLE applied_discounts (
+		sale_id INTEGER NOT NULL,
+		discount_id INTEGER NOT NULL,
+		amount_discounted REAL NOT NULL,
+		FOREIGN KEY (sale_id) REFERENCES sales(id),
+		FOREIGN KEY (discount_id) REFERENCES discounts(id)
+	);`,
+}
+
+func TestMigrateMoneyFromBaseline(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "pos.db")
+	old, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	statements := append(baselineSchema,
+		`INSERT INTO users(id, username, password_hash) VALUES(1, 'admin', 'x')`,
+		`INSERT INTO products(id, sku, name, price) VALUES(1, 'TEA', 'Tea', 3.33), (2, 'ODD', 'Odd', 1.005), (7, 'CAKE', 'Cake', 12.5)`,
+		`INSERT INTO inventory(product_id, quantity) VALUES(1, 10), (2, 10), (7, 10)`,
+		`INSERT INTO discounts(id, code, discount_type, value) VALUES(1, 'TEN', 'percentage', 10)`,
+		`INSERT INTO sales(id, user_id, total_amount, final_amount, payment_method) VALUES(4, 1, 22.49, 20.241, 'Cash')`,
+		`INSERT INTO sale_items(sale_id, product_id, quantity, price_at_sale) VALUES(4, 1, 3, 3.33), (4, 7, 1, 12.5)`,
+		`INSERT INTO applied_discounts(sale_id, discount_id, amount_discounted) VALUES(4, 1, 2.249)`,
+	)
+	for _, stmt := range statements {
+		if _, err := old.Exec(stmt); err != nil {
+			t.Fatalf("%s: %v", stmt, err)
+		}
+	}
+	old.Close()
+
+	db := InitDB(path)
+	defer func() { db.Close() }()
+
+	tests := []struct {
+		query string
+		want  int64
+	}{
+		{"SELECT price FROM products WHERE id = 1", 333},
+		{"SELECT price FROM products WHERE id = 2", 101}, // Halves round away from zero, as in money.Parse
+		{"SELECT price FROM products WHERE id = 7", 1250},
+		{"SELECT total_amount FROM sales WHERE id = 4", 2249},
+		{"SELECT final_amount FROM sales WHERE id = 4", 2024},
+		{"SELECT SUM(price_at_sale * quantity) FROM sale_items WHERE sale_id = 4", 2249},
+		{"SELECT amount_discounted FROM applied_discounts WHERE sale_id = 4", 225},
+		{"SELECT amount FROM sale_payments WHERE sale_id = 4", 2024},
+		{"SELECT COUNT(*) FROM products WHERE typeof(price) != 'integer'", 0},
+		{"SELECT COUNT(*) FROM sales WHERE typeof(final_amount) != 'integer'", 0},
+		{"SELECT seq FROM sqlite_sequence WHERE name = 'products'", 7},
+	}
+	for _, tt := range tests {
+		var got int64
+		if err := db.QueryRow(tt.query).Scan(&got); err != nil {
+			t.Fatalf("%s: %v", tt.query, err)
+		}
+		if got != tt.want {
+			t.Errorf("%s = %d, want %d", tt.query, got, tt.want)
+		}
+	}
+
+	var value float64
+	if err := db.QueryRow("SELECT value FROM discounts WHERE id = 1").Scan(&value); err != nil || value != 10 {
+		t.Errorf("discounts.value = %v (%v), want 10 left as a percentage", value, err)
+	}
+
+	// Amounts that weren't whole cents keep their original values
+	originals := map[string]float64{}
+	rows, err := db.Query("SELECT table_name || '.' || column_name || ':' || row_id, original, cents FROM money_migration_originals")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for rows.Next() {
+		var (
+			key      string
+			original float64
+			cents    int64
+		)
+		if err := rows.Scan(&key, &original, &cents); err != nil {
+			t.Fatal(err)
+		}
+		originals[key] = original
+	}
+	rows.Close()
+	want := map[string]float64{
+		"products.price:2":                      1.005,
+		"sales.final_amount:4":                  20.241,
+		"applied_discounts.amount_discounted:1": 2.249,
+	}
+	if len(originals) != len(want) {
+		t.Errorf("got originals %v, want %v", originals, want)
+	}
+	for key, v := range want {
+		if originals[key] != v {
+			t.Errorf("original %s = %v, want %v", key, originals[key], v)
+		}
+	}
+
+	// Opening the database again leaves it as it is
+	db.Close()
+	db = InitDB(path)
+	var price, kept int64
+	if err := db.QueryRow("SELECT price FROM products WHERE id = 2").Scan(&price); err != nil || price != 101 {
+		t.Errorf("price after reopening = %d (%v), want 101", price, err)
+	}
+	if err := db.QueryRow("SELECT COUNT(*) FROM money_migration_originals").Scan(&kept); err != nil || kept != int64(len(want)) {
+		t.Errorf("got %d originals after reopening (%v), want %d", kept, err, len(want))
+	}
+}
@@ -18,17 +18,42 @@ func InitDB(dataSourceName string) *sql.DB {
 	}
 
 	createTables(db)
+	migrateColumns(db)
+	migrateMoney(db)
+	backfillInventoryLedger(db)
+	backfillLocations(db)
+	backfillStores(db)
+	backfillSalePayments(db)
+	backfillPaymentMethods(db)
 	return db
 }
 
+// DefaultLocationID is the location created on first run. Stock, sales and
+// sessions that predate multi-location support belong to it.
+const DefaultLocationID = 1
+
+// DefaultStoreID is the store created on first run. Users, locations, sales and
+// purchase orders that predate multi-store support belong to it.
+const DefaultStoreID = 1
+
 // createTables creates the necessary tables in the database based on the full schema.
 func createTables(db *sql.DB) {
 	statements := []string{
+		`CREATE TABLE IF NOT EXISTS stores (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			name TEXT NOT NULL UNIQUE,
+			is_active BOOLEAN NOT NULL DEFAULT TRUE,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		);`,
 		`CREATE TABLE IF NOT EXISTS users (
 			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			store_id INTEGER NOT NULL DEFAULT 1,
 			username TEXT NOT NULL UNIQUE,
 			password_hash TEXT NOT NULL,
+			pin_hash TEXT,
 			role TEXT NOT NULL DEFAULT 'cashier',
+			is_active BOOLEAN NOT NULL DEFAULT TRUE,
+			deactivated_at DATETIME,
 			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
 		);`,
 		`CREATE TABLE IF NOT EXISTS customers (
@@ -44,18 +69,150 @@ func createTables(db *sql.DB) {
 			sku TEXT NOT NULL UNIQUE,
 			name TEXT NOT NULL,
 			description TEXT,
-			price REAL NOT NULL,
+			price INTEGER NOT NULL,
+			cost_price INTEGER NOT NULL DEFAULT 0,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		);`,
+		`CREATE TABLE IF NOT EXISTS locations (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			store_id INTEGER NOT NULL DEFAULT 1,
+			name TEXT NOT NULL UNIQUE,
+			is_active BOOLEAN NOT NULL DEFAULT TRUE,
 			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
 		);`,
 		`CREATE TABLE IF NOT EXISTS inventory (
 			product_id INTEGER NOT NULL,
 			quantity INTEGER NOT NULL DEFAULT 0,
+			reorder_point INTEGER,
+			reorder_quantity INTEGER,
 			last_updated DATETIME DEFAULT CURRENT_TIMESTAMP,
 			FOREIGN KEY (product_id) REFERENCES products(id)
 		);`,
+		`CREATE TABLE IF NOT EXISTS inventory_locations (
+			product_id INTEGER NOT NULL,
+			location_id INTEGER NOT NULL,
+			quantity INTEGER NOT NULL DEFAULT 0,
+			PRIMARY KEY (product_id, location_id),
+			FOREIGN KEY (product_id) REFERENCES products(id),
+			FOREIGN KEY (location_id) REFERENCES locations(id)
+		);`,
+		`CREATE TABLE IF NOT EXISTS inventory_movements (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			product_id INTEGER NOT NULL,
+			quantity_change INTEGER NOT NULL,
+			quantity_after INTEGER NOT NULL,
+			movement_type TEXT NOT NULL,
+			reason TEXT,
+			note TEXT,
+			unit_cost INTEGER,
+			location_id INTEGER,
+			user_id INTEGER,
+			reference_id INTEGER,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (product_id) REFERENCES products(id),
+			FOREIGN KEY (location_id) REFERENCES locations(id),
+			FOREIGN KEY (user_id) REFERENCES users(id)
+		);`,
+		`CREATE TABLE IF NOT EXISTS stock_transfers (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			from_location_id INTEGER NOT NULL,
+			to_location_id INTEGER NOT NULL,
+			status TEXT NOT NULL DEFAULT 'in_transit',
+			notes TEXT,
+			created_by INTEGER,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			received_by INTEGER,
+			received_at DATETIME,
+			cancelled_at DATETIME,
+			FOREIGN KEY (from_location_id) REFERENCES locations(id),
+			FOREIGN KEY (to_location_id) REFERENCES locations(id),
+			FOREIGN KEY (created_by) REFERENCES users(id),
+			FOREIGN KEY (received_by) REFERENCES users(id)
+		);`,
+		`CREATE TABLE IF NOT EXISTS stock_transfer_items (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			transfer_id INTEGER NOT NULL,
+			product_id INTEGER NOT NULL,
+			quantity INTEGER NOT NULL,
+			FOREIGN KEY (transfer_id) REFERENCES stock_transfers(id),
+			FOREIGN KEY (product_id) REFERENCES products(id)
+		);`,
+		`CREATE INDEX IF NOT EXISTS idx_inventory_movements_product ON inventory_movements(product_id, id);`,
+		`CREATE TABLE IF NOT EXISTS suppliers (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			name TEXT NOT NULL,
+			contact_name TEXT,
+			phone_number TEXT,
+			email TEXT,
+			address TEXT,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		);`,
+		`CREATE TABLE IF NOT EXISTS purchase_orders (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			supplier_id INTEGER NOT NULL,
+			store_id INTEGER NOT NULL DEFAULT 1,
+			status TEXT NOT NULL DEFAULT 'draft',
+			notes TEXT,
+			created_by INTEGER,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			sent_at DATETIME,
+			received_at DATETIME,
+			cancelled_at DATETIME,
+			FOREIGN KEY (supplier_id) REFERENCES suppliers(id),
+			FOREIGN KEY (created_by) REFERENCES users(id)
+		);`,
+		`CREATE TABLE IF NOT EXISTS purchase_order_items (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			purchase_order_id INTEGER NOT NULL,
+			product_id INTEGER NOT NULL,
+			quantity_ordered INTEGER NOT NULL,
+			quantity_received INTEGER NOT NULL DEFAULT 0,
+			unit_cost INTEGER NOT NULL,
+			FOREIGN KEY (purchase_order_id) REFERENCES purchase_orders(id),
+			FOREIGN KEY (product_id) REFERENCES products(id)
+		);`,
+		`CREATE TABLE IF NOT EXISTS stocktakes (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			status TEXT NOT NULL DEFAULT 'open',
+			location_id INTEGER NOT NULL DEFAULT 1,
+			notes TEXT,
+			opened_by INTEGER,
+			opened_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			closed_by INTEGER,
+			closed_at DATETIME,
+			cancelled_at DATETIME,
+			last_movement_id INTEGER NOT NULL DEFAULT 0,
+			FOREIGN KEY (opened_by) REFERENCES users(id),
+			FOREIGN KEY (closed_by) REFERENCES users(id)
+		);`,
+		`CREATE TABLE IF NOT EXISTS stocktake_items (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			stocktake_id INTEGER NOT NULL,
+			product_id INTEGER NOT NULL,
+			expected_quantity INTEGER NOT NULL,
+			counted_quantity INTEGER,
+			last_movement_id INTEGER,
+			variance INTEGER,
+			UNIQUE (stocktake_id, product_id),
+			FOREIGN KEY (stocktake_id) REFERENCES stocktakes(id),
+			FOREIGN KEY (product_id) REFERENCES products(id)
+		);`,
+		`CREATE TABLE IF NOT EXISTS stocktake_counts (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			stocktake_id INTEGER NOT NULL,
+			product_id INTEGER NOT NULL,
+			quantity INTEGER NOT NULL,
+			replaced BOOLEAN NOT NULL DEFAULT FALSE,
+			user_id INTEGER,
+			counted_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (stocktake_id) REFERENCES stocktakes(id),
+			FOREIGN KEY (product_id) REFERENCES products(id),
+			FOREIGN KEY (user_id) REFERENCES users(id)
+		);`,
 		`CREATE TABLE IF NOT EXISTS discounts (
 			id INTEGER PRIMARY KEY AUTOINCREMENT,
 			code TEXT NOT NULL UNIQUE,
+			store_id INTEGER,
 			description TEXT,
 			discount_type TEXT NOT NULL,
 			value REAL NOT NULL,
@@ -68,28 +225,203 @@ func createTables(db *sql.DB) {
 			id INTEGER PRIMARY KEY AUTOINCREMENT,
 			user_id INTEGER NOT NULL,
 			customer_id INTEGER,
-			total_amount REAL NOT NULL,
-			final_amount REAL NOT NULL,
+			total_amount INTEGER NOT NULL,
+			final_amount INTEGER NOT NULL,
 			payment_method TEXT NOT NULL,
+			store_id INTEGER,
+			location_id INTEGER,
+			terminal_id INTEGER,
+			shift_id INTEGER,
+			change_due INTEGER NOT NULL DEFAULT 0,
+			status TEXT NOT NULL DEFAULT 'completed',
+			voided_at DATETIME,
+			voided_by INTEGER,
+			void_approved_by INTEGER,
+			void_reason TEXT,
 			transaction_time DATETIME DEFAULT CURRENT_TIMESTAMP,
 			FOREIGN KEY (user_id) REFERENCES users(id),
-			FOREIGN KEY (customer_id) REFERENCES customers(id)
+			FOREIGN KEY (customer_id) REFERENCES customers(id),
+			FOREIGN KEY (location_id) REFERENCES locations(id),
+			FOREIGN KEY (terminal_id) REFERENCES terminals(id),
+			FOREIGN KEY (shift_id) REFERENCES shifts(id)
 		);`,
 		`CREATE TABLE IF NOT EXISTS sale_items (
 			sale_id INTEGER NOT NULL,
 			product_id INTEGER NOT NULL,
 			quantity INTEGER NOT NULL,
-			price_at_sale REAL NOT NULL,
+			price_at_sale INTEGER NOT NULL,
+			cost_at_sale INTEGER,
+			FOREIGN KEY (sale_id) REFERENCES sales(id),
+			FOREIGN KEY (product_id) REFERENCES products(id)
+		);`,
+		`CREATE TABLE IF NOT EXISTS payment_methods (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			code TEXT NOT NULL UNIQUE,
+			name TEXT NOT NULL,
+			opens_drawer BOOLEAN NOT NULL DEFAULT FALSE,
+			allows_change BOOLEAN NOT NULL DEFAULT FALSE,
+			is_active BOOLEAN NOT NULL DEFAULT TRUE,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		);`,
+		`CREATE TABLE IF NOT EXISTS held_carts (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			status TEXT NOT NULL DEFAULT 'held',
+			store_id INTEGER NOT NULL,
+			location_id INTEGER NOT NULL,
+			terminal_id INTEGER,
+			customer_id INTEGER,
+			note TEXT,
+			held_by INTEGER,
+			held_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			closed_by INTEGER,
+			closed_at DATETIME,
+			sale_id INTEGER,
+			FOREIGN KEY (location_id) REFERENCES locations(id),
+			FOREIGN KEY (terminal_id) REFERENCES terminals(id),
+			FOREIGN KEY (customer_id) REFERENCES customers(id),
+			FOREIGN KEY (held_by) REFERENCES users(id),
+			FOREIGN KEY (closed_by) REFERENCES users(id),
+			FOREIGN KEY (sale_id) REFERENCES sales(id)
+		);`,
+		`CREATE TABLE IF NOT EXISTS held_cart_items (
+			cart_id INTEGER NOT NULL,
+			product_id INTEGER NOT NULL,
+			quantity INTEGER NOT NULL,
+			FOREIGN KEY (cart_id) REFERENCES held_carts(id),
+			FOREIGN KEY (product_id) REFERENCES products(id)
+		);`,
+		`CREATE TABLE IF NOT EXISTS held_cart_discounts (
+			cart_id INTEGER NOT NULL,
+			code TEXT NOT NULL,
+			FOREIGN KEY (cart_id) REFERENCES held_carts(id)
+		);`,
+		`CREATE TABLE IF NOT EXISTS sale_payments (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			sale_id INTEGER NOT NULL,
+			payment_method TEXT NOT NULL,
+			amount INTEGER NOT NULL,
+			tendered INTEGER NOT NULL,
+			reference TEXT,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (sale_id) REFERENCES sales(id)
+		);`,
+		`CREATE TABLE IF NOT EXISTS sale_returns (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			sale_id INTEGER NOT NULL,
+			user_id INTEGER NOT NULL,
+			store_id INTEGER NOT NULL,
+			location_id INTEGER NOT NULL,
+			terminal_id INTEGER,
+			shift_id INTEGER,
+			refund_amount INTEGER NOT NULL,
+			payment_method TEXT NOT NULL,
+			reference TEXT,
+			reason TEXT,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
 			FOREIGN KEY (sale_id) REFERENCES sales(id),
+			FOREIGN KEY (user_id) REFERENCES users(id),
+			FOREIGN KEY (location_id) REFERENCES locations(id),
+			FOREIGN KEY (terminal_id) REFERENCES terminals(id),
+			FOREIGN KEY (shift_id) REFERENCES shifts(id)
+		);`,
+		`CREATE TABLE IF NOT EXISTS sale_return_items (
+			return_id INTEGER NOT NULL,
+			product_id INTEGER NOT NULL,
+			quantity INTEGER NOT NULL,
+			price_at_sale INTEGER NOT NULL,
+			cost_at_sale INTEGER,
+			discount_amount INTEGER NOT NULL DEFAULT 0,
+			refund_amount INTEGER NOT NULL,
+			damaged BOOLEAN NOT NULL DEFAULT FALSE,
+			FOREIGN KEY (return_id) REFERENCES sale_returns(id),
 			FOREIGN KEY (product_id) REFERENCES products(id)
 		);`,
 		`CREATE TABLE IF NOT EXISTS applied_discounts (
 			sale_id INTEGER NOT NULL,
 			discount_id INTEGER NOT NULL,
-			amount_discounted REAL NOT NULL,
+			amount_discounted INTEGER NOT NULL,
+			reversed_at DATETIME,
 			FOREIGN KEY (sale_id) REFERENCES sales(id),
 			FOREIGN KEY (discount_id) REFERENCES discounts(id)
 		);`,
+		`CREATE TABLE IF NOT EXISTS terminals (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			location_id INTEGER NOT NULL,
+			name TEXT NOT NULL,
+			credential_hash TEXT UNIQUE,
+			enrolment_code_hash TEXT UNIQUE,
+			enrolment_expires_at DATETIME,
+			is_active BOOLEAN NOT NULL DEFAULT TRUE,
+			enrolled_at DATETIME,
+			last_seen_at DATETIME,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			UNIQUE (location_id, name),
+			FOREIGN KEY (location_id) REFERENCES locations(id)
+		);`,
+		`CREATE TABLE IF NOT EXISTS shifts (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			status TEXT NOT NULL DEFAULT 'open',
+			location_id INTEGER NOT NULL,
+			terminal_id INTEGER,
+			opening_float INTEGER NOT NULL,
+			notes TEXT,
+			opened_by INTEGER,
+			opened_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			closed_by INTEGER,
+			closed_at DATETIME,
+			counted_cash INTEGER,
+			expected_cash INTEGER,
+			over_short INTEGER,
+			FOREIGN KEY (location_id) REFERENCES locations(id),
+			FOREIGN KEY (terminal_id) REFERENCES terminals(id),
+			FOREIGN KEY (opened_by) REFERENCES users(id),
+			FOREIGN KEY (closed_by) REFERENCES users(id)
+		);`,
+		`CREATE TABLE IF NOT EXISTS shift_cash_movements (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			shift_id INTEGER NOT NULL,
+			movement_type TEXT NOT NULL,
+			amount INTEGER NOT NULL,
+			reason TEXT,
+			user_id INTEGER,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (shift_id) REFERENCES shifts(id),
+			FOREIGN KEY (user_id) REFERENCES users(id)
+		);`,
+		`CREATE TABLE IF NOT EXISTS sessions (
+			id TEXT PRIMARY KEY,
+			user_id INTEGER NOT NULL,
+			active_user_id INTEGER,
+			location_id INTEGER,
+			terminal_id INTEGER,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			expires_at DATETIME NOT NULL,
+			revoked_at DATETIME,
+			FOREIGN KEY (user_id) REFERENCES users(id),
+			FOREIGN KEY (active_user_id) REFERENCES users(id)
+		);`,
+		`CREATE TABLE IF NOT EXISTS auth_failures (
+			key TEXT PRIMARY KEY, -- What is throttled, e.g. a username or a client address
+			failed_attempts INTEGER NOT NULL DEFAULT 0,
+			locked_until DATETIME,
+			last_failed_at DATETIME NOT NULL
+		);`,
+		`CREATE TABLE IF NOT EXISTS audit_log (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			user_id INTEGER,
+			method TEXT NOT NULL,
+			path TEXT NOT NULL,
+			entity_type TEXT NOT NULL,
+			entity_id INTEGER,
+			status INTEGER NOT NULL,
+			before_json TEXT,
+			after_json TEXT,
+			diff_json TEXT,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (user_id) REFERENCES users(id)
+		);`,
+		`CREATE INDEX IF NOT EXISTS idx_audit_log_entity ON audit_log(entity_type, entity_id);`,
+		`CREATE INDEX IF NOT EXISTS idx_audit_log_created_at ON audit_log(created_at);`,
 	}
 
 	for _, stmt := range statements {
@@ -0,0 +1,5 @@
+package database
+
+// TimeFormat is the layout used when writing timestamps from Go. It matches
+// SQLite's CURRENT_TIMESTAMP so values compare correctly in SQL.
+const TimeFormat = "2006-01-02 15:04:05"
@@ -0,0 +1,76 @@
+package events
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+// Event types published on the Bus.
+const (
+	TypeLowStock = "inventory.low_stock"
+)
+
+// Event is a notification that something happened, published after the
+// change that caused it has been committed.
+type Event struct {
+	Type       string    `json:"type"`
+	OccurredAt time.Time `json:"occurred_at"`
+	Payload    any       `json:"payload"`
+}
+
+// LowStock is the payload of TypeLowStock, emitted when a product's stock
+// drops to or below its reorder point.
+type LowStock struct {
+	ProductID       int    `json:"product_id"`
+	SKU             string `json:"sku"`
+	Name            string `json:"name"`
+	Quantity        int    `json:"quantity"`
+	ReorderPoint    int    `json:"reorder_point"`
+	ReorderQuantity int    `json:"reorder_quantity"`
+}
+
+// Handler consumes an event. Handlers run synchronously on the publishing
+// request, so anything slow (e.g. HTTP webhooks) should hand off to a goroutine.
+type Handler func(Event)
+
+// Bus is an in-process publish/subscribe hub. A nil *Bus discards events.
+type Bus struct {
+	mu       sync.RWMutex
+	handlers map[string][]Handler
+}
+
+// Subscribe registers h for events of the given type.
+func (b *Bus) Subscribe(eventType string, h Handler) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.handlers == nil {
+		b.handlers = map[string][]Handler{}
+	}
+	b.handlers[eventType] = append(b.handlers[eventType], h)
+}
+
+// Publish delivers an event of the given type to every subscriber.
+func (b *Bus) Publish(eventType string, payload any) {
+	if b == nil {
+		return
+	}
+	b.mu.RLock()
+	handlers := b.handlers[eventType]
+	b.mu.RUnlock()
+
+	e := Event{Type: eventType, OccurredAt: time.Now().UTC(), Payload: payload}
+	for _, h := range handlers {
+		deliver(h, e)
+	}
+}
+
+// deliver runs a handler, keeping a panicking subscriber from failing the request.
+func deliver(h Handler, e Event) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("Event handler for %s panicked: %v", e.Type, r)
+		}
+	}()
+	h(e)
+}
@@ -0,0 +1,116 @@
+package handler
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"pos-app/internal/model"
+	"strconv"
+	"strings"
+)
+
+type AuditHandler struct {
+	DB *sql.DB
+}
+
+// GetAuditLog handles listing audit entries, newest first. Supported filters:
+// user_id, entity_type, entity_id, start_date and end_date (YYYY-MM-DD), limit.
+// Within a store scope only entries made by that store's users are listed.
+func (h *AuditHandler) GetAuditLog(w http.ResponseWriter, r *http.Request) {
+	scope, err := storeScope(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	q := r.URL.Query()
+	where := []string{"1 = 1"}
+	args := []any{}
+
+	if scope != nil {
+		where = append(where, "a.user_id IN (SELECT id FROM users WHERE store_id = ?)")
+		args = append(args, *scope)
+	}
+
+	if v := q.Get("user_id"); v != "" {
+		id, err := strconv.Atoi(v)
+		if err != nil {
+			http.Error(w, "Invalid user_id", http.StatusBadRequest)
+			return
+		}
+		where = append(where, "a.user_id = ?")
+		args = append(args, id)
+	}
+	if v := q.Get("entity_type"); v != "" {
+		where = append(where, "a.entity_type = ?")
+		args = append(args, v)
+	}
+	if v := q.Get("entity_id"); v != "" {
+		id, err := strconv.Atoi(v)
+		if err != nil {
+			http.Error(w, "Invalid entity_id", http.StatusBadRequest)
+			return
+		}
+		where = append(where, "a.entity_id = ?")
+		args = append(args, id)
+	}
+	if v := q.Get("start_date"); v != "" {
+		where = append(where, "a.created_at >= ?")
+		args = append(args, v)
+	}
+	if v := q.Get("end_date"); v != "" {
+		// Ensure end date includes the whole day
+		where = append(where, "a.created_at <= ?")
+		args = append(args, v+" 23:59:59")
+	}
+
+	limit := 100
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+	args = append(args, limit)
+
+	rows, err := h.DB.Query(`
+		SELECT a.id, a.user_id, u.username, a.method, a.path, a.entity_type, a.entity_id, a.status,
+			a.before_json, a.after_json, a.diff_json, a.created_at
+		FROM audit_log a
+		LEFT JOIN users u ON u.id = a.user_id
+		WHERE `+strings.Join(where, " AND ")+`
+		ORDER BY a.id DESC
+		LIMIT ?`, args...)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	entries := []model.AuditEntry{}
+	for rows.Next() {
+		var e model.AuditEntry
+		var before, after, diff sql.NullString
+		if err := rows.Scan(&e.ID, &e.UserID, &e.Username, &e.Method, &e.Path, &e.EntityType, &e.EntityID, &e.Status,
+			&before, &after, &diff, &e.CreatedAt); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		e.Before = rawJSON(before)
+		e.After = rawJSON(after)
+		e.Diff = rawJSON(diff)
+		entries = append(entries, e)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(entries)
+}
+
+func rawJSON(s sql.NullString) json.RawMessage {
+	if !s.Valid {
+		return nil
+	}
+	return json.RawMessage(s.String)
+}
@@ -0,0 +1,417 @@
+package handler
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"pos-app/internal/auth"
+	"pos-app/internal/database"
+	"pos-app/internal/model"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+type AuthHandler struct {
+	DB       *sql.DB
+	Sessions *auth.Sessions
+}
+
+type LoginRequest struct {
+	Username   string `json:"username"`
+	Password   string `json:"password"`
+	LocationID *int   `json:"location_id"` // Optional; defaults to the first location of the user's store
+	// TerminalCredential identifies an enrolled till; its location is used and
+	// sales on the session are attributed to it.
+	TerminalCredential string `json:"terminal_credential"`
+}
+
+type LoginResponse struct {
+	Token      string     `json:"token"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	LocationID int        `json:"location_id"`
+	TerminalID *int       `json:"terminal_id"`
+	User       model.User `json:"user"`
+}
+
+// Login checks the username and password and starts a new session.
+func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
+	var req LoginRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.Username == "" || req.Password == "" {
+		http.Error(w, "Username and password are required", http.StatusBadRequest)
+		return
+	}
+
+	now := time.Now().UTC()
+	userKey, clientKey := "login:user:"+req.Username, "login:client:"+clientAddr(r)
+	locked, err := lockedOut(h.DB, now, userKey, clientKey)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if locked {
+		http.Error(w, "Too many failed logins; try again later", http.StatusTooManyRequests)
+		return
+	}
+
+	var u model.User
+	err = h.DB.QueryRow("SELECT id, store_id, username, password_hash, role, is_active, created_at FROM users WHERE username = ?", req.Username).
+		Scan(&u.ID, &u.StoreID, &u.Username, &u.PasswordHash, &u.Role, &u.IsActive, &u.CreatedAt)
+	if err != nil && err != sql.ErrNoRows {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	// Unknown users are checked against a dummy hash and get the same message
+	// as wrong passwords, so usernames can't be probed.
+	hash := &u.PasswordHash
+	if err == sql.ErrNoRows {
+		hash = nil
+	}
+	if !secretMatches(hash, req.Password) {
+		if err := recordFailure(h.DB, now, userKey, maxLoginAttempts); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if err := recordFailure(h.DB, now, clientKey, maxClientLoginAttempts); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		http.Error(w, "Invalid username or password", http.StatusUnauthorized)
+		return
+	}
+	if err := clearFailures(h.DB, userKey, clientKey); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !u.IsActive {
+		http.Error(w, "Account is deactivated", http.StatusForbidden)
+		return
+	}
+
+	// An enrolled till logs in at its own location
+	var terminalID *int
+	if req.TerminalCredential != "" {
+		t, err := terminalForCredential(h.DB, req.TerminalCredential)
+		if err == sql.ErrNoRows {
+			http.Error(w, "Unknown or inactive terminal", http.StatusUnauthorized)
+			return
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if req.LocationID != nil && *req.LocationID != t.LocationID {
+			http.Error(w, fmt.Sprintf("Terminal %q is at location %d", t.Name, t.LocationID), http.StatusBadRequest)
+			return
+		}
+		terminalID = &t.ID
+		req.LocationID = &t.LocationID
+	}
+
+	// Users log in at a location of their own store unless they can see every store
+	var locationID int
+	if req.LocationID != nil {
+		locationID = *req.LocationID
+		var active bool
+		var storeID int
+		err := h.DB.QueryRow("SELECT is_active, store_id FROM locations WHERE id = ?", locationID).Scan(&active, &storeID)
+		if err == sql.ErrNoRows || (err == nil && !active) {
+			http.Error(w, fmt.Sprintf("Location with ID %d not found or inactive", locationID), http.StatusBadRequest)
+			return
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if storeID != u.StoreID && !auth.HasPermission(u.Role, auth.PermStoresAdmin) {
+			http.Error(w, fmt.Sprintf("Location with ID %d belongs to another store", locationID), http.StatusForbidden)
+			return
+		}
+	} else {
+		err := h.DB.QueryRow("SELECT id FROM locations WHERE store_id = ? AND is_active = TRUE ORDER BY id LIMIT 1", u.StoreID).Scan(&locationID)
+		if err == sql.ErrNoRows {
+			http.Error(w, "Your store has no active location", http.StatusConflict)
+			return
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	token, expiresAt, err := h.Sessions.Create(u.ID, locationID, terminalID)
+	if err != nil {
+		http.Error(w, "Failed to create session", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(LoginResponse{Token: token, ExpiresAt: expiresAt, LocationID: locationID, TerminalID: terminalID, User: u})
+}
+
+// Logout revokes the session the request was authenticated with.
+func (h *AuthHandler) Logout(w http.ResponseWriter, r *http.Request) {
+	sess, ok := auth.SessionFromContext(r.Context())
+	if !ok {
+		http.Error(w, "Authentication required", http.StatusUnauthorized)
+		return
+	}
+
+	if err := h.Sessions.Revoke(sess.ID); err != nil {
+		http.Error(w, "Failed to end session", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Me returns the user the request was authenticated as.
+func (h *AuthHandler) Me(w http.ResponseWriter, r *http.Request) {
+	u, ok := auth.UserFromContext(r.Context())
+	if !ok {
+		http.Error(w, "Authentication required", http.StatusUnauthorized)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(u)
+}
+
+// BootstrapStatus reports whether the first admin account still needs to be created.
+func (h *AuthHandler) BootstrapStatus(w http.ResponseWriter, r *http.Request) {
+	var count int
+	if err := h.DB.QueryRow("SELECT COUNT(*) FROM users").Scan(&count); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]bool{"required": count == 0})
+}
+
+// Bootstrap creates the first admin account. It only succeeds while the users table is empty.
+func (h *AuthHandler) Bootstrap(w http.ResponseWriter, r *http.Request) {
+	var req LoginRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.Username == "" || req.Password == "" {
+		http.Error(w, "Username and password are required", http.StatusBadRequest)
+		return
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	if err != nil {
+		http.Error(w, "Failed to hash password", http.StatusInternalServerError)
+		return
+	}
+
+	// A single conditional insert so two concurrent bootstrap calls can't both succeed.
+	res, err := h.DB.Exec(
+		"INSERT INTO users(username, password_hash, role) SELECT ?, ?, ? WHERE NOT EXISTS (SELECT 1 FROM users)",
+		req.Username, string(hashedPassword), auth.RoleAdmin,
+	)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	rowsAffected, _ := res.RowsAffected()
+	if rowsAffected == 0 {
+		http.Error(w, "Setup has already been completed", http.StatusConflict)
+		return
+	}
+
+	id, _ := res.LastInsertId()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]int64{"user_id": id})
+}
+
+// SetPIN handles setting or changing the current user's quick-switch PIN.
+// The account password is required so an unattended terminal can't be used to change it.
+func (h *AuthHandler) SetPIN(w http.ResponseWriter, r *http.Request) {
+	u, ok := auth.UserFromContext(r.Context())
+	if !ok {
+		http.Error(w, "Authentication required", http.StatusUnauthorized)
+		return
+	}
+
+	var req struct {
+		Password string `json:"password"`
+		PIN      string `json:"pin"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if !validPIN(req.PIN) {
+		http.Error(w, "PIN must be 4 to 8 digits", http.StatusBadRequest)
+		return
+	}
+
+	var passwordHash string
+	if err := h.DB.QueryRow("SELECT password_hash FROM users WHERE id = ?", u.ID).Scan(&passwordHash); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if bcrypt.CompareHashAndPassword([]byte(passwordHash), []byte(req.Password)) != nil {
+		http.Error(w, "Invalid password", http.StatusUnauthorized)
+		return
+	}
+
+	pinHash, err := bcrypt.GenerateFromPassword([]byte(req.PIN), bcrypt.DefaultCost)
+	if err != nil {
+		http.Error(w, "Failed to hash PIN", http.StatusInternalServerError)
+		return
+	}
+
+	_, err = h.DB.Exec("UPDATE users SET pin_hash = ? WHERE id = ?", string(pinHash), u.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// SwitchCashier handles switching the active cashier on the current terminal
+// session using the incoming cashier's username and PIN. Sales created
+// afterwards are attributed to the new cashier.
+func (h *AuthHandler) SwitchCashier(w http.ResponseWriter, r *http.Request) {
+	sess, ok := auth.SessionFromContext(r.Context())
+	if !ok {
+		http.Error(w, "Authentication required", http.StatusUnauthorized)
+		return
+	}
+
+	var req struct {
+		Username string `json:"username"`
+		PIN      string `json:"pin"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.Username == "" || req.PIN == "" {
+		http.Error(w, "Username and PIN are required", http.StatusBadRequest)
+		return
+	}
+
+	// Wrong PINs lock out the terminal session, and the user on this session
+	// only, so one till can't lock a user out of every other
+	now := time.Now().UTC()
+	sessionKey, userKey := "pin:session:"+sess.ID, "pin:session:"+sess.ID+":user:"+req.Username
+	if locked, err := lockedOut(h.DB, now, sessionKey); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	} else if locked {
+		http.Error(w, "Too many wrong PINs on this terminal; try again later", http.StatusTooManyRequests)
+		return
+	}
+	if locked, err := lockedOut(h.DB, now, userKey); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	} else if locked {
+		http.Error(w, "Too many wrong PINs for this user; try again later", http.StatusTooManyRequests)
+		return
+	}
+
+	var u model.User
+	err := h.DB.QueryRow("SELECT id, store_id, username, pin_hash, role, is_active, created_at FROM users WHERE username = ?", req.Username).
+		Scan(&u.ID, &u.StoreID, &u.Username, &u.PINHash, &u.Role, &u.IsActive, &u.CreatedAt)
+	if err != nil && err != sql.ErrNoRows {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	found := err == nil
+
+	// Users without a PIN are checked against a dummy hash so they can't be told apart by timing
+	var pinHash *string
+	if found && u.IsActive {
+		pinHash = u.PINHash
+	}
+	if !secretMatches(pinHash, req.PIN) {
+		if err := recordFailure(h.DB, now, sessionKey, maxPINAttempts); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if err := recordFailure(h.DB, now, userKey, maxPINAttempts); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		http.Error(w, "Invalid username or PIN", http.StatusUnauthorized)
+		return
+	}
+	if u.StoreID != sess.StoreID && !auth.HasPermission(u.Role, auth.PermStoresAdmin) {
+		http.Error(w, "This user belongs to another store", http.StatusForbidden)
+		return
+	}
+
+	// A PIN is weaker than a password, so it can't raise the session above
+	// the user who logged in with one
+	var loginRole string
+	if err := h.DB.QueryRow("SELECT role FROM users WHERE id = ?", sess.UserID).Scan(&loginRole); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !auth.RoleIncludes(loginRole, u.Role) {
+		http.Error(w, "This user has permissions the terminal's login doesn't; log in with their password instead", http.StatusForbidden)
+		return
+	}
+
+	if err := clearFailures(h.DB, sessionKey, userKey); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := h.Sessions.SetActiveUser(sess.ID, u.ID); err != nil {
+		http.Error(w, "Failed to switch cashier", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(u)
+}
+
+func validPIN(pin string) bool {
+	if len(pin) < 4 || len(pin) > 8 {
+		return false
+	}
+	for _, c := range pin {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// currentUserID returns the ID of the authenticated user, or nil outside an authenticated request.
+func currentUserID(r *http.Request) *int {
+	if u, ok := auth.UserFromContext(r.Context()); ok {
+		return &u.ID
+	}
+	return nil
+}
+
+// currentTerminalID returns the enrolled terminal of the request's session, if any.
+func currentTerminalID(r *http.Request) *int {
+	if sess, ok := auth.SessionFromContext(r.Context()); ok {
+		return sess.TerminalID
+	}
+	return nil
+}
+
+// currentLocationID returns the location of the request's terminal session,
+// or the default location outside an authenticated request.
+func currentLocationID(r *http.Request) int {
+	if sess, ok := auth.SessionFromContext(r.Context()); ok {
+		return sess.LocationID
+	}
+	return database.DefaultLocationID
+}
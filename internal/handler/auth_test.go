@@ -0,0 +1,66 @@
+package handler_test
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestLoginLockout(t *testing.T) {
+	s := newTestServer(t)
+	s.addUser("cashier", "cashier")
+
+	wrong := map[string]string{"username": "cashier", "password": "wrong"}
+	for i := 0; i < 5; i++ {
+		s.call("", "POST", "/auth/login", wrong, http.StatusUnauthorized)
+	}
+	right := map[string]string{"username": "cashier", "password": "cashier-password"}
+	s.call("", "POST", "/auth/login", right, http.StatusTooManyRequests)
+
+	// Unknown usernames get the same answer as wrong passwords
+	s.call("", "POST", "/auth/login", map[string]string{"username": "nobody", "password": "wrong"}, http.StatusUnauthorized)
+
+	// Other users are unaffected
+	s.login("admin", "admin-password")
+}
+
+func TestSwitchCashier(t *testing.T) {
+	s := newTestServer(t)
+	s.addUser("manager", "manager")
+	s.addUser("cashier", "cashier")
+	s.addUser("other", "cashier")
+	s.call(s.login("manager", "manager-password"), "PUT", "/auth/pin", map[string]string{"password": "manager-password", "pin": "1111"}, http.StatusNoContent)
+	s.call(s.login("cashier", "cashier-password"), "PUT", "/auth/pin", map[string]string{"password": "cashier-password", "pin": "2222"}, http.StatusNoContent)
+
+	till := s.login("other", "other-password")
+	res := s.call(till, "POST", "/auth/pin", map[string]string{"username": "cashier", "pin": "2222"}, http.StatusOK)
+	if res["username"] != "cashier" {
+		t.Errorf("switched to %v, want cashier", res["username"])
+	}
+	if me := s.call(till, "GET", "/auth/me", nil, http.StatusOK); me["username"] != "cashier" {
+		t.Errorf("active user is %v, want cashier", me["username"])
+	}
+
+	// A PIN can't lift a cashier's till to a manager's permissions
+	s.call(till, "POST", "/auth/pin", map[string]string{"username": "manager", "pin": "1111"}, http.StatusForbidden)
+	if status, _ := s.request(till, "GET", "/reports/sales", nil); status != http.StatusForbidden {
+		t.Errorf("GET /reports/sales after a refused switch = %d, want 403", status)
+	}
+	// but a manager's till can switch down to a cashier
+	s.call(s.login("manager", "manager-password"), "POST", "/auth/pin", map[string]string{"username": "cashier", "pin": "2222"}, http.StatusOK)
+}
+
+func TestSwitchCashierLockout(t *testing.T) {
+	s := newTestServer(t)
+	s.addUser("cashier", "cashier")
+	s.addUser("other", "cashier")
+	s.call(s.login("cashier", "cashier-password"), "PUT", "/auth/pin", map[string]string{"password": "cashier-password", "pin": "2222"}, http.StatusNoContent)
+
+	till := s.login("other", "other-password")
+	for i := 0; i < 5; i++ {
+		s.call(till, "POST", "/auth/pin", map[string]string{"username": "cashier", "pin": "9999"}, http.StatusUnauthorized)
+	}
+	s.call(till, "POST", "/auth/pin", map[string]string{"username": "cashier", "pin": "2222"}, http.StatusTooManyRequests)
+
+	// The lockout is for that till only; the user can still switch in elsewhere
+	s.call(s.login("other", "other-password"), "POST", "/auth/pin", map[string]string{"username": "cashier", "pin": "2222"}, http.StatusOK)
+}
@@ -3,6 +3,7 @@ package handler
 import (
 	"database/sql"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"pos-app/internal/model"
 	"strconv"
@@ -14,9 +15,19 @@ type DiscountHandler struct {
 	DB *sql.DB
 }
 
-// GetDiscounts handles the request to get all discounts.
+// discountInScopeSQL matches discounts usable in a store: its own and the
+// shared ones. It takes the scope twice.
+const discountInScopeSQL = "(? IS NULL OR store_id IS NULL OR store_id = ?)"
+
+// GetDiscounts handles the request to get all discounts usable in scope.
 func (h *DiscountHandler) GetDiscounts(w http.ResponseWriter, r *http.Request) {
-	rows, err := h.DB.Query("SELECT id, code, description, discount_type, value, is_active, valid_from, valid_until, created_at FROM discounts")
+	scope, err := storeScope(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	rows, err := h.DB.Query("SELECT id, code, store_id, description, discount_type, value, is_active, valid_from, valid_until, created_at FROM discounts WHERE "+discountInScopeSQL, scope, scope)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -26,7 +37,7 @@ func (h *DiscountHandler) GetDiscounts(w http.ResponseWriter, r *http.Request) {
 	discounts := []model.Discount{}
 	for rows.Next() {
 		var d model.Discount
-		if err := rows.Scan(&d.ID, &d.Code, &d.Description, &d.DiscountType, &d.Value, &d.IsActive, &d.ValidFrom, &d.ValidUntil, &d.CreatedAt); err != nil {
+		if err := rows.Scan(&d.ID, &d.Code, &d.StoreID, &d.Description, &d.DiscountType, &d.Value, &d.IsActive, &d.ValidFrom, &d.ValidUntil, &d.CreatedAt); err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
@@ -37,21 +48,27 @@ func (h *DiscountHandler) GetDiscounts(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(discounts)
 }
 
-// CreateDiscount handles the request to create a new discount.
+// CreateDiscount handles the request to create a new discount. Users limited
+// to one store always create it for that store; others may pick a store_id or
+// leave it out to share the discount across every store.
 func (h *DiscountHandler) CreateDiscount(w http.ResponseWriter, r *http.Request) {
 	var d model.Discount
 	if err := json.NewDecoder(r.Body).Decode(&d); err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+	if status, msg := h.resolveStore(r, &d); status != 0 {
+		http.Error(w, msg, status)
+		return
+	}
 
-	stmt, err := h.DB.Prepare("INSERT INTO discounts(code, description, discount_type, value, is_active, valid_from, valid_until) VALUES(?, ?, ?, ?, ?, ?, ?)")
+	stmt, err := h.DB.Prepare("INSERT INTO discounts(code, store_id, description, discount_type, value, is_active, valid_from, valid_until) VALUES(?, ?, ?, ?, ?, ?, ?, ?)")
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	res, err := stmt.Exec(d.Code, d.Description, d.DiscountType, d.Value, d.IsActive, d.ValidFrom, d.ValidUntil)
+	res, err := stmt.Exec(d.Code, d.StoreID, d.Description, d.DiscountType, d.Value, d.IsActive, d.ValidFrom, d.ValidUntil)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -74,8 +91,14 @@ func (h *DiscountHandler) GetDiscount(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	scope, err := storeScope(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	var d model.Discount
-	err = h.DB.QueryRow("SELECT id, code, description, discount_type, value, is_active, valid_from, valid_until, created_at FROM discounts WHERE id = ?", id).Scan(&d.ID, &d.Code, &d.Description, &d.DiscountType, &d.Value, &d.IsActive, &d.ValidFrom, &d.ValidUntil, &d.CreatedAt)
+	err = h.DB.QueryRow("SELECT id, code, store_id, description, discount_type, value, is_active, valid_from, valid_until, created_at FROM discounts WHERE id = ? AND "+discountInScopeSQL, id, scope, scope).Scan(&d.ID, &d.Code, &d.StoreID, &d.Description, &d.DiscountType, &d.Value, &d.IsActive, &d.ValidFrom, &d.ValidUntil, &d.CreatedAt)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			http.Error(w, "Discount not found", http.StatusNotFound)
@@ -103,14 +126,22 @@ func (h *DiscountHandler) UpdateDiscount(w http.ResponseWriter, r *http.Request)
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+	if status, msg := h.checkWritable(r, id); status != 0 {
+		http.Error(w, msg, status)
+		return
+	}
+	if status, msg := h.resolveStore(r, &d); status != 0 {
+		http.Error(w, msg, status)
+		return
+	}
 
-	stmt, err := h.DB.Prepare("UPDATE discounts SET code = ?, description = ?, discount_type = ?, value = ?, is_active = ?, valid_from = ?, valid_until = ? WHERE id = ?")
+	stmt, err := h.DB.Prepare("UPDATE discounts SET code = ?, store_id = ?, description = ?, discount_type = ?, value = ?, is_active = ?, valid_from = ?, valid_until = ? WHERE id = ?")
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	_, err = stmt.Exec(d.Code, d.Description, d.DiscountType, d.Value, d.IsActive, d.ValidFrom, d.ValidUntil, id)
+	_, err = stmt.Exec(d.Code, d.StoreID, d.Description, d.DiscountType, d.Value, d.IsActive, d.ValidFrom, d.ValidUntil, id)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -129,6 +160,10 @@ func (h *DiscountHandler) DeleteDiscount(w http.ResponseWriter, r *http.Request)
 		http.Error(w, "Invalid discount ID", http.StatusBadRequest)
 		return
 	}
+	if status, msg := h.checkWritable(r, id); status != 0 {
+		http.Error(w, msg, status)
+		return
+	}
 
 	res, err := h.DB.Exec("DELETE FROM discounts WHERE id = ?", id)
 	if err != nil {
@@ -149,3 +184,52 @@ func (h *DiscountHandler) DeleteDiscount(w http.ResponseWriter, r *http.Request)
 
 	w.WriteHeader(http.StatusNoContent)
 }
+
+// resolveStore sets the store a discount being saved belongs to. Within a
+// store scope that is always the scoped store; otherwise d.StoreID is kept
+// (nil shares it) after checking the store exists.
+func (h *DiscountHandler) resolveStore(r *http.Request, d *model.Discount) (int, string) {
+	scope, err := storeScope(r)
+	if err != nil {
+		return http.StatusBadRequest, err.Error()
+	}
+	if scope != nil {
+		d.StoreID = scope
+		return 0, ""
+	}
+	if d.StoreID == nil {
+		return 0, ""
+	}
+	if status, _ := checkStore(h.DB, nil, "SELECT id FROM stores WHERE id = ?", *d.StoreID, ""); status != 0 {
+		return http.StatusBadRequest, fmt.Sprintf("Store with ID %d not found", *d.StoreID)
+	}
+	return 0, ""
+}
+
+// checkWritable returns a non-zero status and message unless the caller may
+// change the discount. Within a store scope only that store's own discounts
+// can be changed; shared ones are left to users who see every store.
+func (h *DiscountHandler) checkWritable(r *http.Request, id int) (int, string) {
+	scope, err := storeScope(r)
+	if err != nil {
+		return http.StatusBadRequest, err.Error()
+	}
+
+	var storeID *int
+	if err := h.DB.QueryRow("SELECT store_id FROM discounts WHERE id = ?", id).Scan(&storeID); err != nil {
+		if err == sql.ErrNoRows {
+			return http.StatusNotFound, "Discount not found"
+		}
+		return http.StatusInternalServerError, err.Error()
+	}
+	if scope == nil {
+		return 0, ""
+	}
+	if storeID == nil {
+		return http.StatusForbidden, "Shared discounts can only be changed by a stores admin"
+	}
+	if *storeID != *scope {
+		return http.StatusNotFound, "Discount not found"
+	}
+	return 0, ""
+}
@@ -0,0 +1,183 @@
+package handler_test
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"pos-app/internal/auth"
+	"pos-app/internal/database"
+	"pos-app/internal/events"
+	"pos-app/internal/handler"
+	"pos-app/internal/router"
+	"testing"
+	"time"
+)
+
+// testServer runs the full router, middleware included, against a fresh
+// database with a bootstrapped admin.
+type testServer struct {
+	*httptest.Server
+	t     *testing.T
+	db    *sql.DB
+	admin string // The admin's session token
+}
+
+func newTestServer(t *testing.T) *testServer {
+	t.Helper()
+	db := database.InitDB(filepath.Join(t.TempDir(), "pos.db"))
+	t.Cleanup(func() { db.Close() })
+
+	sessions := &auth.Sessions{DB: db, Secret: []byte("test secret"), TTL: time.Hour}
+	srv := httptest.NewServer(router.SetupRouter(db, sessions, &events.Bus{}, handler.DefaultVoidWindow))
+	t.Cleanup(srv.Close)
+
+	s := &testServer{Server: srv, t: t, db: db}
+	s.call("", "POST", "/auth/bootstrap", map[string]string{"username": "admin", "password": "admin-password"}, http.StatusCreated)
+	s.admin = s.login("admin", "admin-password")
+	return s
+}
+
+// request sends body as JSON with the session token and returns the
+// response status and body.
+func (s *testServer) request(token, method, path string, body any) (int, []byte) {
+	s.t.Helper()
+	var r io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			s.t.Fatal(err)
+		}
+		r = bytes.NewReader(b)
+	}
+	req, err := http.NewRequest(method, s.URL+"/api"+path, r)
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	defer res.Body.Close()
+	out, err := io.ReadAll(res.Body)
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	return res.StatusCode, out
+}
+
+// call is request for when the status is known; it fails the test on any
+// other and decodes the JSON response.
+func (s *testServer) call(token, method, path string, body any, want int) map[string]any {
+	s.t.Helper()
+	status, out := s.request(token, method, path, body)
+	if status != want {
+		s.t.Fatalf("%s %s = %d %s, want %d", method, path, status, bytes.TrimSpace(out), want)
+	}
+	var m map[string]any
+	json.Unmarshal(out, &m)
+	return m
+}
+
+func (s *testServer) login(username, password string) string {
+	s.t.Helper()
+	return s.loginAt(username, password, nil)
+}
+
+// loginAt logs in at a location, or the user's default one if it's nil.
+func (s *testServer) loginAt(username, password string, locationID *int) string {
+	s.t.Helper()
+	res := s.call("", "POST", "/auth/login", map[string]any{"username": username, "password": password, "location_id": locationID}, http.StatusOK)
+	return res["token"].(string)
+}
+
+// addUser creates a user with the role, whose password is their username
+// followed by "-password", and returns their ID.
+func (s *testServer) addUser(username, role string) int {
+	s.t.Helper()
+	res := s.call(s.admin, "POST", "/users/register", map[string]string{"username": username, "password": username + "-password", "role": role}, http.StatusCreated)
+	return int(res["user_id"].(float64))
+}
+
+// addProduct creates a product with stock at the default location and returns its ID.
+func (s *testServer) addProduct(sku string, price float64, quantity int) int {
+	s.t.Helper()
+	res := s.call(s.admin, "POST", "/products", map[string]any{"sku": sku, "name": sku, "price": price, "quantity": quantity}, http.StatusCreated)
+	return int(res["id"].(float64))
+}
+
+// openShift opens a shift on the drawer of the token's till.
+func (s *testServer) openShift(token string) int {
+	s.t.Helper()
+	res := s.call(token, "POST", "/shifts", map[string]any{"opening_float": 50}, http.StatusCreated)
+	return int(res["id"].(float64))
+}
+
+// sell rings up quantity of a product paid in cash and returns the sale's ID.
+func (s *testServer) sell(token string, productID, quantity int) int {
+	s.t.Helper()
+	res := s.call(token, "POST", "/sales", map[string]any{
+		"items":          []map[string]int{{"product_id": productID, "quantity": quantity}},
+		"payment_method": "cash",
+	}, http.StatusCreated)
+	return int(res["sale_id"].(float64))
+}
+
+// stock returns a product's quantity across the admin's locations.
+func (s *testServer) stock(productID int) int {
+	s.t.Helper()
+	res := s.call(s.admin, "GET", fmt.Sprintf("/products/%d", productID), nil, http.StatusOK)
+	return int(res["quantity"].(float64))
+}
+
+func TestPermissions(t *testing.T) {
+	s := newTestServer(t)
+	s.addUser("manager", "manager")
+	s.addUser("cashier", "cashier")
+	tokens := map[string]string{
+		"admin":   s.admin,
+		"manager": s.login("manager", "manager-password"),
+		"cashier": s.login("cashier", "cashier-password"),
+	}
+
+	tests := []struct {
+		method, path string
+		allowed      []string
+	}{
+		{"GET", "/products", []string{"admin", "manager", "cashier"}},
+		{"POST", "/products", []string{"admin", "manager"}},
+		{"POST", "/products/1/stock-adjustments", []string{"admin", "manager"}},
+		{"POST", "/sales/1/returns", []string{"admin", "manager"}},
+		{"DELETE", "/customers/1", []string{"admin", "manager"}},
+		{"POST", "/discounts", []string{"admin", "manager"}},
+		{"GET", "/reports/sales", []string{"admin", "manager"}},
+		{"GET", "/audit", []string{"admin", "manager"}},
+		{"POST", "/users/register", []string{"admin"}},
+		{"POST", "/stores", []string{"admin"}},
+		{"POST", "/payment-methods", []string{"admin"}},
+	}
+	for _, tt := range tests {
+		for role, token := range tokens {
+			status, _ := s.request(token, tt.method, tt.path, map[string]any{})
+			allowed := false
+			for _, r := range tt.allowed {
+				allowed = allowed || r == role
+			}
+			// Allowed requests may still fail validation, just not with a 403
+			if denied := status == http.StatusForbidden; denied == allowed {
+				t.Errorf("%s %s as %s = %d, want allowed %v", tt.method, tt.path, role, status, allowed)
+			}
+		}
+	}
+
+	if status, _ := s.request("", "GET", "/products", nil); status != http.StatusUnauthorized {
+		t.Errorf("GET /products without a token = %d, want 401", status)
+	}
+}
@@ -0,0 +1,409 @@
+package handler
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"pos-app/internal/auth"
+	"pos-app/internal/database"
+	"pos-app/internal/events"
+	"pos-app/internal/model"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// Held cart statuses
+const (
+	cartHeld      = "held"
+	cartCompleted = "completed"
+	cartDiscarded = "discarded"
+)
+
+type HeldCartHandler struct {
+	DB     *sql.DB
+	Events *events.Bus
+}
+
+type HoldCartRequest struct {
+	CustomerID    *int          `json:"customer_id"`
+	Items         []RequestItem `json:"items"`
+	DiscountCodes []string      `json:"discount_codes"`
+	Note          *string       `json:"note"` // e.g. who the cart belongs to
+}
+
+// RecallCartRequest pays for a held cart, the same way as CreateSaleRequest.
+type RecallCartRequest struct {
+	PaymentMethod string          `json:"payment_method"`
+	Payments      []TenderRequest `json:"payments"`
+}
+
+// heldCartView is a held cart with what it would cost if it were recalled now.
+type heldCartView struct {
+	*model.HeldCart
+	Quote *SaleQuote `json:"quote,omitempty"`
+}
+
+// heldCartStoreQuery looks up a held cart's store for checkStore.
+const heldCartStoreQuery = "SELECT store_id FROM held_carts WHERE id = ?"
+
+const heldCartColumns = "id, status, store_id, location_id, terminal_id, customer_id, note, held_by, held_at, closed_by, closed_at, sale_id"
+
+// GetHeldCarts handles listing held carts in scope. Only carts still on hold
+// are listed unless ?status= says otherwise; ?location_id= narrows it to one location.
+func (h *HeldCartHandler) GetHeldCarts(w http.ResponseWriter, r *http.Request) {
+	scope, err := storeScope(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	status := r.URL.Query().Get("status")
+	if status == "" {
+		status = cartHeld
+	}
+	query := "SELECT id FROM held_carts WHERE (? IS NULL OR store_id = ?) AND status = ?"
+	args := []any{scope, scope, status}
+	if locationID := r.URL.Query().Get("location_id"); locationID != "" {
+		query += " AND location_id = ?"
+		args = append(args, locationID)
+	}
+	query += " ORDER BY id DESC"
+
+	rows, err := h.DB.Query(query, args...)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	ids := []int{}
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+
+	// Carts are small, so each is loaded whole for the till to show its lines
+	carts := []model.HeldCart{}
+	for _, id := range ids {
+		c, err := loadHeldCart(h.DB, id)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		carts = append(carts, *c)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(carts)
+}
+
+// GetHeldCart handles getting a held cart with its items and discount codes.
+// A cart still on hold is also quoted at its location's current prices, with
+// each line's stock so shortfalls show before it is recalled.
+func (h *HeldCartHandler) GetHeldCart(w http.ResponseWriter, r *http.Request) {
+	id, ok := h.heldCartID(w, r)
+	if !ok {
+		return
+	}
+
+	c, err := loadHeldCart(h.DB, id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	view := heldCartView{HeldCart: c}
+	if c.Status == cartHeld {
+		items := []RequestItem{}
+		for _, item := range c.Items {
+			items = append(items, RequestItem{ProductID: item.ProductID, Quantity: item.Quantity})
+		}
+		// A cart with a product deleted since it was held goes unquoted; recalling it says which
+		quote, status, msg := quoteSale(h.DB, c.LocationID, c.StoreID, items, c.DiscountCodes)
+		switch status {
+		case 0:
+			view.Quote = quote
+		case http.StatusInternalServerError:
+			http.Error(w, msg, status)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(view)
+}
+
+// HoldCart handles parking a cart at the till. Nothing is priced and no stock
+// is taken until it is recalled.
+func (h *HeldCartHandler) HoldCart(w http.ResponseWriter, r *http.Request) {
+	var req HoldCartRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if len(req.Items) == 0 {
+		http.Error(w, "A held cart needs at least one item", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := h.DB.Begin()
+	if err != nil {
+		http.Error(w, "Failed to start transaction", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec("INSERT INTO held_carts(store_id, location_id, terminal_id, customer_id, note, held_by) VALUES(?, ?, ?, ?, ?, ?)",
+		currentStoreID(r), currentLocationID(r), currentTerminalID(r), req.CustomerID, req.Note, currentUserID(r))
+	if err != nil {
+		http.Error(w, "Failed to hold cart", http.StatusInternalServerError)
+		return
+	}
+	id64, _ := res.LastInsertId()
+	id := int(id64)
+
+	for _, item := range req.Items {
+		if item.Quantity <= 0 {
+			http.Error(w, "Quantities must be positive", http.StatusBadRequest)
+			return
+		}
+		var exists bool
+		if err := tx.QueryRow("SELECT EXISTS(SELECT 1 FROM products WHERE id = ?)", item.ProductID).Scan(&exists); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if !exists {
+			http.Error(w, fmt.Sprintf("Product with ID %d not found", item.ProductID), http.StatusBadRequest)
+			return
+		}
+		if _, err := tx.Exec("INSERT INTO held_cart_items(cart_id, product_id, quantity) VALUES(?, ?, ?)", id, item.ProductID, item.Quantity); err != nil {
+			http.Error(w, "Failed to hold cart item", http.StatusInternalServerError)
+			return
+		}
+	}
+	for _, code := range req.DiscountCodes {
+		if code = strings.TrimSpace(code); code == "" {
+			continue
+		}
+		if _, err := tx.Exec("INSERT INTO held_cart_discounts(cart_id, code) VALUES(?, ?)", id, code); err != nil {
+			http.Error(w, "Failed to hold discount code", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	c, err := loadHeldCart(tx, id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "Failed to commit transaction", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(c)
+}
+
+// RecallCart handles bringing a held cart back and paying for it. It goes
+// through the same pricing, stock and payment checks as CreateSale, at the
+// till it is recalled on, and the cart is closed with the sale it became.
+func (h *HeldCartHandler) RecallCart(w http.ResponseWriter, r *http.Request) {
+	id, ok := h.heldCartID(w, r)
+	if !ok {
+		return
+	}
+
+	var req RecallCartRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	user, ok := auth.UserFromContext(r.Context())
+	if !ok {
+		http.Error(w, "Authentication required", http.StatusUnauthorized)
+		return
+	}
+
+	tx, err := h.DB.Begin()
+	if err != nil {
+		http.Error(w, "Failed to start transaction", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	if status, msg := requireHeldCart(tx, id); status != 0 {
+		http.Error(w, msg, status)
+		return
+	}
+	c, err := loadHeldCart(tx, id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	sale := CreateSaleRequest{
+		CustomerID:    c.CustomerID,
+		PaymentMethod: req.PaymentMethod,
+		Payments:      req.Payments,
+		DiscountCodes: c.DiscountCodes,
+	}
+	for _, item := range c.Items {
+		sale.Items = append(sale.Items, RequestItem{ProductID: item.ProductID, Quantity: item.Quantity})
+	}
+
+	saleID, changeDue, stockResults, status, msg := recordSale(tx, r, user.ID, sale)
+	if status != 0 {
+		http.Error(w, msg, status)
+		return
+	}
+
+	now := time.Now().UTC().Format(database.TimeFormat)
+	if _, err := tx.Exec("UPDATE held_carts SET status = ?, closed_by = ?, closed_at = ?, sale_id = ? WHERE id = ?",
+		cartCompleted, user.ID, now, saleID, id); err != nil {
+		http.Error(w, "Failed to close held cart", http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "Failed to commit transaction", http.StatusInternalServerError)
+		return
+	}
+
+	publishLowStock(h.DB, h.Events, stockResults...)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]any{"sale_id": saleID, "change_due": changeDue, "held_cart_id": id})
+}
+
+// DiscardCart handles abandoning a held cart. It is kept, marked discarded.
+func (h *HeldCartHandler) DiscardCart(w http.ResponseWriter, r *http.Request) {
+	id, ok := h.heldCartID(w, r)
+	if !ok {
+		return
+	}
+
+	tx, err := h.DB.Begin()
+	if err != nil {
+		http.Error(w, "Failed to start transaction", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	if status, msg := requireHeldCart(tx, id); status != 0 {
+		http.Error(w, msg, status)
+		return
+	}
+
+	now := time.Now().UTC().Format(database.TimeFormat)
+	if _, err := tx.Exec("UPDATE held_carts SET status = ?, closed_by = ?, closed_at = ? WHERE id = ?",
+		cartDiscarded, currentUserID(r), now, id); err != nil {
+		http.Error(w, "Failed to discard held cart", http.StatusInternalServerError)
+		return
+	}
+
+	c, err := loadHeldCart(tx, id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "Failed to commit transaction", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(c)
+}
+
+// heldCartID parses the cart ID from the URL and checks it is in scope,
+// writing the error response if not.
+func (h *HeldCartHandler) heldCartID(w http.ResponseWriter, r *http.Request) (int, bool) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "Invalid held cart ID", http.StatusBadRequest)
+		return 0, false
+	}
+	scope, err := storeScope(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return 0, false
+	}
+	if status, msg := checkStore(h.DB, scope, heldCartStoreQuery, id, "Held cart not found"); status != 0 {
+		http.Error(w, msg, status)
+		return 0, false
+	}
+	return id, true
+}
+
+// requireHeldCart returns a non-zero status and message unless the cart exists and is still on hold.
+func requireHeldCart(q queryer, id int) (int, string) {
+	var status string
+	if err := q.QueryRow("SELECT status FROM held_carts WHERE id = ?", id).Scan(&status); err != nil {
+		if err == sql.ErrNoRows {
+			return http.StatusNotFound, "Held cart not found"
+		}
+		return http.StatusInternalServerError, err.Error()
+	}
+	if status != cartHeld {
+		return http.StatusConflict, fmt.Sprintf("Held cart is %s", status)
+	}
+	return 0, ""
+}
+
+// loadHeldCart fetches a held cart with its items and discount codes. It returns sql.ErrNoRows if it doesn't exist.
+func loadHeldCart(q queryer, id int) (*model.HeldCart, error) {
+	var c model.HeldCart
+	err := q.QueryRow("SELECT "+heldCartColumns+" FROM held_carts WHERE id = ?", id).
+		Scan(&c.ID, &c.Status, &c.StoreID, &c.LocationID, &c.TerminalID, &c.CustomerID, &c.Note,
+			&c.HeldBy, &c.HeldAt, &c.ClosedBy, &c.ClosedAt, &c.SaleID)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := q.Query("SELECT product_id, quantity FROM held_cart_items WHERE cart_id = ?", id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	c.Items = []model.HeldCartItem{}
+	for rows.Next() {
+		var item model.HeldCartItem
+		if err := rows.Scan(&item.ProductID, &item.Quantity); err != nil {
+			return nil, err
+		}
+		c.Items = append(c.Items, item)
+	}
+	rows.Close()
+
+	codes, err := q.Query("SELECT code FROM held_cart_discounts WHERE cart_id = ?", id)
+	if err != nil {
+		return nil, err
+	}
+	defer codes.Close()
+
+	c.DiscountCodes = []string{}
+	for codes.Next() {
+		var code string
+		if err := codes.Scan(&code); err != nil {
+			return nil, err
+		}
+		c.DiscountCodes = append(c.DiscountCodes, code)
+	}
+	return &c, codes.Err()
+}
@@ -0,0 +1,284 @@
+package handler
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"pos-app/internal/events"
+	"pos-app/internal/inventory"
+	"pos-app/internal/model"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+)
+
+type InventoryHandler struct {
+	DB     *sql.DB
+	Events *events.Bus
+}
+
+// StockReconciliation compares a product's stock on hand with the sum of its
+// ledger movements and with the stock held across its locations.
+type StockReconciliation struct {
+	ProductID     int    `json:"product_id"`
+	ProductName   string `json:"product_name"`
+	OnHand        int    `json:"on_hand"`
+	LedgerBalance int    `json:"ledger_balance"`
+	LocationTotal int    `json:"location_total"`
+	Discrepancy   int    `json:"discrepancy"`
+}
+
+// scopedStockSQL is a subquery summing a product's stock over the locations
+// of the stores in scope. It takes the scope twice as arguments.
+const scopedStockSQL = `(SELECT COALESCE(SUM(il.quantity), 0)
+	FROM inventory_locations il JOIN locations l ON l.id = il.location_id
+	WHERE il.product_id = p.id AND (? IS NULL OR l.store_id = ?))`
+
+// GetProductMovements handles listing a product's inventory movement history
+// at the locations in scope, newest first.
+func (h *InventoryHandler) GetProductMovements(w http.ResponseWriter, r *http.Request) {
+	idStr := chi.URLParam(r, "id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		http.Error(w, "Invalid product ID", http.StatusBadRequest)
+		return
+	}
+
+	scope, err := storeScope(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	rows, err := h.DB.Query(`
+		SELECT m.id, m.product_id, m.quantity_change, m.quantity_after, m.movement_type, m.reason, m.note, m.unit_cost,
+			m.location_id, m.user_id, u.username, m.reference_id, m.created_at
+		FROM inventory_movements m
+		LEFT JOIN users u ON u.id = m.user_id
+		WHERE m.product_id = ? AND (? IS NULL OR m.location_id IN (SELECT id FROM locations WHERE store_id = ?))
+		ORDER BY m.id DESC`, id, scope, scope)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	movements := []model.InventoryMovement{}
+	for rows.Next() {
+		var m model.InventoryMovement
+		if err := rows.Scan(&m.ID, &m.ProductID, &m.QuantityChange, &m.QuantityAfter, &m.MovementType, &m.Reason, &m.Note, &m.UnitCost,
+			&m.LocationID, &m.UserID, &m.Username, &m.ReferenceID, &m.CreatedAt); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		movements = append(movements, m)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(movements)
+}
+
+// LowStockItem is a product whose stock is at or below its reorder point.
+type LowStockItem struct {
+	ProductID       int    `json:"product_id"`
+	SKU             string `json:"sku"`
+	ProductName     string `json:"product_name"`
+	Quantity        int    `json:"quantity"`
+	ReorderPoint    int    `json:"reorder_point"`
+	ReorderQuantity *int   `json:"reorder_quantity"`
+}
+
+// GetLowStock handles listing products at or below their reorder point, emptiest
+// first. A store's own stock is compared with the reorder point; across all
+// stores, the total is.
+func (h *InventoryHandler) GetLowStock(w http.ResponseWriter, r *http.Request) {
+	scope, err := storeScope(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	rows, err := h.DB.Query(`
+		SELECT id, sku, name, quantity, reorder_point, reorder_quantity FROM (
+			SELECT p.id, p.sku, p.name, `+scopedStockSQL+` AS quantity, i.reorder_point, i.reorder_quantity
+			FROM inventory i
+			JOIN products p ON p.id = i.product_id
+			WHERE i.reorder_point IS NOT NULL
+		)
+		WHERE quantity <= reorder_point
+		ORDER BY quantity - reorder_point, name`, scope, scope)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	items := []LowStockItem{}
+	for rows.Next() {
+		var item LowStockItem
+		if err := rows.Scan(&item.ProductID, &item.SKU, &item.ProductName, &item.Quantity, &item.ReorderPoint, &item.ReorderQuantity); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		items = append(items, item)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(items)
+}
+
+// GetReconciliation handles checking every product's stock on hand against its ledger.
+// By default only products with a discrepancy are returned; pass ?all=true for every product.
+// Within a single store, stock on hand is the sum over the store's locations and
+// only movements at those locations count.
+func (h *InventoryHandler) GetReconciliation(w http.ResponseWriter, r *http.Request) {
+	scope, err := storeScope(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	rows, err := h.DB.Query(`
+		SELECT p.id, p.name,
+			CASE WHEN ? IS NULL THEN COALESCE(i.quantity, 0) ELSE `+scopedStockSQL+` END,
+			COALESCE((
+				SELECT SUM(m.quantity_change) FROM inventory_movements m
+				LEFT JOIN locations l ON l.id = m.location_id
+				WHERE m.product_id = p.id AND (? IS NULL OR l.store_id = ?)
+			), 0),
+			`+scopedStockSQL+`
+		FROM products p
+		LEFT JOIN inventory i ON i.product_id = p.id
+		ORDER BY p.id`, scope, scope, scope, scope, scope, scope, scope)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	all := r.URL.Query().Get("all") == "true"
+	results := []StockReconciliation{}
+	for rows.Next() {
+		var rec StockReconciliation
+		if err := rows.Scan(&rec.ProductID, &rec.ProductName, &rec.OnHand, &rec.LedgerBalance, &rec.LocationTotal); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		rec.Discrepancy = rec.OnHand - rec.LedgerBalance
+		if all || rec.Discrepancy != 0 || rec.LocationTotal != rec.OnHand {
+			results = append(results, rec)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(results)
+}
+
+type StockAdjustmentRequest struct {
+	Delta      int    `json:"delta"`
+	ReasonCode string `json:"reason_code"`
+	Note       string `json:"note"`
+	LocationID *int   `json:"location_id"` // Optional; defaults to the caller's location
+}
+
+// CreateStockAdjustment handles applying a signed stock delta to a single product.
+// Unlike UpdateProduct it never touches the catalog fields, and the delta is applied
+// relative to the current quantity so concurrent adjustments don't overwrite each other.
+func (h *InventoryHandler) CreateStockAdjustment(w http.ResponseWriter, r *http.Request) {
+	idStr := chi.URLParam(r, "id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		http.Error(w, "Invalid product ID", http.StatusBadRequest)
+		return
+	}
+
+	var req StockAdjustmentRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := inventory.ValidateAdjustment(req.ReasonCode, req.Delta); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	tx, err := h.DB.Begin()
+	if err != nil {
+		http.Error(w, "Failed to start transaction", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	scope, err := storeScope(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	locationID := currentLocationID(r)
+	if req.LocationID != nil {
+		locationID = *req.LocationID
+	}
+	if status, msg := requireActiveLocation(tx, scope, locationID); status != 0 {
+		http.Error(w, msg, status)
+		return
+	}
+
+	result, err := inventory.Record(tx, inventory.Movement{
+		ProductID:  id,
+		Change:     req.Delta,
+		Type:       inventory.TypeAdjustment,
+		Reason:     req.ReasonCode,
+		Note:       req.Note,
+		LocationID: locationID,
+		UserID:     currentUserID(r),
+	})
+	if err != nil {
+		if err == inventory.ErrNoInventory {
+			http.Error(w, "Product not found", http.StatusNotFound)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+	if result.LocationQuantityAfter < 0 {
+		http.Error(w, fmt.Sprintf("Adjustment would leave product ID %d with negative stock (%d) at location %d", id, result.LocationQuantityAfter, locationID), http.StatusConflict)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "Failed to commit transaction", http.StatusInternalServerError)
+		return
+	}
+
+	publishLowStock(h.DB, h.Events, result)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]int{
+		"product_id":        id,
+		"quantity":          result.QuantityAfter,
+		"location_id":       locationID,
+		"location_quantity": result.LocationQuantityAfter,
+	})
+}
+
+// publishLowStock emits a low-stock event for every movement that crossed its
+// product's reorder point. Call it only after the movements have been committed.
+func publishLowStock(db *sql.DB, bus *events.Bus, results ...inventory.Result) {
+	for _, res := range results {
+		if !res.CrossedReorderPoint() {
+			continue
+		}
+		e := events.LowStock{
+			ProductID:    res.ProductID,
+			Quantity:     res.QuantityAfter,
+			ReorderPoint: *res.ReorderPoint,
+		}
+		if res.ReorderQuantity != nil {
+			e.ReorderQuantity = *res.ReorderQuantity
+		}
+		db.QueryRow("SELECT sku, name FROM products WHERE id = ?", res.ProductID).Scan(&e.SKU, &e.Name)
+		bus.Publish(events.TypeLowStock, e)
+	}
+}
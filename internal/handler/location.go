@@ -0,0 +1,241 @@
+package handler
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"pos-app/internal/database"
+	"pos-app/internal/model"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+)
+
+type LocationHandler struct {
+	DB *sql.DB
+}
+
+// locationStoreQuery looks up the store of a location for checkStore.
+const locationStoreQuery = "SELECT store_id FROM locations WHERE id = ?"
+
+// GetLocations handles listing the stock locations in scope.
+func (h *LocationHandler) GetLocations(w http.ResponseWriter, r *http.Request) {
+	scope, err := storeScope(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	rows, err := h.DB.Query("SELECT id, store_id, name, is_active, created_at FROM locations WHERE ? IS NULL OR store_id = ? ORDER BY id", scope, scope)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	locations := []model.Location{}
+	for rows.Next() {
+		var l model.Location
+		if err := rows.Scan(&l.ID, &l.StoreID, &l.Name, &l.IsActive, &l.CreatedAt); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		locations = append(locations, l)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(locations)
+}
+
+// CreateLocation handles adding a new stock location. It goes in the caller's
+// store; only users who can see every store may pick another with store_id.
+func (h *LocationHandler) CreateLocation(w http.ResponseWriter, r *http.Request) {
+	var l model.Location
+	if err := json.NewDecoder(r.Body).Decode(&l); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	l.Name = strings.TrimSpace(l.Name)
+	if l.Name == "" {
+		http.Error(w, "Location name is required", http.StatusBadRequest)
+		return
+	}
+
+	scope, err := storeScope(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	switch {
+	case scope != nil:
+		l.StoreID = *scope
+	case l.StoreID == 0:
+		l.StoreID = currentStoreID(r)
+	}
+	if status, msg := checkStore(h.DB, nil, "SELECT id FROM stores WHERE id = ?", l.StoreID, fmt.Sprintf("Store with ID %d not found", l.StoreID)); status != 0 {
+		http.Error(w, msg, status)
+		return
+	}
+
+	res, err := h.DB.Exec("INSERT INTO locations(store_id, name) VALUES(?, ?)", l.StoreID, l.Name)
+	if err != nil {
+		http.Error(w, "Failed to create location; the name may already be in use", http.StatusConflict)
+		return
+	}
+	id, _ := res.LastInsertId()
+
+	h.DB.QueryRow("SELECT id, store_id, name, is_active, created_at FROM locations WHERE id = ?", id).Scan(&l.ID, &l.StoreID, &l.Name, &l.IsActive, &l.CreatedAt)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(l)
+}
+
+// UpdateLocation handles renaming a location or changing whether it is active.
+// A location can only be deactivated once it holds no stock.
+func (h *LocationHandler) UpdateLocation(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "Invalid location ID", http.StatusBadRequest)
+		return
+	}
+
+	var req struct {
+		Name     string `json:"name"`
+		IsActive *bool  `json:"is_active"` // Optional; omit to leave unchanged
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		http.Error(w, "Location name is required", http.StatusBadRequest)
+		return
+	}
+
+	scope, err := storeScope(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if status, msg := checkStore(h.DB, scope, locationStoreQuery, id, "Location not found"); status != 0 {
+		http.Error(w, msg, status)
+		return
+	}
+
+	var l model.Location
+	err = h.DB.QueryRow("SELECT id, store_id, name, is_active, created_at FROM locations WHERE id = ?", id).Scan(&l.ID, &l.StoreID, &l.Name, &l.IsActive, &l.CreatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Location not found", http.StatusNotFound)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	if req.IsActive != nil && !*req.IsActive && l.IsActive {
+		if id == database.DefaultLocationID {
+			http.Error(w, "The main location cannot be deactivated", http.StatusConflict)
+			return
+		}
+		var stock int
+		if err := h.DB.QueryRow("SELECT COALESCE(SUM(quantity), 0) FROM inventory_locations WHERE location_id = ?", id).Scan(&stock); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if stock != 0 {
+			http.Error(w, fmt.Sprintf("Location still holds %d units; transfer them out first", stock), http.StatusConflict)
+			return
+		}
+	}
+	if req.IsActive != nil {
+		l.IsActive = *req.IsActive
+	}
+	l.Name = req.Name
+
+	if _, err := h.DB.Exec("UPDATE locations SET name = ?, is_active = ? WHERE id = ?", l.Name, l.IsActive, id); err != nil {
+		http.Error(w, "Failed to update location; the name may already be in use", http.StatusConflict)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(l)
+}
+
+// GetLocationStock handles listing the stock held at a location.
+func (h *LocationHandler) GetLocationStock(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "Invalid location ID", http.StatusBadRequest)
+		return
+	}
+
+	scope, err := storeScope(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if status, msg := checkStore(h.DB, scope, locationStoreQuery, id, "Location not found"); status != 0 {
+		http.Error(w, msg, status)
+		return
+	}
+
+	var name string
+	if err := h.DB.QueryRow("SELECT name FROM locations WHERE id = ?", id).Scan(&name); err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Location not found", http.StatusNotFound)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	rows, err := h.DB.Query(`
+		SELECT p.id, p.name, il.quantity
+		FROM inventory_locations il
+		JOIN products p ON p.id = il.product_id
+		WHERE il.location_id = ?
+		ORDER BY p.name`, id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	stock := []model.LocationStock{}
+	for rows.Next() {
+		ls := model.LocationStock{LocationID: id, LocationName: name}
+		if err := rows.Scan(&ls.ProductID, &ls.ProductName, &ls.Quantity); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		stock = append(stock, ls)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(stock)
+}
+
+// requireActiveLocation returns a non-zero status and message unless the
+// location exists, is in scope and is active.
+func requireActiveLocation(q queryer, scope *int, id int) (int, string) {
+	var active bool
+	var storeID int
+	if err := q.QueryRow("SELECT is_active, store_id FROM locations WHERE id = ?", id).Scan(&active, &storeID); err != nil {
+		if err == sql.ErrNoRows {
+			return http.StatusBadRequest, fmt.Sprintf("Location with ID %d not found", id)
+		}
+		return http.StatusInternalServerError, err.Error()
+	}
+	if scope != nil && *scope != storeID {
+		return http.StatusBadRequest, fmt.Sprintf("Location with ID %d not found", id)
+	}
+	if !active {
+		return http.StatusBadRequest, fmt.Sprintf("Location with ID %d is inactive", id)
+	}
+	return 0, ""
+}
@@ -0,0 +1,144 @@
+package handler
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"pos-app/internal/model"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+)
+
+type PaymentMethodHandler struct {
+	DB *sql.DB
+}
+
+const paymentMethodColumns = "id, code, name, opens_drawer, allows_change, is_active, created_at"
+
+// GetPaymentMethods handles listing the payment method catalog, optionally only the active ones (?active=true).
+func (h *PaymentMethodHandler) GetPaymentMethods(w http.ResponseWriter, r *http.Request) {
+	activeOnly := r.URL.Query().Get("active") == "true"
+
+	rows, err := h.DB.Query("SELECT "+paymentMethodColumns+" FROM payment_methods WHERE ? = FALSE OR is_active = TRUE ORDER BY id", activeOnly)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	methods := []model.PaymentMethod{}
+	for rows.Next() {
+		var m model.PaymentMethod
+		if err := rows.Scan(&m.ID, &m.Code, &m.Name, &m.OpensDrawer, &m.AllowsChange, &m.IsActive, &m.CreatedAt); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		methods = append(methods, m)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(methods)
+}
+
+// CreatePaymentMethod handles adding a payment method. Codes are stored in
+// lower case, so "Cash" and "cash" can't both exist.
+func (h *PaymentMethodHandler) CreatePaymentMethod(w http.ResponseWriter, r *http.Request) {
+	var m model.PaymentMethod
+	if err := json.NewDecoder(r.Body).Decode(&m); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	m.Code = normalizeMethod(m.Code)
+	m.Name = strings.TrimSpace(m.Name)
+	if m.Code == "" || m.Name == "" {
+		http.Error(w, "Payment method code and name are required", http.StatusBadRequest)
+		return
+	}
+	if m.Code == splitMethod {
+		http.Error(w, fmt.Sprintf("%q is reserved for sales paid with several methods", splitMethod), http.StatusBadRequest)
+		return
+	}
+
+	res, err := h.DB.Exec("INSERT INTO payment_methods(code, name, opens_drawer, allows_change) VALUES(?, ?, ?, ?)",
+		m.Code, m.Name, m.OpensDrawer, m.AllowsChange)
+	if err != nil {
+		http.Error(w, "Failed to create payment method; the code may already be in use", http.StatusConflict)
+		return
+	}
+	id, _ := res.LastInsertId()
+
+	if err := h.DB.QueryRow("SELECT "+paymentMethodColumns+" FROM payment_methods WHERE id = ?", id).
+		Scan(&m.ID, &m.Code, &m.Name, &m.OpensDrawer, &m.AllowsChange, &m.IsActive, &m.CreatedAt); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(m)
+}
+
+// UpdatePaymentMethod handles changing a payment method's name, flags or
+// whether it is active. The code can't change, as past sales refer to it.
+func (h *PaymentMethodHandler) UpdatePaymentMethod(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "Invalid payment method ID", http.StatusBadRequest)
+		return
+	}
+
+	var req struct {
+		Name         string `json:"name"`
+		OpensDrawer  *bool  `json:"opens_drawer"` // Optional; omit to leave unchanged
+		AllowsChange *bool  `json:"allows_change"`
+		IsActive     *bool  `json:"is_active"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		http.Error(w, "Payment method name is required", http.StatusBadRequest)
+		return
+	}
+
+	var m model.PaymentMethod
+	err = h.DB.QueryRow("SELECT "+paymentMethodColumns+" FROM payment_methods WHERE id = ?", id).
+		Scan(&m.ID, &m.Code, &m.Name, &m.OpensDrawer, &m.AllowsChange, &m.IsActive, &m.CreatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Payment method not found", http.StatusNotFound)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+	m.Name = req.Name
+	if req.OpensDrawer != nil {
+		m.OpensDrawer = *req.OpensDrawer
+	}
+	if req.AllowsChange != nil {
+		m.AllowsChange = *req.AllowsChange
+	}
+	if req.IsActive != nil {
+		m.IsActive = *req.IsActive
+	}
+
+	if _, err := h.DB.Exec("UPDATE payment_methods SET name = ?, opens_drawer = ?, allows_change = ?, is_active = ? WHERE id = ?",
+		m.Name, m.OpensDrawer, m.AllowsChange, m.IsActive, id); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(m)
+}
+
+// normalizeMethod returns a payment method code in the form it is stored in.
+func normalizeMethod(code string) string {
+	return strings.ToLower(strings.TrimSpace(code))
+}
@@ -3,32 +3,49 @@ package handler
 import (
 	"database/sql"
 	"encoding/json"
+	"fmt"
 	"log"
 	"net/http"
+	"pos-app/internal/events"
+	"pos-app/internal/inventory"
 	"pos-app/internal/model"
+	"pos-app/internal/money"
 	"strconv"
 
 	"github.com/go-chi/chi/v5"
 )
 
 type ProductHandler struct {
-	DB *sql.DB
+	DB     *sql.DB
+	Events *events.Bus
 }
 
 // ProductWithStock is a temporary struct for API responses that include stock quantity.
+// Quantity is the total across the locations in scope; Locations and InTransit
+// are only filled in for a single product.
 type ProductWithStock struct {
 	model.Product
-	Quantity int `json:"quantity"`
+	Quantity        int                   `json:"quantity"`
+	ReorderPoint    *int                  `json:"reorder_point"`
+	ReorderQuantity *int                  `json:"reorder_quantity"`
+	Locations       []model.LocationStock `json:"locations,omitempty"`
+	InTransit       int                   `json:"in_transit"`
 }
 
 // GetProducts handles the request to get all products with their stock.
 func (h *ProductHandler) GetProducts(w http.ResponseWriter, r *http.Request) {
+	scope, err := storeScope(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	query := `
-		SELECT p.id, p.sku, p.name, p.description, p.price, p.created_at, i.quantity
+		SELECT p.id, p.sku, p.name, p.description, p.price, p.cost_price, p.created_at, ` + scopedStockSQL + `, i.reorder_point, i.reorder_quantity
 		FROM products p
 		LEFT JOIN inventory i ON p.id = i.product_id
 	`
-	rows, err := h.DB.Query(query)
+	rows, err := h.DB.Query(query, scope, scope)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -38,7 +55,7 @@ func (h *ProductHandler) GetProducts(w http.ResponseWriter, r *http.Request) {
 	products := []ProductWithStock{}
 	for rows.Next() {
 		var p ProductWithStock
-		if err := rows.Scan(&p.ID, &p.SKU, &p.Name, &p.Description, &p.Price, &p.CreatedAt, &p.Quantity); err != nil {
+		if err := rows.Scan(&p.ID, &p.SKU, &p.Name, &p.Description, &p.Price, &p.CostPrice, &p.CreatedAt, &p.Quantity, &p.ReorderPoint, &p.ReorderQuantity); err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
@@ -52,16 +69,23 @@ func (h *ProductHandler) GetProducts(w http.ResponseWriter, r *http.Request) {
 // CreateProduct handles the request to create a new product and its inventory.
 func (h *ProductHandler) CreateProduct(w http.ResponseWriter, r *http.Request) {
 	var req struct {
-		Name        string  `json:"name"`
-		SKU         string  `json:"sku"`
-		Description *string `json:"description"`
-		Price       float64 `json:"price"`
-		Quantity    int     `json:"quantity"`
+		Name            string      `json:"name"`
+		SKU             string      `json:"sku"`
+		Description     *string     `json:"description"`
+		Price           money.Money `json:"price"`
+		CostPrice       money.Money `json:"cost_price"`
+		Quantity        int         `json:"quantity"`
+		ReorderPoint    *int        `json:"reorder_point"`
+		ReorderQuantity *int        `json:"reorder_quantity"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+	if req.Quantity < 0 {
+		http.Error(w, "Quantity can't be negative", http.StatusBadRequest)
+		return
+	}
 
 	tx, err := h.DB.Begin()
 	if err != nil {
@@ -70,7 +94,7 @@ func (h *ProductHandler) CreateProduct(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Insert into products table
-	productStmt, err := tx.Prepare("INSERT INTO products(name, sku, description, price) VALUES(?, ?, ?, ?)")
+	productStmt, err := tx.Prepare("INSERT INTO products(name, sku, description, price, cost_price) VALUES(?, ?, ?, ?, ?)")
 	if err != nil {
 		tx.Rollback()
 		http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -78,7 +102,7 @@ func (h *ProductHandler) CreateProduct(w http.ResponseWriter, r *http.Request) {
 	}
 	defer productStmt.Close()
 
-	res, err := productStmt.Exec(req.Name, req.SKU, req.Description, req.Price)
+	res, err := productStmt.Exec(req.Name, req.SKU, req.Description, req.Price, req.CostPrice)
 	if err != nil {
 		tx.Rollback()
 		http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -86,20 +110,29 @@ func (h *ProductHandler) CreateProduct(w http.ResponseWriter, r *http.Request) {
 	}
 	productID, _ := res.LastInsertId()
 
-	// Insert into inventory table
-	invStmt, err := tx.Prepare("INSERT INTO inventory(product_id, quantity) VALUES(?, ?)")
+	// Insert into inventory table; the initial stock goes through the ledger
+	_, err = tx.Exec("INSERT INTO inventory(product_id, quantity, reorder_point, reorder_quantity) VALUES(?, 0, ?, ?)",
+		productID, req.ReorderPoint, req.ReorderQuantity)
 	if err != nil {
 		tx.Rollback()
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	defer invStmt.Close()
 
-	_, err = invStmt.Exec(productID, req.Quantity)
-	if err != nil {
-		tx.Rollback()
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+	if req.Quantity != 0 {
+		_, err = inventory.Record(tx, inventory.Movement{
+			ProductID:  int(productID),
+			Change:     req.Quantity,
+			Type:       inventory.TypeAdjustment,
+			Reason:     "initial stock",
+			LocationID: currentLocationID(r),
+			UserID:     currentUserID(r),
+		})
+		if err != nil {
+			tx.Rollback()
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
 	}
 
 	if err := tx.Commit(); err != nil {
@@ -107,8 +140,20 @@ func (h *ProductHandler) CreateProduct(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	w.WriteHeader(http.StatusCreated)
 	log.Printf("Product created with ID: %d", productID)
+
+	p := ProductWithStock{Quantity: req.Quantity, ReorderPoint: req.ReorderPoint, ReorderQuantity: req.ReorderQuantity}
+	p.ID = int(productID)
+	p.SKU = req.SKU
+	p.Name = req.Name
+	p.Description = req.Description
+	p.Price = req.Price
+	p.CostPrice = req.CostPrice
+	h.DB.QueryRow("SELECT created_at FROM products WHERE id = ?", productID).Scan(&p.CreatedAt)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(p)
 }
 
 // GetProduct handles the request to get a single product by ID with its stock.
@@ -120,14 +165,20 @@ func (h *ProductHandler) GetProduct(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	scope, err := storeScope(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	query := `
-		SELECT p.id, p.sku, p.name, p.description, p.price, p.created_at, i.quantity
+		SELECT p.id, p.sku, p.name, p.description, p.price, p.cost_price, p.created_at, ` + scopedStockSQL + `, i.reorder_point, i.reorder_quantity
 		FROM products p
 		LEFT JOIN inventory i ON p.id = i.product_id
 		WHERE p.id = ?
 	`
 	var p ProductWithStock
-	err = h.DB.QueryRow(query, id).Scan(&p.ID, &p.SKU, &p.Name, &p.Description, &p.Price, &p.CreatedAt, &p.Quantity)
+	err = h.DB.QueryRow(query, scope, scope, id).Scan(&p.ID, &p.SKU, &p.Name, &p.Description, &p.Price, &p.CostPrice, &p.CreatedAt, &p.Quantity, &p.ReorderPoint, &p.ReorderQuantity)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			http.Error(w, "Product not found", http.StatusNotFound)
@@ -137,11 +188,44 @@ func (h *ProductHandler) GetProduct(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	rows, err := h.DB.Query(`
+		SELECT il.location_id, l.name, il.quantity
+		FROM inventory_locations il
+		JOIN locations l ON l.id = il.location_id
+		WHERE il.product_id = ? AND (? IS NULL OR l.store_id = ?)
+		ORDER BY il.location_id`, id, scope, scope)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		ls := model.LocationStock{ProductID: id}
+		if err := rows.Scan(&ls.LocationID, &ls.LocationName, &ls.Quantity); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		p.Locations = append(p.Locations, ls)
+	}
+
+	err = h.DB.QueryRow(`
+		SELECT COALESCE(SUM(ti.quantity), 0)
+		FROM stock_transfer_items ti
+		JOIN stock_transfers t ON t.id = ti.transfer_id
+		WHERE ti.product_id = ? AND t.status = ? AND `+transferInScopeSQL, id, transferInTransit, scope, scope).Scan(&p.InTransit)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(p)
 }
 
-// UpdateProduct handles the request to update a product and its stock.
+// UpdateProduct handles the request to update a product and, if quantity is
+// given, its stock. Prefer stock adjustments for stock changes: this overwrites
+// the quantity in scope with whatever the client last saw, booking the
+// difference at the caller's location.
 func (h *ProductHandler) UpdateProduct(w http.ResponseWriter, r *http.Request) {
 	idStr := chi.URLParam(r, "id")
 	id, err := strconv.Atoi(idStr)
@@ -151,11 +235,15 @@ func (h *ProductHandler) UpdateProduct(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var req struct {
-		Name        string  `json:"name"`
-		SKU         string  `json:"sku"`
-		Description *string `json:"description"`
-		Price       float64 `json:"price"`
-		Quantity    int     `json:"quantity"`
+		Name        string       `json:"name"`
+		SKU         string       `json:"sku"`
+		Description *string      `json:"description"`
+		Price       money.Money  `json:"price"`
+		CostPrice   *money.Money `json:"cost_price"` // Optional; omit to leave the cost untouched
+		Quantity    *int         `json:"quantity"`   // Optional; omit to leave stock untouched
+		// Optional; omit to leave the reorder settings untouched
+		ReorderPoint    *int `json:"reorder_point"`
+		ReorderQuantity *int `json:"reorder_quantity"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
@@ -177,13 +265,73 @@ func (h *ProductHandler) UpdateProduct(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Update inventory table
-	_, err = tx.Exec("UPDATE inventory SET quantity = ?, last_updated = CURRENT_TIMESTAMP WHERE product_id = ?",
-		req.Quantity, id)
-	if err != nil {
-		tx.Rollback()
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+	if req.CostPrice != nil {
+		if _, err := tx.Exec("UPDATE products SET cost_price = ? WHERE id = ?", *req.CostPrice, id); err != nil {
+			tx.Rollback()
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if req.ReorderPoint != nil {
+		if _, err := tx.Exec("UPDATE inventory SET reorder_point = ? WHERE product_id = ?", *req.ReorderPoint, id); err != nil {
+			tx.Rollback()
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	if req.ReorderQuantity != nil {
+		if _, err := tx.Exec("UPDATE inventory SET reorder_quantity = ? WHERE product_id = ?", *req.ReorderQuantity, id); err != nil {
+			tx.Rollback()
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	// Update stock at the caller's location through the ledger, recording the
+	// difference as an adjustment
+	var stockResult inventory.Result
+	if req.Quantity != nil {
+		if *req.Quantity < 0 {
+			tx.Rollback()
+			http.Error(w, "Quantity can't be negative", http.StatusBadRequest)
+			return
+		}
+		locationID := currentLocationID(r)
+		var current int
+		err = tx.QueryRow(`
+			SELECT COALESCE((SELECT il.quantity FROM inventory_locations il WHERE il.product_id = i.product_id AND il.location_id = ?), 0)
+			FROM inventory i WHERE i.product_id = ?`, locationID, id).Scan(&current)
+		if err != nil {
+			tx.Rollback()
+			if err == sql.ErrNoRows {
+				http.Error(w, "Product not found", http.StatusNotFound)
+			} else {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+			}
+			return
+		}
+
+		if *req.Quantity != current {
+			stockResult, err = inventory.Record(tx, inventory.Movement{
+				ProductID:  id,
+				Change:     *req.Quantity - current,
+				Type:       inventory.TypeAdjustment,
+				Reason:     "product edit",
+				LocationID: locationID,
+				UserID:     currentUserID(r),
+			})
+			if err != nil {
+				tx.Rollback()
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			if stockResult.LocationQuantityAfter < 0 {
+				tx.Rollback()
+				http.Error(w, fmt.Sprintf("Edit would leave product ID %d with negative stock (%d) at location %d", id, stockResult.LocationQuantityAfter, locationID), http.StatusConflict)
+				return
+			}
+		}
 	}
 
 	if err := tx.Commit(); err != nil {
@@ -191,6 +339,8 @@ func (h *ProductHandler) UpdateProduct(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	publishLowStock(h.DB, h.Events, stockResult)
+
 	w.WriteHeader(http.StatusOK)
 }
 
@@ -217,6 +367,12 @@ func (h *ProductHandler) DeleteProduct(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	_, err = tx.Exec("DELETE FROM inventory_locations WHERE product_id = ?", id)
+	if err != nil {
+		tx.Rollback()
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
 
 	res, err := tx.Exec("DELETE FROM products WHERE id = ?", id)
 	if err != nil {
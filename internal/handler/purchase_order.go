@@ -0,0 +1,568 @@
+package handler
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"pos-app/internal/inventory"
+	"pos-app/internal/model"
+	"pos-app/internal/money"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// Purchase order statuses
+const (
+	poDraft             = "draft"
+	poSent              = "sent"
+	poPartiallyReceived = "partially_received"
+	poReceived          = "received"
+	poCancelled         = "cancelled"
+)
+
+type PurchaseOrderHandler struct {
+	DB *sql.DB
+}
+
+type PurchaseOrderRequest struct {
+	SupplierID int                        `json:"supplier_id"`
+	Notes      *string                    `json:"notes"`
+	Items      []PurchaseOrderItemRequest `json:"items"`
+}
+
+type PurchaseOrderItemRequest struct {
+	ProductID int         `json:"product_id"`
+	Quantity  int         `json:"quantity"`
+	UnitCost  money.Money `json:"unit_cost"`
+}
+
+type ReceiveRequest struct {
+	Items      []ReceiveItemRequest `json:"items"`
+	Note       string               `json:"note"`
+	LocationID *int                 `json:"location_id"` // Optional; defaults to the caller's location
+}
+
+type ReceiveItemRequest struct {
+	ProductID int          `json:"product_id"`
+	Quantity  int          `json:"quantity"`
+	UnitCost  *money.Money `json:"unit_cost"` // Cost actually paid; defaults to the ordered unit cost
+}
+
+// purchaseOrderStoreQuery looks up the store of a purchase order for checkStore.
+const purchaseOrderStoreQuery = "SELECT store_id FROM purchase_orders WHERE id = ?"
+
+// queryer is satisfied by both *sql.DB and *sql.Tx.
+type queryer interface {
+	Query(query string, args ...any) (*sql.Rows, error)
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+// GetPurchaseOrders handles listing purchase orders in scope, optionally filtered by status and supplier_id.
+func (h *PurchaseOrderHandler) GetPurchaseOrders(w http.ResponseWriter, r *http.Request) {
+	scope, err := storeScope(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	query := "SELECT id, supplier_id, store_id, status, notes, created_by, created_at, sent_at, received_at, cancelled_at FROM purchase_orders WHERE (? IS NULL OR store_id = ?)"
+	args := []any{scope, scope}
+	if status := r.URL.Query().Get("status"); status != "" {
+		query += " AND status = ?"
+		args = append(args, status)
+	}
+	if supplierID := r.URL.Query().Get("supplier_id"); supplierID != "" {
+		query += " AND supplier_id = ?"
+		args = append(args, supplierID)
+	}
+	query += " ORDER BY id DESC"
+
+	rows, err := h.DB.Query(query, args...)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	orders := []model.PurchaseOrder{}
+	for rows.Next() {
+		var po model.PurchaseOrder
+		if err := rows.Scan(&po.ID, &po.SupplierID, &po.StoreID, &po.Status, &po.Notes, &po.CreatedBy, &po.CreatedAt, &po.SentAt, &po.ReceivedAt, &po.CancelledAt); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		orders = append(orders, po)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(orders)
+}
+
+// GetPurchaseOrder handles getting a single purchase order with its items.
+func (h *PurchaseOrderHandler) GetPurchaseOrder(w http.ResponseWriter, r *http.Request) {
+	idStr := chi.URLParam(r, "id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		http.Error(w, "Invalid purchase order ID", http.StatusBadRequest)
+		return
+	}
+
+	scope, err := storeScope(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if status, msg := checkStore(h.DB, scope, purchaseOrderStoreQuery, id, "Purchase order not found"); status != 0 {
+		http.Error(w, msg, status)
+		return
+	}
+
+	po, err := loadPurchaseOrder(h.DB, id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Purchase order not found", http.StatusNotFound)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(po)
+}
+
+// CreatePurchaseOrder handles creating a new draft purchase order for the caller's store.
+func (h *PurchaseOrderHandler) CreatePurchaseOrder(w http.ResponseWriter, r *http.Request) {
+	var req PurchaseOrderRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	storeID := currentStoreID(r)
+	if scope, err := storeScope(r); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	} else if scope != nil {
+		storeID = *scope
+	}
+
+	tx, err := h.DB.Begin()
+	if err != nil {
+		http.Error(w, "Failed to start transaction", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	if status, msg := validatePurchaseOrder(tx, req); status != 0 {
+		http.Error(w, msg, status)
+		return
+	}
+
+	res, err := tx.Exec("INSERT INTO purchase_orders(supplier_id, store_id, status, notes, created_by) VALUES(?, ?, ?, ?, ?)",
+		req.SupplierID, storeID, poDraft, req.Notes, currentUserID(r))
+	if err != nil {
+		http.Error(w, "Failed to create purchase order", http.StatusInternalServerError)
+		return
+	}
+	id, _ := res.LastInsertId()
+
+	if err := insertPurchaseOrderItems(tx, int(id), req.Items); err != nil {
+		http.Error(w, "Failed to insert purchase order items", http.StatusInternalServerError)
+		return
+	}
+
+	po, err := loadPurchaseOrder(tx, int(id))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "Failed to commit transaction", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(po)
+}
+
+// UpdatePurchaseOrder handles replacing the supplier, notes and items of a draft purchase order.
+func (h *PurchaseOrderHandler) UpdatePurchaseOrder(w http.ResponseWriter, r *http.Request) {
+	idStr := chi.URLParam(r, "id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		http.Error(w, "Invalid purchase order ID", http.StatusBadRequest)
+		return
+	}
+
+	var req PurchaseOrderRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := h.DB.Begin()
+	if err != nil {
+		http.Error(w, "Failed to start transaction", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	scope, err := storeScope(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if status, msg := checkStore(tx, scope, purchaseOrderStoreQuery, id, "Purchase order not found"); status != 0 {
+		http.Error(w, msg, status)
+		return
+	}
+
+	var status string
+	if err := tx.QueryRow("SELECT status FROM purchase_orders WHERE id = ?", id).Scan(&status); err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Purchase order not found", http.StatusNotFound)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+	if status != poDraft {
+		http.Error(w, fmt.Sprintf("Only draft purchase orders can be edited (status is %s)", status), http.StatusConflict)
+		return
+	}
+
+	if status, msg := validatePurchaseOrder(tx, req); status != 0 {
+		http.Error(w, msg, status)
+		return
+	}
+
+	if _, err := tx.Exec("UPDATE purchase_orders SET supplier_id = ?, notes = ? WHERE id = ?", req.SupplierID, req.Notes, id); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if _, err := tx.Exec("DELETE FROM purchase_order_items WHERE purchase_order_id = ?", id); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := insertPurchaseOrderItems(tx, id, req.Items); err != nil {
+		http.Error(w, "Failed to insert purchase order items", http.StatusInternalServerError)
+		return
+	}
+
+	po, err := loadPurchaseOrder(tx, id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "Failed to commit transaction", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(po)
+}
+
+// SendPurchaseOrder handles marking a draft purchase order as sent to the supplier.
+func (h *PurchaseOrderHandler) SendPurchaseOrder(w http.ResponseWriter, r *http.Request) {
+	h.transition(w, r, "UPDATE purchase_orders SET status = ?, sent_at = CURRENT_TIMESTAMP WHERE id = ? AND status = ?",
+		poSent, poDraft)
+}
+
+// CancelPurchaseOrder handles cancelling a purchase order. Partially received
+// orders can be cancelled to close them short; stock already received stays.
+func (h *PurchaseOrderHandler) CancelPurchaseOrder(w http.ResponseWriter, r *http.Request) {
+	h.transition(w, r, "UPDATE purchase_orders SET status = ?, cancelled_at = CURRENT_TIMESTAMP WHERE id = ? AND status IN (?, ?, ?)",
+		poCancelled, poDraft, poSent, poPartiallyReceived)
+}
+
+// transition runs a guarded status update of the form
+// "UPDATE ... SET status = ? ... WHERE id = ? AND status ..." and reports the outcome.
+func (h *PurchaseOrderHandler) transition(w http.ResponseWriter, r *http.Request, query, newStatus string, fromStatuses ...string) {
+	idStr := chi.URLParam(r, "id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		http.Error(w, "Invalid purchase order ID", http.StatusBadRequest)
+		return
+	}
+
+	scope, err := storeScope(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if status, msg := checkStore(h.DB, scope, purchaseOrderStoreQuery, id, "Purchase order not found"); status != 0 {
+		http.Error(w, msg, status)
+		return
+	}
+
+	args := []any{newStatus, id}
+	for _, s := range fromStatuses {
+		args = append(args, s)
+	}
+	res, err := h.DB.Exec(query, args...)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if rowsAffected, _ := res.RowsAffected(); rowsAffected == 0 {
+		var status string
+		if err := h.DB.QueryRow("SELECT status FROM purchase_orders WHERE id = ?", id).Scan(&status); err != nil {
+			if err == sql.ErrNoRows {
+				http.Error(w, "Purchase order not found", http.StatusNotFound)
+			} else {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+			}
+			return
+		}
+		http.Error(w, fmt.Sprintf("Cannot change purchase order from %s to %s", status, newStatus), http.StatusConflict)
+		return
+	}
+
+	po, err := loadPurchaseOrder(h.DB, id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(po)
+}
+
+// ReceivePurchaseOrder handles receiving goods against a sent purchase order.
+// Each received line is added to stock through a 'receive' inventory movement
+// that records the unit cost paid.
+func (h *PurchaseOrderHandler) ReceivePurchaseOrder(w http.ResponseWriter, r *http.Request) {
+	idStr := chi.URLParam(r, "id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		http.Error(w, "Invalid purchase order ID", http.StatusBadRequest)
+		return
+	}
+
+	var req ReceiveRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if len(req.Items) == 0 {
+		http.Error(w, "At least one item must be received", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := h.DB.Begin()
+	if err != nil {
+		http.Error(w, "Failed to start transaction", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	scope, err := storeScope(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if status, msg := checkStore(tx, scope, purchaseOrderStoreQuery, id, "Purchase order not found"); status != 0 {
+		http.Error(w, msg, status)
+		return
+	}
+
+	po, err := loadPurchaseOrder(tx, id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Purchase order not found", http.StatusNotFound)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+	if po.Status != poSent && po.Status != poPartiallyReceived {
+		http.Error(w, fmt.Sprintf("Cannot receive against a purchase order that is %s", po.Status), http.StatusConflict)
+		return
+	}
+
+	// Goods are received into a location of the store that ordered them
+	locationID := currentLocationID(r)
+	if req.LocationID != nil {
+		locationID = *req.LocationID
+	}
+	if status, msg := requireActiveLocation(tx, &po.StoreID, locationID); status != 0 {
+		http.Error(w, msg, status)
+		return
+	}
+
+	itemsByProduct := map[int]*model.PurchaseOrderItem{}
+	for i := range po.Items {
+		itemsByProduct[po.Items[i].ProductID] = &po.Items[i]
+	}
+
+	for _, line := range req.Items {
+		item, ok := itemsByProduct[line.ProductID]
+		if !ok {
+			http.Error(w, fmt.Sprintf("Product ID %d is not on this purchase order", line.ProductID), http.StatusBadRequest)
+			return
+		}
+		if line.Quantity <= 0 {
+			http.Error(w, fmt.Sprintf("Received quantity for product ID %d must be positive", line.ProductID), http.StatusBadRequest)
+			return
+		}
+		outstanding := item.QuantityOrdered - item.QuantityReceived
+		if line.Quantity > outstanding {
+			http.Error(w, fmt.Sprintf("Cannot receive %d of product ID %d; only %d outstanding", line.Quantity, line.ProductID, outstanding), http.StatusConflict)
+			return
+		}
+
+		unitCost := item.UnitCost
+		if line.UnitCost != nil {
+			if *line.UnitCost < 0 {
+				http.Error(w, "Unit cost cannot be negative", http.StatusBadRequest)
+				return
+			}
+			unitCost = *line.UnitCost
+		}
+
+		if _, err := tx.Exec("UPDATE purchase_order_items SET quantity_received = quantity_received + ? WHERE id = ?", line.Quantity, item.ID); err != nil {
+			http.Error(w, "Failed to update purchase order item", http.StatusInternalServerError)
+			return
+		}
+		item.QuantityReceived += line.Quantity
+
+		_, err := inventory.Record(tx, inventory.Movement{
+			ProductID:   line.ProductID,
+			Change:      line.Quantity,
+			Type:        inventory.TypeReceive,
+			Reason:      "purchase order",
+			Note:        req.Note,
+			UnitCost:    &unitCost,
+			LocationID:  locationID,
+			UserID:      currentUserID(r),
+			ReferenceID: &po.ID,
+		})
+		if err != nil {
+			if err == inventory.ErrNoInventory {
+				http.Error(w, fmt.Sprintf("Product ID %d no longer exists", line.ProductID), http.StatusConflict)
+			} else {
+				http.Error(w, "Failed to update inventory", http.StatusInternalServerError)
+			}
+			return
+		}
+
+		// The latest cost paid becomes the product's cost price for margin reporting
+		if _, err := tx.Exec("UPDATE products SET cost_price = ? WHERE id = ?", unitCost, line.ProductID); err != nil {
+			http.Error(w, "Failed to update product cost", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	newStatus := poReceived
+	for _, item := range po.Items {
+		if item.QuantityReceived < item.QuantityOrdered {
+			newStatus = poPartiallyReceived
+			break
+		}
+	}
+	if newStatus == poReceived {
+		_, err = tx.Exec("UPDATE purchase_orders SET status = ?, received_at = CURRENT_TIMESTAMP WHERE id = ?", newStatus, id)
+	} else {
+		_, err = tx.Exec("UPDATE purchase_orders SET status = ? WHERE id = ?", newStatus, id)
+	}
+	if err != nil {
+		http.Error(w, "Failed to update purchase order status", http.StatusInternalServerError)
+		return
+	}
+
+	po, err = loadPurchaseOrder(tx, id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "Failed to commit transaction", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(po)
+}
+
+// validatePurchaseOrder checks the supplier and items of a create or update request.
+// It returns a non-zero status and message when the request is invalid.
+func validatePurchaseOrder(q queryer, req PurchaseOrderRequest) (int, string) {
+	var exists bool
+	if err := q.QueryRow("SELECT EXISTS (SELECT 1 FROM suppliers WHERE id = ?)", req.SupplierID).Scan(&exists); err != nil {
+		return http.StatusInternalServerError, err.Error()
+	}
+	if !exists {
+		return http.StatusBadRequest, fmt.Sprintf("Supplier with ID %d not found", req.SupplierID)
+	}
+
+	if len(req.Items) == 0 {
+		return http.StatusBadRequest, "A purchase order needs at least one item"
+	}
+	seen := map[int]bool{}
+	for _, item := range req.Items {
+		if seen[item.ProductID] {
+			return http.StatusBadRequest, fmt.Sprintf("Product ID %d is listed more than once", item.ProductID)
+		}
+		seen[item.ProductID] = true
+
+		if item.Quantity <= 0 {
+			return http.StatusBadRequest, fmt.Sprintf("Quantity for product ID %d must be positive", item.ProductID)
+		}
+		if item.UnitCost < 0 {
+			return http.StatusBadRequest, fmt.Sprintf("Unit cost for product ID %d cannot be negative", item.ProductID)
+		}
+		if err := q.QueryRow("SELECT EXISTS (SELECT 1 FROM products WHERE id = ?)", item.ProductID).Scan(&exists); err != nil {
+			return http.StatusInternalServerError, err.Error()
+		}
+		if !exists {
+			return http.StatusBadRequest, fmt.Sprintf("Product with ID %d not found", item.ProductID)
+		}
+	}
+	return 0, ""
+}
+
+func insertPurchaseOrderItems(tx *sql.Tx, purchaseOrderID int, items []PurchaseOrderItemRequest) error {
+	for _, item := range items {
+		_, err := tx.Exec("INSERT INTO purchase_order_items(purchase_order_id, product_id, quantity_ordered, unit_cost) VALUES(?, ?, ?, ?)",
+			purchaseOrderID, item.ProductID, item.Quantity, item.UnitCost)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loadPurchaseOrder fetches a purchase order with its items. It returns sql.ErrNoRows if it doesn't exist.
+func loadPurchaseOrder(q queryer, id int) (*model.PurchaseOrder, error) {
+	var po model.PurchaseOrder
+	err := q.QueryRow("SELECT id, supplier_id, store_id, status, notes, created_by, created_at, sent_at, received_at, cancelled_at FROM purchase_orders WHERE id = ?", id).
+		Scan(&po.ID, &po.SupplierID, &po.StoreID, &po.Status, &po.Notes, &po.CreatedBy, &po.CreatedAt, &po.SentAt, &po.ReceivedAt, &po.CancelledAt)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := q.Query("SELECT id, purchase_order_id, product_id, quantity_ordered, quantity_received, unit_cost FROM purchase_order_items WHERE purchase_order_id = ? ORDER BY id", id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	po.Items = []model.PurchaseOrderItem{}
+	for rows.Next() {
+		var item model.PurchaseOrderItem
+		if err := rows.Scan(&item.ID, &item.PurchaseOrderID, &item.ProductID, &item.QuantityOrdered, &item.QuantityReceived, &item.UnitCost); err != nil {
+			return nil, err
+		}
+		po.Items = append(po.Items, item)
+	}
+	return &po, rows.Err()
+}
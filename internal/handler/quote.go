@@ -0,0 +1,100 @@
+package handler
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"pos-app/internal/money"
+	"pos-app/internal/pricing"
+)
+
+// SaleQuote is what a cart would cost if it were rung up now.
+type SaleQuote struct {
+	pricing.Breakdown
+	// UnappliedCodes are the requested discount codes that are unknown,
+	// inactive or belong to another store. A sale ignores them.
+	UnappliedCodes []string `json:"unapplied_codes"`
+
+	cart  pricing.Cart
+	costs map[int]money.Money // Product cost prices, for the sale's margins
+}
+
+// QuoteSale handles pricing a cart without selling it. It runs the same
+// pricing, stock and discount checks as CreateSale, so the totals it returns
+// are the ones the sale would be recorded with. Nothing is written.
+func (h *TransactionHandler) QuoteSale(w http.ResponseWriter, r *http.Request) {
+	var req CreateSaleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	quote, status, msg := quoteSale(h.DB, currentLocationID(r), currentStoreID(r), req.Items, req.DiscountCodes)
+	if status == 0 {
+		status, msg = checkQuoteStock(quote)
+	}
+	if status != 0 {
+		http.Error(w, msg, status)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(quote)
+}
+
+// quoteSale looks up the items' prices and stock at a location and the
+// discount codes for a store, and prices them. It returns a non-zero status
+// and message if a quantity isn't positive or a product is unknown; stock is
+// left to checkQuoteStock.
+func quoteSale(q queryer, locationID, storeID int, items []RequestItem, codes []string) (*SaleQuote, int, string) {
+	quote := &SaleQuote{UnappliedCodes: []string{}, costs: map[int]money.Money{}}
+
+	for _, item := range items {
+		if item.Quantity <= 0 {
+			return nil, http.StatusBadRequest, "Quantities must be positive"
+		}
+		it := pricing.Item{ProductID: item.ProductID, Quantity: item.Quantity}
+		var cost money.Money
+		err := q.QueryRow(`
+			SELECT p.name, p.price, p.cost_price, COALESCE(il.quantity, 0)
+			FROM products p
+			JOIN inventory i ON p.id = i.product_id
+			LEFT JOIN inventory_locations il ON il.product_id = p.id AND il.location_id = ?
+			WHERE p.id = ?`, locationID, item.ProductID).Scan(&it.Name, &it.UnitPrice, &cost, &it.Available)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				return nil, http.StatusBadRequest, fmt.Sprintf("Product with ID %d not found", item.ProductID)
+			}
+			return nil, http.StatusInternalServerError, "Failed to fetch product details"
+		}
+		quote.costs[item.ProductID] = cost
+		quote.cart.Items = append(quote.cart.Items, it)
+	}
+
+	var rules []pricing.Rule
+	for _, code := range codes {
+		rule := pricing.Rule{Code: code}
+		err := q.QueryRow("SELECT id, discount_type, value FROM discounts WHERE code = ? AND is_active = TRUE AND (store_id IS NULL OR store_id = ?)", code, storeID).
+			Scan(&rule.DiscountID, &rule.Type, &rule.Value)
+		if err == sql.ErrNoRows {
+			quote.UnappliedCodes = append(quote.UnappliedCodes, code)
+			continue
+		} else if err != nil {
+			return nil, http.StatusInternalServerError, err.Error()
+		}
+		rules = append(rules, rule)
+	}
+
+	quote.Breakdown = pricing.Price(quote.cart, rules)
+	return quote, 0, ""
+}
+
+// checkQuoteStock returns a 409 status and message if the quoted cart wants
+// more of a product than is in stock.
+func checkQuoteStock(quote *SaleQuote) (int, string) {
+	if err := pricing.CheckStock(quote.cart); err != nil {
+		return http.StatusConflict, err.Error()
+	}
+	return 0, ""
+}
@@ -3,7 +3,9 @@ package handler
 import (
 	"database/sql"
 	"encoding/json"
+	"math"
 	"net/http"
+	"pos-app/internal/money"
 	"time"
 )
 
@@ -12,67 +14,154 @@ type ReportHandler struct {
 }
 
 type SalesReport struct {
-	StartDate          string        `json:"start_date"`
-	EndDate            string        `json:"end_date"`
-	TotalRevenue       float64       `json:"total_revenue"`
-	TotalTransactions  int           `json:"total_transactions"`
-	TopSellingProducts []ProductSale `json:"top_selling_products"`
+	StartDate          string              `json:"start_date"`
+	EndDate            string              `json:"end_date"`
+	TotalRevenue       money.Money         `json:"total_revenue"`
+	TotalTransactions  int                 `json:"total_transactions"`
+	TotalReturns       money.Money         `json:"total_returns"` // Refunded in the period, whenever the sale was made
+	NetRevenue         money.Money         `json:"net_revenue"`   // Revenue less returns
+	TotalCost          money.Money         `json:"total_cost"`    // Less the cost of goods returned to stock
+	GrossProfit        money.Money         `json:"gross_profit"`  // Net revenue less total cost
+	GrossMargin        float64             `json:"gross_margin"`  // Percentage of net revenue
+	TopSellingProducts []ProductSale       `json:"top_selling_products"`
+	SalesByCashier     []CashierSale       `json:"sales_by_cashier"`
+	SalesByDay         []DailySale         `json:"sales_by_day"`
+	SalesByStore       []StoreSale         `json:"sales_by_store"`
+	SalesByMethod      []PaymentMethodSale `json:"sales_by_method"` // Split payments count towards each of their methods
 }
 
+// ProductSale values lines at their selling price, before sale-level discounts.
 type ProductSale struct {
-	ProductID   int     `json:"product_id"`
-	ProductName string  `json:"product_name"`
-	TotalSold   int     `json:"total_sold"`
-	TotalValue  float64 `json:"total_value"`
+	ProductID   int         `json:"product_id"`
+	ProductName string      `json:"product_name"`
+	TotalSold   int         `json:"total_sold"`
+	TotalValue  money.Money `json:"total_value"`
+	TotalCost   money.Money `json:"total_cost"`
+	GrossProfit money.Money `json:"gross_profit"`
+	GrossMargin float64     `json:"gross_margin"`
 }
 
-// GetSalesReport handles generating a sales report for a given date range.
-func (h *ReportHandler) GetSalesReport(w http.ResponseWriter, r *http.Request) {
-	startDateStr := r.URL.Query().Get("start_date") // Expected format: YYYY-MM-DD
-	endDateStr := r.URL.Query().Get("end_date")     // Expected format: YYYY-MM-DD
+type DailySale struct {
+	Date              string      `json:"date"`
+	TotalTransactions int         `json:"total_transactions"`
+	TotalRevenue      money.Money `json:"total_revenue"`
+	TotalCost         money.Money `json:"total_cost"`
+	GrossProfit       money.Money `json:"gross_profit"`
+	GrossMargin       float64     `json:"gross_margin"`
+}
 
-	// Default to the last 30 days if no dates are provided
-	if startDateStr == "" || endDateStr == "" {
-		endDate := time.Now()
-		startDate := endDate.AddDate(0, 0, -30)
-		startDateStr = startDate.Format("2006-01-02")
-		endDateStr = endDate.Format("2006-01-02")
+type StoreSale struct {
+	StoreID           int         `json:"store_id"`
+	StoreName         string      `json:"store_name"`
+	TotalTransactions int         `json:"total_transactions"`
+	TotalRevenue      money.Money `json:"total_revenue"`
+}
+
+type CashierSale struct {
+	UserID            int         `json:"user_id"`
+	Username          *string     `json:"username"`
+	IsActive          bool        `json:"is_active"`
+	TotalTransactions int         `json:"total_transactions"`
+	TotalRevenue      money.Money `json:"total_revenue"`
+}
+
+// margin returns profit as a percentage of revenue, or 0 when there was no revenue.
+func margin(profit, revenue money.Money) float64 {
+	if revenue == 0 {
+		return 0
 	}
+	return math.Round(float64(profit)/float64(revenue)*10000) / 100
+}
 
-	// Ensure end date includes the whole day
-	endDateStr += " 23:59:59"
+// GetSalesReport handles generating a sales report for a given date range,
+// covering the stores in scope and optionally a single terminal_id.
+func (h *ReportHandler) GetSalesReport(w http.ResponseWriter, r *http.Request) {
+	scope, err := storeScope(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	terminalID, err := terminalFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	startDateStr, endDateStr := reportRange(r)
 
 	report := SalesReport{
 		StartDate: startDateStr,
 		EndDate:   endDateStr,
 	}
 
+	// Every query below picks its sales s with the same filter; voided sales
+	// are left out and listed in the exceptions report instead
+	salesFilter := "s.transaction_time BETWEEN ? AND ? AND (? IS NULL OR s.store_id = ?) AND (? IS NULL OR s.terminal_id = ?) AND s.status = ?"
+	filterArgs := []any{startDateStr, endDateStr, scope, scope, terminalID, terminalID, saleCompleted}
+
 	// 1. Get total revenue and transaction count
-	err := h.DB.QueryRow(`
-		SELECT COALESCE(SUM(final_amount), 0), COUNT(id)
-		FROM sales
-		WHERE transaction_time BETWEEN ? AND ?`,
-		startDateStr, endDateStr).Scan(&report.TotalRevenue, &report.TotalTransactions)
+	err = h.DB.QueryRow(`
+		SELECT COALESCE(SUM(s.final_amount), 0), COUNT(s.id)
+		FROM sales s
+		WHERE `+salesFilter,
+		filterArgs...).Scan(&report.TotalRevenue, &report.TotalTransactions)
 	if err != nil {
 		http.Error(w, "Failed to generate sales summary: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
 
+	// Sales recorded before cost tracking have no cost_at_sale and count as zero cost
+	err = h.DB.QueryRow(`
+		SELECT COALESCE(SUM(si.quantity * COALESCE(si.cost_at_sale, 0)), 0)
+		FROM sale_items si
+		JOIN sales s ON si.sale_id = s.id
+		WHERE `+salesFilter,
+		filterArgs...).Scan(&report.TotalCost)
+	if err != nil {
+		http.Error(w, "Failed to generate cost summary: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Returns are picked by when they were made, with the same store and terminal filter
+	returnsFilter := "r.created_at BETWEEN ? AND ? AND (? IS NULL OR r.store_id = ?) AND (? IS NULL OR r.terminal_id = ?)"
+	returnsArgs := []any{startDateStr, endDateStr, scope, scope, terminalID, terminalID}
+	var returnedCost money.Money
+	err = h.DB.QueryRow(`
+		SELECT
+			COALESCE(SUM(r.refund_amount), 0),
+			COALESCE(SUM((
+				SELECT SUM(ri.quantity * COALESCE(ri.cost_at_sale, 0))
+				FROM sale_return_items ri WHERE ri.return_id = r.id AND NOT ri.damaged
+			)), 0)
+		FROM sale_returns r
+		WHERE `+returnsFilter,
+		returnsArgs...).Scan(&report.TotalReturns, &returnedCost)
+	if err != nil {
+		http.Error(w, "Failed to generate returns summary: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	report.NetRevenue = report.TotalRevenue - report.TotalReturns
+	report.TotalCost -= returnedCost
+
+	report.GrossProfit = report.NetRevenue - report.TotalCost
+	report.GrossMargin = margin(report.GrossProfit, report.NetRevenue)
+
 	// 2. Get top selling products
 	rows, err := h.DB.Query(`
 		SELECT
 			p.id,
 			p.name,
 			SUM(si.quantity) as total_quantity_sold,
-			SUM(si.quantity * si.price_at_sale) as total_value_sold
+			SUM(si.quantity * si.price_at_sale) as total_value_sold,
+			SUM(si.quantity * COALESCE(si.cost_at_sale, 0)) as total_cost
 		FROM sale_items si
 		JOIN products p ON si.product_id = p.id
 		JOIN sales s ON si.sale_id = s.id
-		WHERE s.transaction_time BETWEEN ? AND ?
+		WHERE `+salesFilter+`
 		GROUP BY p.id, p.name
 		ORDER BY total_quantity_sold DESC
 		LIMIT 10`,
-		startDateStr, endDateStr)
+		filterArgs...)
 	if err != nil {
 		http.Error(w, "Failed to generate top products report: "+err.Error(), http.StatusInternalServerError)
 		return
@@ -81,13 +170,219 @@ func (h *ReportHandler) GetSalesReport(w http.ResponseWriter, r *http.Request) {
 
 	for rows.Next() {
 		var ps ProductSale
-		if err := rows.Scan(&ps.ProductID, &ps.ProductName, &ps.TotalSold, &ps.TotalValue); err != nil {
+		if err := rows.Scan(&ps.ProductID, &ps.ProductName, &ps.TotalSold, &ps.TotalValue, &ps.TotalCost); err != nil {
 			http.Error(w, "Failed to scan product sale row: "+err.Error(), http.StatusInternalServerError)
 			return
 		}
+		ps.GrossProfit = ps.TotalValue - ps.TotalCost
+		ps.GrossMargin = margin(ps.GrossProfit, ps.TotalValue)
 		report.TopSellingProducts = append(report.TopSellingProducts, ps)
 	}
 
+	// 3. Get sales per cashier, including cashiers who have since been deactivated
+	cashierRows, err := h.DB.Query(`
+		SELECT
+			s.user_id,
+			u.username,
+			COALESCE(u.is_active, FALSE),
+			COUNT(s.id),
+			COALESCE(SUM(s.final_amount), 0)
+		FROM sales s
+		LEFT JOIN users u ON u.id = s.user_id
+		WHERE `+salesFilter+`
+		GROUP BY s.user_id, u.username, u.is_active
+		ORDER BY 5 DESC`,
+		filterArgs...)
+	if err != nil {
+		http.Error(w, "Failed to generate cashier report: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer cashierRows.Close()
+
+	for cashierRows.Next() {
+		var cs CashierSale
+		if err := cashierRows.Scan(&cs.UserID, &cs.Username, &cs.IsActive, &cs.TotalTransactions, &cs.TotalRevenue); err != nil {
+			http.Error(w, "Failed to scan cashier sale row: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		report.SalesByCashier = append(report.SalesByCashier, cs)
+	}
+
+	// 4. Get revenue and cost per day
+	dayRows, err := h.DB.Query(`
+		SELECT
+			date(s.transaction_time) as day,
+			COUNT(s.id),
+			COALESCE(SUM(s.final_amount), 0),
+			COALESCE(SUM((
+				SELECT SUM(si.quantity * COALESCE(si.cost_at_sale, 0))
+				FROM sale_items si WHERE si.sale_id = s.id
+			)), 0)
+		FROM sales s
+		WHERE `+salesFilter+`
+		GROUP BY day
+		ORDER BY day`,
+		filterArgs...)
+	if err != nil {
+		http.Error(w, "Failed to generate daily report: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer dayRows.Close()
+
+	for dayRows.Next() {
+		var ds DailySale
+		if err := dayRows.Scan(&ds.Date, &ds.TotalTransactions, &ds.TotalRevenue, &ds.TotalCost); err != nil {
+			http.Error(w, "Failed to scan daily sale row: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		ds.GrossProfit = ds.TotalRevenue - ds.TotalCost
+		ds.GrossMargin = margin(ds.GrossProfit, ds.TotalRevenue)
+		report.SalesByDay = append(report.SalesByDay, ds)
+	}
+
+	// 5. Get revenue per store
+	storeRows, err := h.DB.Query(`
+		SELECT st.id, st.name, COUNT(s.id), COALESCE(SUM(s.final_amount), 0)
+		FROM sales s
+		JOIN stores st ON st.id = s.store_id
+		WHERE `+salesFilter+`
+		GROUP BY st.id, st.name
+		ORDER BY st.id`,
+		filterArgs...)
+	if err != nil {
+		http.Error(w, "Failed to generate store report: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer storeRows.Close()
+
+	for storeRows.Next() {
+		var ss StoreSale
+		if err := storeRows.Scan(&ss.StoreID, &ss.StoreName, &ss.TotalTransactions, &ss.TotalRevenue); err != nil {
+			http.Error(w, "Failed to scan store sale row: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		report.SalesByStore = append(report.SalesByStore, ss)
+	}
+
+	// 6. Get revenue per payment method, net of change given
+	methodRows, err := h.DB.Query(`
+		SELECT p.payment_method, COALESCE(pm.name, p.payment_method), COUNT(DISTINCT s.id), COALESCE(SUM(p.amount), 0)
+		FROM sale_payments p
+		JOIN sales s ON s.id = p.sale_id
+		LEFT JOIN payment_methods pm ON pm.code = p.payment_method
+		WHERE `+salesFilter+`
+		GROUP BY p.payment_method, pm.name
+		ORDER BY 4 DESC`,
+		filterArgs...)
+	if err != nil {
+		http.Error(w, "Failed to generate payment method report: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer methodRows.Close()
+
+	for methodRows.Next() {
+		var ms PaymentMethodSale
+		if err := methodRows.Scan(&ms.PaymentMethod, &ms.Name, &ms.TotalTransactions, &ms.TotalRevenue); err != nil {
+			http.Error(w, "Failed to scan payment method row: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		report.SalesByMethod = append(report.SalesByMethod, ms)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
+
+// ExceptionsReport lists sales that were voided in the period.
+type ExceptionsReport struct {
+	StartDate   string       `json:"start_date"`
+	EndDate     string       `json:"end_date"`
+	TotalVoids  int          `json:"total_voids"`
+	TotalVoided money.Money  `json:"total_voided"`
+	Voids       []VoidedSale `json:"voids"`
+}
+
+type VoidedSale struct {
+	SaleID          int         `json:"sale_id"`
+	StoreID         *int        `json:"store_id"`
+	TerminalID      *int        `json:"terminal_id"`
+	FinalAmount     money.Money `json:"final_amount"`
+	TransactionTime time.Time   `json:"transaction_time"`
+	CashierID       int         `json:"cashier_id"`
+	CashierName     *string     `json:"cashier_name"`
+	VoidedAt        time.Time   `json:"voided_at"`
+	VoidedBy        *int        `json:"voided_by"`
+	VoidedByName    *string     `json:"voided_by_name"`
+	ApprovedBy      *int        `json:"approved_by"`
+	ApprovedByName  *string     `json:"approved_by_name"`
+	Reason          *string     `json:"reason"`
+}
+
+// GetExceptionsReport handles listing the sales voided in a date range,
+// covering the stores in scope and optionally a single terminal_id.
+func (h *ReportHandler) GetExceptionsReport(w http.ResponseWriter, r *http.Request) {
+	scope, err := storeScope(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	terminalID, err := terminalFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	startDateStr, endDateStr := reportRange(r)
+	report := ExceptionsReport{StartDate: startDateStr, EndDate: endDateStr, Voids: []VoidedSale{}}
+
+	rows, err := h.DB.Query(`
+		SELECT s.id, s.store_id, s.terminal_id, s.final_amount, s.transaction_time, s.user_id, cu.username,
+			s.voided_at, s.voided_by, vu.username, s.void_approved_by, au.username, s.void_reason
+		FROM sales s
+		LEFT JOIN users cu ON cu.id = s.user_id
+		LEFT JOIN users vu ON vu.id = s.voided_by
+		LEFT JOIN users au ON au.id = s.void_approved_by
+		WHERE s.status = ? AND s.voided_at BETWEEN ? AND ?
+			AND (? IS NULL OR s.store_id = ?) AND (? IS NULL OR s.terminal_id = ?)
+		ORDER BY s.voided_at DESC`,
+		saleVoided, startDateStr, endDateStr, scope, scope, terminalID, terminalID)
+	if err != nil {
+		http.Error(w, "Failed to generate exceptions report: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var v VoidedSale
+		if err := rows.Scan(&v.SaleID, &v.StoreID, &v.TerminalID, &v.FinalAmount, &v.TransactionTime, &v.CashierID, &v.CashierName,
+			&v.VoidedAt, &v.VoidedBy, &v.VoidedByName, &v.ApprovedBy, &v.ApprovedByName, &v.Reason); err != nil {
+			http.Error(w, "Failed to scan voided sale row: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		report.TotalVoids++
+		report.TotalVoided += v.FinalAmount
+		report.Voids = append(report.Voids, v)
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(report)
 }
+
+// reportRange returns the start and end of the period a report covers, from
+// ?start_date= and ?end_date= (YYYY-MM-DD). It defaults to the last 30 days,
+// and the end date includes the whole day.
+func reportRange(r *http.Request) (string, string) {
+	startDateStr := r.URL.Query().Get("start_date")
+	endDateStr := r.URL.Query().Get("end_date")
+
+	// Default to the last 30 days if no dates are provided
+	if startDateStr == "" || endDateStr == "" {
+		endDate := time.Now()
+		startDate := endDate.AddDate(0, 0, -30)
+		startDateStr = startDate.Format("2006-01-02")
+		endDateStr = endDate.Format("2006-01-02")
+	}
+
+	// Ensure end date includes the whole day
+	return startDateStr, endDateStr + " 23:59:59"
+}
@@ -0,0 +1,254 @@
+package handler
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"pos-app/internal/inventory"
+	"pos-app/internal/model"
+	"pos-app/internal/pricing"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+)
+
+type CreateReturnRequest struct {
+	Items []ReturnItemRequest `json:"items"`
+	// PaymentMethod is how the refund is paid. It defaults to the method the
+	// sale was paid with, and is required if that was split.
+	PaymentMethod string  `json:"payment_method"`
+	Reference     *string `json:"reference"`
+	Reason        *string `json:"reason"`
+}
+
+type ReturnItemRequest struct {
+	ProductID int  `json:"product_id"`
+	Quantity  int  `json:"quantity"`
+	Damaged   bool `json:"damaged"` // Write the goods off instead of putting them back on sale
+}
+
+const saleReturnColumns = "id, sale_id, user_id, store_id, location_id, terminal_id, shift_id, refund_amount, payment_method, reference, reason, created_at"
+
+// CreateReturn handles taking goods back against a sale. Each line is refunded
+// at the price it was sold for, less its pro-rata share of the sale's
+// discounts, and goes back into stock at the till's location. The refund is
+// paid out of the till's open shift.
+func (h *TransactionHandler) CreateReturn(w http.ResponseWriter, r *http.Request) {
+	saleID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "Invalid sale ID", http.StatusBadRequest)
+		return
+	}
+
+	var req CreateReturnRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if len(req.Items) == 0 {
+		http.Error(w, "A return needs at least one item", http.StatusBadRequest)
+		return
+	}
+
+	scope, err := storeScope(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	tx, err := h.DB.Begin()
+	if err != nil {
+		http.Error(w, "Failed to start transaction", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	var sale model.Sale
+	err = tx.QueryRow("SELECT id, total_amount, final_amount, payment_method, status FROM sales WHERE id = ? AND (? IS NULL OR store_id = ?)", saleID, scope, scope).
+		Scan(&sale.ID, &sale.TotalAmount, &sale.FinalAmount, &sale.PaymentMethod, &sale.Status)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Sale not found", http.StatusNotFound)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+	if sale.Status == saleVoided {
+		http.Error(w, "Sale has been voided", http.StatusConflict)
+		return
+	}
+
+	locationID := currentLocationID(r)
+	terminalID := currentTerminalID(r)
+	shiftID, err := openShiftFor(tx, locationID, terminalID)
+	if err == sql.ErrNoRows {
+		http.Error(w, "No shift is open on this till; open one before refunding", http.StatusConflict)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	method := req.PaymentMethod
+	if method == "" {
+		if sale.PaymentMethod == splitMethod {
+			http.Error(w, "payment_method is required to refund a sale paid with several methods", http.StatusBadRequest)
+			return
+		}
+		method = sale.PaymentMethod
+	}
+	method = normalizeMethod(method)
+	var active bool
+	if err := tx.QueryRow("SELECT is_active FROM payment_methods WHERE code = ?", method).Scan(&active); err != nil || !active {
+		http.Error(w, fmt.Sprintf("Unknown or inactive payment method %q", method), http.StatusBadRequest)
+		return
+	}
+
+	var charged pricing.Sold
+	err = tx.QueryRow(`
+		SELECT COALESCE((SELECT SUM(amount_discounted) FROM applied_discounts WHERE sale_id = ?), 0),
+			COALESCE((SELECT SUM(refund_amount) FROM sale_returns WHERE sale_id = ?), 0)`, saleID, saleID).
+		Scan(&charged.DiscountAmount, &charged.Refunded)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	charged.TotalAmount, charged.FinalAmount = sale.TotalAmount, sale.FinalAmount
+
+	items := []model.SaleReturnItem{}
+	returning := []pricing.ReturnItem{}
+	requested := map[int]int{}
+	for _, it := range req.Items {
+		if it.Quantity <= 0 {
+			http.Error(w, "Return quantities must be positive", http.StatusBadRequest)
+			return
+		}
+		requested[it.ProductID] += it.Quantity
+
+		item := model.SaleReturnItem{ProductID: it.ProductID, Quantity: it.Quantity, Damaged: it.Damaged}
+		var sold, returned int
+		err := tx.QueryRow(`
+			SELECT SUM(si.quantity), MAX(si.price_at_sale), MAX(si.cost_at_sale),
+				COALESCE((SELECT SUM(ri.quantity) FROM sale_return_items ri JOIN sale_returns sr ON sr.id = ri.return_id
+					WHERE sr.sale_id = si.sale_id AND ri.product_id = si.product_id), 0)
+			FROM sale_items si
+			WHERE si.sale_id = ? AND si.product_id = ?
+			GROUP BY si.sale_id, si.product_id`, saleID, it.ProductID).Scan(&sold, &item.PriceAtSale, &item.CostAtSale, &returned)
+		if err == sql.ErrNoRows {
+			http.Error(w, fmt.Sprintf("Product ID %d is not on sale %d", it.ProductID, saleID), http.StatusBadRequest)
+			return
+		} else if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if returned+requested[it.ProductID] > sold {
+			http.Error(w, fmt.Sprintf("Only %d of product ID %d can still be returned", sold-returned, it.ProductID), http.StatusConflict)
+			return
+		}
+		items = append(items, item)
+		returning = append(returning, pricing.ReturnItem{ProductID: item.ProductID, Quantity: item.Quantity, PriceAtSale: item.PriceAtSale})
+	}
+
+	// Discounts are shared across the lines in proportion to their value
+	refund := pricing.PriceReturn(charged, returning)
+	for i, l := range refund.Lines {
+		items[i].DiscountAmount = l.DiscountAmount
+		items[i].RefundAmount = l.RefundAmount
+	}
+
+	res, err := tx.Exec(`
+		INSERT INTO sale_returns(sale_id, user_id, store_id, location_id, terminal_id, shift_id, refund_amount, payment_method, reference, reason)
+		VALUES(?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		saleID, currentUserID(r), currentStoreID(r), locationID, terminalID, shiftID, refund.Amount, method, req.Reference, req.Reason)
+	if err != nil {
+		http.Error(w, "Failed to create return", http.StatusInternalServerError)
+		return
+	}
+	returnID64, _ := res.LastInsertId()
+	returnID := int(returnID64)
+
+	for _, item := range items {
+		_, err := tx.Exec(`
+			INSERT INTO sale_return_items(return_id, product_id, quantity, price_at_sale, cost_at_sale, discount_amount, refund_amount, damaged)
+			VALUES(?, ?, ?, ?, ?, ?, ?, ?)`,
+			returnID, item.ProductID, item.Quantity, item.PriceAtSale, item.CostAtSale, item.DiscountAmount, item.RefundAmount, item.Damaged)
+		if err != nil {
+			http.Error(w, "Failed to insert return item", http.StatusInternalServerError)
+			return
+		}
+
+		// Damaged goods still come back through the ledger, then are written off
+		movements := []inventory.Movement{{
+			ProductID:   item.ProductID,
+			Change:      item.Quantity,
+			Type:        inventory.TypeReturn,
+			Note:        fmt.Sprintf("Returned from sale #%d", saleID),
+			LocationID:  locationID,
+			UserID:      currentUserID(r),
+			ReferenceID: &returnID,
+		}}
+		if item.Damaged {
+			movements = append(movements, inventory.Movement{
+				ProductID:   item.ProductID,
+				Change:      -item.Quantity,
+				Type:        inventory.TypeAdjustment,
+				Reason:      inventory.ReasonDamaged,
+				Note:        fmt.Sprintf("Returned damaged from sale #%d", saleID),
+				LocationID:  locationID,
+				UserID:      currentUserID(r),
+				ReferenceID: &returnID,
+			})
+		}
+		for _, m := range movements {
+			if _, err := inventory.Record(tx, m); err != nil {
+				http.Error(w, "Failed to update inventory", http.StatusInternalServerError)
+				return
+			}
+		}
+	}
+
+	ret, err := loadReturn(tx, returnID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "Failed to commit transaction", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(ret)
+}
+
+// loadReturn fetches a return with its items. It returns sql.ErrNoRows if it doesn't exist.
+func loadReturn(q queryer, id int) (*model.SaleReturn, error) {
+	var ret model.SaleReturn
+	err := q.QueryRow("SELECT "+saleReturnColumns+" FROM sale_returns WHERE id = ?", id).
+		Scan(&ret.ID, &ret.SaleID, &ret.UserID, &ret.StoreID, &ret.LocationID, &ret.TerminalID, &ret.ShiftID,
+			&ret.RefundAmount, &ret.PaymentMethod, &ret.Reference, &ret.Reason, &ret.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := q.Query("SELECT return_id, product_id, quantity, price_at_sale, cost_at_sale, discount_amount, refund_amount, damaged FROM sale_return_items WHERE return_id = ?", id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ret.Items = []model.SaleReturnItem{}
+	for rows.Next() {
+		var item model.SaleReturnItem
+		if err := rows.Scan(&item.ReturnID, &item.ProductID, &item.Quantity, &item.PriceAtSale, &item.CostAtSale,
+			&item.DiscountAmount, &item.RefundAmount, &item.Damaged); err != nil {
+			return nil, err
+		}
+		ret.Items = append(ret.Items, item)
+	}
+	return &ret, rows.Err()
+}
@@ -0,0 +1,38 @@
+package handler_test
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestReturnLimits(t *testing.T) {
+	s := newTestServer(t)
+	s.addUser("cashier", "cashier")
+	s.addUser("manager", "manager")
+	tea := s.addProduct("TEA", 3.33, 10)
+
+	till := s.login("cashier", "cashier-password")
+	s.openShift(till)
+	sale := s.sell(till, tea, 3)
+	path := fmt.Sprintf("/sales/%d/returns", sale)
+	lines := func(quantities ...int) map[string]any {
+		items := []map[string]int{}
+		for _, q := range quantities {
+			items = append(items, map[string]int{"product_id": tea, "quantity": q})
+		}
+		return map[string]any{"items": items}
+	}
+
+	// The manager refunds on the same drawer the sale was rung up on
+	manager := s.login("manager", "manager-password")
+	s.call(manager, "POST", path, lines(4), http.StatusConflict)
+	s.call(manager, "POST", path, lines(2, 2), http.StatusConflict)
+	s.call(manager, "POST", path, lines(2), http.StatusCreated)
+	s.call(manager, "POST", path, lines(2), http.StatusConflict)
+	s.call(manager, "POST", path, lines(1), http.StatusCreated)
+	s.call(manager, "POST", path, lines(1), http.StatusConflict)
+	if got := s.stock(tea); got != 10 {
+		t.Errorf("stock after returning the whole sale = %d, want 10", got)
+	}
+}
@@ -0,0 +1,530 @@
+package handler
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"pos-app/internal/auth"
+	"pos-app/internal/model"
+	"pos-app/internal/money"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// Shift statuses
+const (
+	shiftOpen   = "open"
+	shiftClosed = "closed"
+)
+
+// Shift cash movement types
+const (
+	cashPaidIn  = "paid_in"
+	cashPaidOut = "paid_out"
+)
+
+type ShiftHandler struct {
+	DB *sql.DB
+}
+
+// ZReport summarises a shift's takings and reconciles the drawer. For an open
+// shift it is a running (X) report and CountedCash and OverShort are null.
+type ZReport struct {
+	Shift             model.Shift         `json:"shift"`
+	TotalTransactions int                 `json:"total_transactions"`
+	TotalRevenue      money.Money         `json:"total_revenue"`
+	SalesByMethod     []PaymentMethodSale `json:"sales_by_method"`
+	CashSales         money.Money         `json:"cash_sales"` // Taken with methods that open the drawer
+	Refunds           money.Money         `json:"refunds"`
+	CashRefunds       money.Money         `json:"cash_refunds"` // Refunded with methods that open the drawer
+	PaidIn            money.Money         `json:"paid_in"`
+	PaidOut           money.Money         `json:"paid_out"`
+	ExpectedCash      money.Money         `json:"expected_cash"` // Float + cash sales - cash refunds + paid in - paid out
+	CountedCash       *money.Money        `json:"counted_cash"`
+	OverShort         *money.Money        `json:"over_short"`
+}
+
+type PaymentMethodSale struct {
+	PaymentMethod     string      `json:"payment_method"`
+	Name              string      `json:"name"`
+	TotalTransactions int         `json:"total_transactions"`
+	TotalRevenue      money.Money `json:"total_revenue"`
+}
+
+// shiftStoreQuery looks up the store of a shift's location for checkStore.
+const shiftStoreQuery = "SELECT l.store_id FROM shifts sh JOIN locations l ON l.id = sh.location_id WHERE sh.id = ?"
+
+const shiftColumns = "sh.id, sh.status, sh.location_id, sh.terminal_id, sh.opening_float, sh.notes, sh.opened_by, sh.opened_at, sh.closed_by, sh.closed_at, sh.counted_cash, sh.expected_cash, sh.over_short"
+
+// GetShifts handles listing shifts in scope, optionally filtered by status, location_id and terminal_id.
+func (h *ShiftHandler) GetShifts(w http.ResponseWriter, r *http.Request) {
+	scope, err := storeScope(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	query := "SELECT " + shiftColumns + " FROM shifts sh JOIN locations l ON l.id = sh.location_id WHERE (? IS NULL OR l.store_id = ?)"
+	args := []any{scope, scope}
+	if status := r.URL.Query().Get("status"); status != "" {
+		query += " AND sh.status = ?"
+		args = append(args, status)
+	}
+	if locationID := r.URL.Query().Get("location_id"); locationID != "" {
+		query += " AND sh.location_id = ?"
+		args = append(args, locationID)
+	}
+	if terminalID := r.URL.Query().Get("terminal_id"); terminalID != "" {
+		query += " AND sh.terminal_id = ?"
+		args = append(args, terminalID)
+	}
+	query += " ORDER BY sh.id DESC"
+
+	rows, err := h.DB.Query(query, args...)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	shifts := []model.Shift{}
+	for rows.Next() {
+		var sh model.Shift
+		if err := rows.Scan(&sh.ID, &sh.Status, &sh.LocationID, &sh.TerminalID, &sh.OpeningFloat, &sh.Notes, &sh.OpenedBy, &sh.OpenedAt,
+			&sh.ClosedBy, &sh.ClosedAt, &sh.CountedCash, &sh.ExpectedCash, &sh.OverShort); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		shifts = append(shifts, sh)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(shifts)
+}
+
+// GetCurrentShift handles getting the open shift on the caller's drawer.
+func (h *ShiftHandler) GetCurrentShift(w http.ResponseWriter, r *http.Request) {
+	id, err := openShiftFor(h.DB, currentLocationID(r), currentTerminalID(r))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "No shift is open on this till", http.StatusNotFound)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	sh, err := loadShift(h.DB, id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(sh)
+}
+
+// GetShift handles getting a single shift with its cash movements.
+func (h *ShiftHandler) GetShift(w http.ResponseWriter, r *http.Request) {
+	id, ok := h.shiftInScope(w, r)
+	if !ok {
+		return
+	}
+
+	sh, err := loadShift(h.DB, id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(sh)
+}
+
+// OpenShift handles opening a shift on the caller's drawer with a starting
+// float. Each drawer can only have one open shift.
+func (h *ShiftHandler) OpenShift(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		OpeningFloat money.Money `json:"opening_float"`
+		Notes        *string     `json:"notes"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.OpeningFloat < 0 {
+		http.Error(w, "Opening float cannot be negative", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := h.DB.Begin()
+	if err != nil {
+		http.Error(w, "Failed to start transaction", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	locationID, terminalID := currentLocationID(r), currentTerminalID(r)
+	openID, err := openShiftFor(tx, locationID, terminalID)
+	if err == nil {
+		http.Error(w, fmt.Sprintf("Shift %d is already open on this till", openID), http.StatusConflict)
+		return
+	} else if err != sql.ErrNoRows {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	res, err := tx.Exec("INSERT INTO shifts(status, location_id, terminal_id, opening_float, notes, opened_by) VALUES(?, ?, ?, ?, ?, ?)",
+		shiftOpen, locationID, terminalID, req.OpeningFloat, req.Notes, currentUserID(r))
+	if err != nil {
+		http.Error(w, "Failed to open shift", http.StatusInternalServerError)
+		return
+	}
+	id, _ := res.LastInsertId()
+
+	sh, err := loadShift(tx, int(id))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "Failed to commit transaction", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(sh)
+}
+
+// AddCashMovement handles recording a paid-in or paid-out on an open shift.
+func (h *ShiftHandler) AddCashMovement(w http.ResponseWriter, r *http.Request) {
+	id, ok := h.shiftInScope(w, r)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		MovementType string      `json:"movement_type"`
+		Amount       money.Money `json:"amount"`
+		Reason       *string     `json:"reason"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.MovementType != cashPaidIn && req.MovementType != cashPaidOut {
+		http.Error(w, "movement_type must be paid_in or paid_out", http.StatusBadRequest)
+		return
+	}
+	if req.Amount <= 0 {
+		http.Error(w, "Amount must be positive", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := h.DB.Begin()
+	if err != nil {
+		http.Error(w, "Failed to start transaction", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	if status, msg := requireOpenShift(tx, id); status != 0 {
+		http.Error(w, msg, status)
+		return
+	}
+	if status, msg := requireOwnDrawer(tx, r, id); status != 0 {
+		http.Error(w, msg, status)
+		return
+	}
+
+	if _, err := tx.Exec("INSERT INTO shift_cash_movements(shift_id, movement_type, amount, reason, user_id) VALUES(?, ?, ?, ?, ?)",
+		id, req.MovementType, req.Amount, req.Reason, currentUserID(r)); err != nil {
+		http.Error(w, "Failed to record cash movement", http.StatusInternalServerError)
+		return
+	}
+
+	sh, err := loadShift(tx, id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "Failed to commit transaction", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(sh)
+}
+
+// CloseShift handles closing a shift with the cash counted in the drawer. The
+// expected cash and the over/short are fixed at this point and the Z-report is returned.
+func (h *ShiftHandler) CloseShift(w http.ResponseWriter, r *http.Request) {
+	id, ok := h.shiftInScope(w, r)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		CountedCash *money.Money `json:"counted_cash"`
+		Notes       *string      `json:"notes"` // Optional; replaces the notes given at opening
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.CountedCash == nil || *req.CountedCash < 0 {
+		http.Error(w, "counted_cash is required and cannot be negative", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := h.DB.Begin()
+	if err != nil {
+		http.Error(w, "Failed to start transaction", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	if status, msg := requireOpenShift(tx, id); status != 0 {
+		http.Error(w, msg, status)
+		return
+	}
+	if status, msg := requireOwnDrawer(tx, r, id); status != 0 {
+		http.Error(w, msg, status)
+		return
+	}
+
+	sh, err := loadShift(tx, id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	report, err := buildZReport(tx, sh)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	counted := *req.CountedCash
+	overShort := counted - report.ExpectedCash
+	notes := sh.Notes
+	if req.Notes != nil {
+		notes = req.Notes
+	}
+	_, err = tx.Exec(`
+		UPDATE shifts SET status = ?, notes = ?, closed_by = ?, closed_at = CURRENT_TIMESTAMP, counted_cash = ?, expected_cash = ?, over_short = ?
+		WHERE id = ?`,
+		shiftClosed, notes, currentUserID(r), counted, report.ExpectedCash, overShort, id)
+	if err != nil {
+		http.Error(w, "Failed to close shift", http.StatusInternalServerError)
+		return
+	}
+
+	if sh, err = loadShift(tx, id); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if report, err = buildZReport(tx, sh); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "Failed to commit transaction", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
+
+// GetZReport handles getting a shift's Z-report, or a running report while it is open.
+func (h *ShiftHandler) GetZReport(w http.ResponseWriter, r *http.Request) {
+	id, ok := h.shiftInScope(w, r)
+	if !ok {
+		return
+	}
+
+	sh, err := loadShift(h.DB, id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	report, err := buildZReport(h.DB, sh)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
+
+// shiftInScope parses the shift ID from the URL and checks it is in scope,
+// writing the error response and returning false if not.
+func (h *ShiftHandler) shiftInScope(w http.ResponseWriter, r *http.Request) (int, bool) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "Invalid shift ID", http.StatusBadRequest)
+		return 0, false
+	}
+
+	scope, err := storeScope(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return 0, false
+	}
+	if status, msg := checkStore(h.DB, scope, shiftStoreQuery, id, "Shift not found"); status != 0 {
+		http.Error(w, msg, status)
+		return 0, false
+	}
+	return id, true
+}
+
+// buildZReport totals the sales rung up during the shift (those tagged with
+// its shift_id, other than voided ones), the refunds paid out of it and its
+// cash movements. Takings are split by the tenders the sales were paid with,
+// net of change; those whose method opens the drawer count as cash. Expected
+// cash for an open shift is worked out live; a closed shift reports the
+// figures fixed when it closed.
+func buildZReport(q queryer, sh *model.Shift) (*ZReport, error) {
+	report := &ZReport{Shift: *sh, SalesByMethod: []PaymentMethodSale{}}
+
+	err := q.QueryRow("SELECT COUNT(id), COALESCE(SUM(final_amount), 0) FROM sales WHERE shift_id = ? AND status = ?", sh.ID, saleCompleted).
+		Scan(&report.TotalTransactions, &report.TotalRevenue)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := q.Query(`
+		SELECT p.payment_method, COALESCE(pm.name, p.payment_method), COALESCE(pm.opens_drawer, FALSE),
+			COUNT(DISTINCT p.sale_id), COALESCE(SUM(p.amount), 0)
+		FROM sale_payments p
+		JOIN sales s ON s.id = p.sale_id
+		LEFT JOIN payment_methods pm ON pm.code = p.payment_method
+		WHERE s.shift_id = ? AND s.status = ?
+		GROUP BY p.payment_method, pm.name, pm.opens_drawer
+		ORDER BY p.payment_method`, sh.ID, saleCompleted)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var ms PaymentMethodSale
+		var opensDrawer bool
+		if err := rows.Scan(&ms.PaymentMethod, &ms.Name, &opensDrawer, &ms.TotalTransactions, &ms.TotalRevenue); err != nil {
+			return nil, err
+		}
+		if opensDrawer {
+			report.CashSales += ms.TotalRevenue
+		}
+		report.SalesByMethod = append(report.SalesByMethod, ms)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	err = q.QueryRow(`
+		SELECT COALESCE(SUM(r.refund_amount), 0), COALESCE(SUM(CASE WHEN pm.opens_drawer THEN r.refund_amount END), 0)
+		FROM sale_returns r
+		LEFT JOIN payment_methods pm ON pm.code = r.payment_method
+		WHERE r.shift_id = ?`, sh.ID).Scan(&report.Refunds, &report.CashRefunds)
+	if err != nil {
+		return nil, err
+	}
+
+	err = q.QueryRow(`
+		SELECT
+			COALESCE(SUM(CASE WHEN movement_type = ? THEN amount END), 0),
+			COALESCE(SUM(CASE WHEN movement_type = ? THEN amount END), 0)
+		FROM shift_cash_movements WHERE shift_id = ?`, cashPaidIn, cashPaidOut, sh.ID).Scan(&report.PaidIn, &report.PaidOut)
+	if err != nil {
+		return nil, err
+	}
+
+	report.ExpectedCash = sh.OpeningFloat + report.CashSales - report.CashRefunds + report.PaidIn - report.PaidOut
+	if sh.ExpectedCash != nil {
+		report.ExpectedCash = *sh.ExpectedCash
+	}
+	report.CountedCash = sh.CountedCash
+	report.OverShort = sh.OverShort
+	return report, nil
+}
+
+// openShiftFor returns the open shift on a drawer: the terminal's, or the
+// location's for sessions without one. It returns sql.ErrNoRows if there is none.
+func openShiftFor(q queryer, locationID int, terminalID *int) (int, error) {
+	var id int
+	err := q.QueryRow("SELECT id FROM shifts WHERE status = ? AND location_id = ? AND terminal_id IS ?",
+		shiftOpen, locationID, terminalID).Scan(&id)
+	return id, err
+}
+
+// requireOpenShift returns a non-zero status and message unless the shift exists and is open.
+func requireOpenShift(q queryer, id int) (int, string) {
+	var status string
+	if err := q.QueryRow("SELECT status FROM shifts WHERE id = ?", id).Scan(&status); err != nil {
+		if err == sql.ErrNoRows {
+			return http.StatusNotFound, "Shift not found"
+		}
+		return http.StatusInternalServerError, err.Error()
+	}
+	if status != shiftOpen {
+		return http.StatusConflict, fmt.Sprintf("Shift is %s", status)
+	}
+	return 0, ""
+}
+
+// requireOwnDrawer returns a 403 status and message unless the shift is on
+// the caller's own drawer, i.e. at their location and terminal, or the caller
+// has shifts:manage. Other tills can't be trusted with another drawer's cash.
+func requireOwnDrawer(q queryer, r *http.Request, id int) (int, string) {
+	if u, ok := auth.UserFromContext(r.Context()); ok && auth.HasPermission(u.Role, auth.PermShiftsManage) {
+		return 0, ""
+	}
+	var own bool
+	err := q.QueryRow("SELECT location_id = ? AND terminal_id IS ? FROM shifts WHERE id = ?", currentLocationID(r), currentTerminalID(r), id).Scan(&own)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return http.StatusNotFound, "Shift not found"
+		}
+		return http.StatusInternalServerError, err.Error()
+	}
+	if !own {
+		return http.StatusForbidden, "This shift is on another till's drawer"
+	}
+	return 0, ""
+}
+
+// loadShift fetches a shift with its cash movements. It returns sql.ErrNoRows if it doesn't exist.
+func loadShift(q queryer, id int) (*model.Shift, error) {
+	var sh model.Shift
+	err := q.QueryRow("SELECT "+shiftColumns+" FROM shifts sh WHERE sh.id = ?", id).
+		Scan(&sh.ID, &sh.Status, &sh.LocationID, &sh.TerminalID, &sh.OpeningFloat, &sh.Notes, &sh.OpenedBy, &sh.OpenedAt,
+			&sh.ClosedBy, &sh.ClosedAt, &sh.CountedCash, &sh.ExpectedCash, &sh.OverShort)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := q.Query("SELECT id, shift_id, movement_type, amount, reason, user_id, created_at FROM shift_cash_movements WHERE shift_id = ? ORDER BY id", id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sh.Movements = []model.ShiftCashMovement{}
+	for rows.Next() {
+		var m model.ShiftCashMovement
+		if err := rows.Scan(&m.ID, &m.ShiftID, &m.MovementType, &m.Amount, &m.Reason, &m.UserID, &m.CreatedAt); err != nil {
+			return nil, err
+		}
+		sh.Movements = append(sh.Movements, m)
+	}
+	return &sh, rows.Err()
+}
@@ -0,0 +1,49 @@
+package handler_test
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestSaleNeedsOpenShift(t *testing.T) {
+	s := newTestServer(t)
+	s.addUser("cashier", "cashier")
+	till := s.login("cashier", "cashier-password")
+	tea := s.addProduct("TEA", 3.33, 10)
+
+	sale := map[string]any{"items": []map[string]int{{"product_id": tea, "quantity": 1}}, "payment_method": "cash"}
+	s.call(till, "POST", "/sales", sale, http.StatusConflict)
+	if got := s.stock(tea); got != 10 {
+		t.Errorf("stock after a refused sale = %d, want 10", got)
+	}
+
+	shift := s.openShift(till)
+	s.sell(till, tea, 1)
+	s.call(till, "POST", fmt.Sprintf("/shifts/%d/close", shift), map[string]any{"counted_cash": 53.33}, http.StatusOK)
+	s.call(till, "POST", "/sales", sale, http.StatusConflict)
+}
+
+func TestShiftIsTillsOwn(t *testing.T) {
+	s := newTestServer(t)
+	s.addUser("cashier", "cashier")
+	s.addUser("manager", "manager")
+	back := s.call(s.admin, "POST", "/locations", map[string]string{"name": "Back"}, http.StatusCreated)
+	backID := int(back["id"].(float64))
+
+	front := s.login("cashier", "cashier-password")
+	shift := s.openShift(front)
+
+	// A cashier on another till can't touch this drawer
+	other := s.loginAt("cashier", "cashier-password", &backID)
+	s.call(other, "POST", fmt.Sprintf("/shifts/%d/cash-movements", shift), map[string]any{"movement_type": "paid_out", "amount": 20}, http.StatusForbidden)
+	s.call(other, "POST", fmt.Sprintf("/shifts/%d/close", shift), map[string]any{"counted_cash": 0}, http.StatusForbidden)
+
+	// The till itself can, and so can a manager from anywhere
+	s.call(front, "POST", fmt.Sprintf("/shifts/%d/cash-movements", shift), map[string]any{"movement_type": "paid_out", "amount": 20}, http.StatusCreated)
+	manager := s.loginAt("manager", "manager-password", &backID)
+	res := s.call(manager, "POST", fmt.Sprintf("/shifts/%d/close", shift), map[string]any{"counted_cash": 30}, http.StatusOK)
+	if res["over_short"] != 0.0 {
+		t.Errorf("over_short = %v, want 0", res["over_short"])
+	}
+}
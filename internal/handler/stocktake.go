@@ -0,0 +1,520 @@
+package handler
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"pos-app/internal/events"
+	"pos-app/internal/inventory"
+	"pos-app/internal/model"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// Stocktake statuses
+const (
+	stocktakeOpen      = "open"
+	stocktakeClosed    = "closed"
+	stocktakeCancelled = "cancelled"
+)
+
+type StocktakeHandler struct {
+	DB     *sql.DB
+	Events *events.Bus
+}
+
+type OpenStocktakeRequest struct {
+	Notes      *string `json:"notes"`
+	ProductIDs []int   `json:"product_ids"` // Optional; omit to count every product
+	LocationID *int    `json:"location_id"` // Optional; defaults to the caller's location
+}
+
+type StocktakeCountRequest struct {
+	Counts []StocktakeCount `json:"counts"`
+	// Replace overwrites earlier counts for these products instead of adding to
+	// them. Counts from several devices normally add up, e.g. shop floor plus stockroom.
+	Replace bool `json:"replace"`
+}
+
+type StocktakeCount struct {
+	ProductID int `json:"product_id"`
+	Quantity  int `json:"quantity"`
+}
+
+// stocktakeStoreQuery looks up the store of a stocktake's location for checkStore.
+const stocktakeStoreQuery = "SELECT l.store_id FROM stocktakes st JOIN locations l ON l.id = st.location_id WHERE st.id = ?"
+
+// GetStocktakes handles listing stocktake sessions in scope, optionally filtered by status.
+func (h *StocktakeHandler) GetStocktakes(w http.ResponseWriter, r *http.Request) {
+	scope, err := storeScope(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	query := `SELECT st.id, st.status, st.location_id, st.notes, st.opened_by, st.opened_at, st.closed_by, st.closed_at, st.cancelled_at
+		FROM stocktakes st JOIN locations l ON l.id = st.location_id
+		WHERE (? IS NULL OR l.store_id = ?)`
+	args := []any{scope, scope}
+	if status := r.URL.Query().Get("status"); status != "" {
+		query += " AND st.status = ?"
+		args = append(args, status)
+	}
+	if locationID := r.URL.Query().Get("location_id"); locationID != "" {
+		query += " AND st.location_id = ?"
+		args = append(args, locationID)
+	}
+	query += " ORDER BY st.id DESC"
+
+	rows, err := h.DB.Query(query, args...)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	stocktakes := []model.Stocktake{}
+	for rows.Next() {
+		var st model.Stocktake
+		if err := rows.Scan(&st.ID, &st.Status, &st.LocationID, &st.Notes, &st.OpenedBy, &st.OpenedAt, &st.ClosedBy, &st.ClosedAt, &st.CancelledAt); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		stocktakes = append(stocktakes, st)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(stocktakes)
+}
+
+// GetStocktake handles getting a stocktake with its items and current variances.
+func (h *StocktakeHandler) GetStocktake(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "Invalid stocktake ID", http.StatusBadRequest)
+		return
+	}
+
+	scope, err := storeScope(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if status, msg := checkStore(h.DB, scope, stocktakeStoreQuery, id, "Stocktake not found"); status != 0 {
+		http.Error(w, msg, status)
+		return
+	}
+
+	st, err := loadStocktake(h.DB, id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Stocktake not found", http.StatusNotFound)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(st)
+}
+
+// OpenStocktake handles opening a count session at a location. It snapshots the
+// expected quantity there of every product (or of product_ids) and remembers
+// the position in the inventory ledger, so sales made while counting can be
+// allowed for on close.
+func (h *StocktakeHandler) OpenStocktake(w http.ResponseWriter, r *http.Request) {
+	var req OpenStocktakeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := h.DB.Begin()
+	if err != nil {
+		http.Error(w, "Failed to start transaction", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	scope, err := storeScope(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	locationID := currentLocationID(r)
+	if req.LocationID != nil {
+		locationID = *req.LocationID
+	}
+	if status, msg := requireActiveLocation(tx, scope, locationID); status != 0 {
+		http.Error(w, msg, status)
+		return
+	}
+
+	// Overlapping sessions would post the same variance twice
+	var openID int
+	err = tx.QueryRow("SELECT id FROM stocktakes WHERE status = ? AND location_id = ?", stocktakeOpen, locationID).Scan(&openID)
+	if err == nil {
+		http.Error(w, fmt.Sprintf("Stocktake %d is already open at this location; close or cancel it first", openID), http.StatusConflict)
+		return
+	} else if err != sql.ErrNoRows {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	var mark int
+	if err := tx.QueryRow("SELECT COALESCE(MAX(id), 0) FROM inventory_movements").Scan(&mark); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	res, err := tx.Exec("INSERT INTO stocktakes(status, location_id, notes, opened_by, last_movement_id) VALUES(?, ?, ?, ?, ?)",
+		stocktakeOpen, locationID, req.Notes, currentUserID(r), mark)
+	if err != nil {
+		http.Error(w, "Failed to open stocktake", http.StatusInternalServerError)
+		return
+	}
+	id, _ := res.LastInsertId()
+
+	snapshot := `
+		INSERT OR IGNORE INTO stocktake_items(stocktake_id, product_id, expected_quantity)
+		SELECT ?, i.product_id, COALESCE(il.quantity, 0)
+		FROM inventory i
+		LEFT JOIN inventory_locations il ON il.product_id = i.product_id AND il.location_id = ?`
+	if len(req.ProductIDs) == 0 {
+		_, err = tx.Exec(snapshot, id, locationID)
+		if err != nil {
+			http.Error(w, "Failed to snapshot inventory", http.StatusInternalServerError)
+			return
+		}
+	}
+	for _, productID := range req.ProductIDs {
+		res, err := tx.Exec(snapshot+" WHERE i.product_id = ?", id, locationID, productID)
+		if err != nil {
+			http.Error(w, "Failed to snapshot inventory", http.StatusInternalServerError)
+			return
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			var listed bool
+			tx.QueryRow("SELECT EXISTS (SELECT 1 FROM stocktake_items WHERE stocktake_id = ? AND product_id = ?)", id, productID).Scan(&listed)
+			if !listed {
+				http.Error(w, fmt.Sprintf("Product with ID %d not found", productID), http.StatusBadRequest)
+				return
+			}
+		}
+	}
+
+	st, err := loadStocktake(tx, int(id))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if len(st.Items) == 0 {
+		http.Error(w, "There are no products to count", http.StatusBadRequest)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "Failed to commit transaction", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(st)
+}
+
+// SubmitStocktakeCounts handles a batch of counted quantities. Batches may come
+// from several devices and add up, each allowing for the sales and other
+// movements since the one before; each count is kept in stocktake_counts.
+func (h *StocktakeHandler) SubmitStocktakeCounts(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "Invalid stocktake ID", http.StatusBadRequest)
+		return
+	}
+
+	var req StocktakeCountRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if len(req.Counts) == 0 {
+		http.Error(w, "At least one count is required", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := h.DB.Begin()
+	if err != nil {
+		http.Error(w, "Failed to start transaction", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	scope, err := storeScope(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if status, msg := requireOpenStocktake(tx, scope, id); status != 0 {
+		http.Error(w, msg, status)
+		return
+	}
+
+	// The count reflects the shelf as of now, i.e. after every movement so far
+	var mark, locationID int
+	if err := tx.QueryRow("SELECT COALESCE(MAX(id), 0), (SELECT location_id FROM stocktakes WHERE id = ?) FROM inventory_movements", id).Scan(&mark, &locationID); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Added to an earlier count, the batch first brings that count up to now
+	// with the movements since it was taken, so stock counted and then sold
+	// isn't allowed for twice
+	const add = `
+		UPDATE stocktake_items SET
+			counted_quantity = COALESCE(counted_quantity + COALESCE((
+				SELECT SUM(m.quantity_change) FROM inventory_movements m
+				WHERE m.product_id = stocktake_items.product_id AND m.location_id = ?
+					AND m.id > stocktake_items.last_movement_id AND m.id <= ?
+			), 0), 0) + ?,
+			last_movement_id = ?
+		WHERE stocktake_id = ? AND product_id = ?`
+	const replace = "UPDATE stocktake_items SET counted_quantity = ?, last_movement_id = ? WHERE stocktake_id = ? AND product_id = ?"
+
+	for _, count := range req.Counts {
+		if count.Quantity < 0 {
+			http.Error(w, fmt.Sprintf("Counted quantity for product ID %d cannot be negative", count.ProductID), http.StatusBadRequest)
+			return
+		}
+		var res sql.Result
+		if req.Replace {
+			res, err = tx.Exec(replace, count.Quantity, mark, id, count.ProductID)
+		} else {
+			res, err = tx.Exec(add, locationID, mark, count.Quantity, mark, id, count.ProductID)
+		}
+		if err != nil {
+			http.Error(w, "Failed to record count", http.StatusInternalServerError)
+			return
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			http.Error(w, fmt.Sprintf("Product ID %d is not part of this stocktake", count.ProductID), http.StatusBadRequest)
+			return
+		}
+		_, err = tx.Exec("INSERT INTO stocktake_counts(stocktake_id, product_id, quantity, replaced, user_id) VALUES(?, ?, ?, ?, ?)",
+			id, count.ProductID, count.Quantity, req.Replace, currentUserID(r))
+		if err != nil {
+			http.Error(w, "Failed to record count", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	st, err := loadStocktake(tx, id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "Failed to commit transaction", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(st)
+}
+
+// CloseStocktake handles closing a session. Every counted product with a
+// variance gets a 'stocktake' movement, all in one transaction. Products that
+// were never counted are left as they are.
+func (h *StocktakeHandler) CloseStocktake(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "Invalid stocktake ID", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := h.DB.Begin()
+	if err != nil {
+		http.Error(w, "Failed to start transaction", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	scope, err := storeScope(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if status, msg := requireOpenStocktake(tx, scope, id); status != 0 {
+		http.Error(w, msg, status)
+		return
+	}
+
+	st, err := loadStocktake(tx, id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	var results []inventory.Result
+	for _, item := range st.Items {
+		if item.Variance == nil {
+			continue
+		}
+		if _, err := tx.Exec("UPDATE stocktake_items SET variance = ? WHERE stocktake_id = ? AND product_id = ?", *item.Variance, id, item.ProductID); err != nil {
+			http.Error(w, "Failed to record variance", http.StatusInternalServerError)
+			return
+		}
+		if *item.Variance == 0 {
+			continue
+		}
+
+		result, err := inventory.Record(tx, inventory.Movement{
+			ProductID:   item.ProductID,
+			Change:      *item.Variance,
+			Type:        inventory.TypeStocktake,
+			Reason:      "stocktake",
+			LocationID:  st.LocationID,
+			UserID:      currentUserID(r),
+			ReferenceID: &st.ID,
+		})
+		if err != nil {
+			if err == inventory.ErrNoInventory {
+				http.Error(w, fmt.Sprintf("Product ID %d no longer exists", item.ProductID), http.StatusConflict)
+			} else {
+				http.Error(w, "Failed to post stocktake adjustment", http.StatusInternalServerError)
+			}
+			return
+		}
+		results = append(results, result)
+	}
+
+	if _, err := tx.Exec("UPDATE stocktakes SET status = ?, closed_by = ?, closed_at = CURRENT_TIMESTAMP WHERE id = ?", stocktakeClosed, currentUserID(r), id); err != nil {
+		http.Error(w, "Failed to close stocktake", http.StatusInternalServerError)
+		return
+	}
+
+	st, err = loadStocktake(tx, id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "Failed to commit transaction", http.StatusInternalServerError)
+		return
+	}
+
+	publishLowStock(h.DB, h.Events, results...)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(st)
+}
+
+// CancelStocktake handles abandoning an open session without touching stock.
+func (h *StocktakeHandler) CancelStocktake(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "Invalid stocktake ID", http.StatusBadRequest)
+		return
+	}
+
+	scope, err := storeScope(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if status, msg := checkStore(h.DB, scope, stocktakeStoreQuery, id, "Stocktake not found"); status != 0 {
+		http.Error(w, msg, status)
+		return
+	}
+
+	res, err := h.DB.Exec("UPDATE stocktakes SET status = ?, cancelled_at = CURRENT_TIMESTAMP WHERE id = ? AND status = ?",
+		stocktakeCancelled, id, stocktakeOpen)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		if status, msg := requireOpenStocktake(h.DB, nil, id); status != 0 {
+			http.Error(w, msg, status)
+			return
+		}
+	}
+
+	st, err := loadStocktake(h.DB, id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(st)
+}
+
+// requireOpenStocktake returns a non-zero status and message unless the
+// stocktake exists, is in scope and is open.
+func requireOpenStocktake(q queryer, scope *int, id int) (int, string) {
+	if status, msg := checkStore(q, scope, stocktakeStoreQuery, id, "Stocktake not found"); status != 0 {
+		return status, msg
+	}
+	var status string
+	if err := q.QueryRow("SELECT status FROM stocktakes WHERE id = ?", id).Scan(&status); err != nil {
+		if err == sql.ErrNoRows {
+			return http.StatusNotFound, "Stocktake not found"
+		}
+		return http.StatusInternalServerError, err.Error()
+	}
+	if status != stocktakeOpen {
+		return http.StatusConflict, fmt.Sprintf("Stocktake is %s", status)
+	}
+	return 0, ""
+}
+
+// loadStocktake fetches a stocktake with its items. For counted items still
+// open, the variance is worked out against the snapshot plus the ledger
+// movements at the stocktake's location made between opening and the
+// product's latest count. It returns sql.ErrNoRows if the stocktake doesn't exist.
+func loadStocktake(q queryer, id int) (*model.Stocktake, error) {
+	var st model.Stocktake
+	var mark int
+	err := q.QueryRow("SELECT id, status, location_id, notes, opened_by, opened_at, closed_by, closed_at, cancelled_at, last_movement_id FROM stocktakes WHERE id = ?", id).
+		Scan(&st.ID, &st.Status, &st.LocationID, &st.Notes, &st.OpenedBy, &st.OpenedAt, &st.ClosedBy, &st.ClosedAt, &st.CancelledAt, &mark)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := q.Query(`
+		SELECT si.product_id, COALESCE(p.name, ''), si.expected_quantity, si.counted_quantity, si.variance,
+			COALESCE((
+				SELECT SUM(m.quantity_change) FROM inventory_movements m
+				WHERE m.product_id = si.product_id AND m.location_id = ? AND m.id > ?
+					AND m.id <= COALESCE(si.last_movement_id, (SELECT MAX(id) FROM inventory_movements))
+					AND NOT (m.movement_type = ? AND m.reference_id = si.stocktake_id)
+			), 0)
+		FROM stocktake_items si
+		LEFT JOIN products p ON p.id = si.product_id
+		WHERE si.stocktake_id = ?
+		ORDER BY si.product_id`, st.LocationID, mark, inventory.TypeStocktake, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	st.Items = []model.StocktakeItem{}
+	for rows.Next() {
+		var item model.StocktakeItem
+		if err := rows.Scan(&item.ProductID, &item.ProductName, &item.ExpectedQuantity, &item.CountedQuantity, &item.Variance, &item.MovementsDuringCount); err != nil {
+			return nil, err
+		}
+		if item.Variance == nil && item.CountedQuantity != nil && st.Status == stocktakeOpen {
+			variance := *item.CountedQuantity - (item.ExpectedQuantity + item.MovementsDuringCount)
+			item.Variance = &variance
+		}
+		st.Items = append(st.Items, item)
+	}
+	return &st, rows.Err()
+}
@@ -0,0 +1,194 @@
+package handler
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"pos-app/internal/auth"
+	"pos-app/internal/database"
+	"pos-app/internal/model"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+)
+
+type StoreHandler struct {
+	DB *sql.DB
+}
+
+// GetStores handles listing stores. Users without stores:admin only see their own.
+func (h *StoreHandler) GetStores(w http.ResponseWriter, r *http.Request) {
+	scope, err := storeScope(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	rows, err := h.DB.Query("SELECT id, name, is_active, created_at FROM stores WHERE ? IS NULL OR id = ? ORDER BY id", scope, scope)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	stores := []model.Store{}
+	for rows.Next() {
+		var s model.Store
+		if err := rows.Scan(&s.ID, &s.Name, &s.IsActive, &s.CreatedAt); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		stores = append(stores, s)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(stores)
+}
+
+// CreateStore handles adding a store together with its first stock location,
+// which is given the store's name.
+func (h *StoreHandler) CreateStore(w http.ResponseWriter, r *http.Request) {
+	var s model.Store
+	if err := json.NewDecoder(r.Body).Decode(&s); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	s.Name = strings.TrimSpace(s.Name)
+	if s.Name == "" {
+		http.Error(w, "Store name is required", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := h.DB.Begin()
+	if err != nil {
+		http.Error(w, "Failed to start transaction", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec("INSERT INTO stores(name) VALUES(?)", s.Name)
+	if err != nil {
+		http.Error(w, "Failed to create store; the name may already be in use", http.StatusConflict)
+		return
+	}
+	id, _ := res.LastInsertId()
+
+	if _, err := tx.Exec("INSERT INTO locations(store_id, name) VALUES(?, ?)", id, s.Name); err != nil {
+		http.Error(w, "Failed to create the store's location; a location with that name may already exist", http.StatusConflict)
+		return
+	}
+
+	if err := tx.QueryRow("SELECT id, name, is_active, created_at FROM stores WHERE id = ?", id).Scan(&s.ID, &s.Name, &s.IsActive, &s.CreatedAt); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "Failed to commit transaction", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(s)
+}
+
+// UpdateStore handles renaming a store or changing whether it is active.
+func (h *StoreHandler) UpdateStore(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "Invalid store ID", http.StatusBadRequest)
+		return
+	}
+
+	var req struct {
+		Name     string `json:"name"`
+		IsActive *bool  `json:"is_active"` // Optional; omit to leave unchanged
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		http.Error(w, "Store name is required", http.StatusBadRequest)
+		return
+	}
+	if req.IsActive != nil && !*req.IsActive && id == database.DefaultStoreID {
+		http.Error(w, "The main store cannot be deactivated", http.StatusConflict)
+		return
+	}
+
+	var s model.Store
+	err = h.DB.QueryRow("SELECT id, name, is_active, created_at FROM stores WHERE id = ?", id).Scan(&s.ID, &s.Name, &s.IsActive, &s.CreatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Store not found", http.StatusNotFound)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+	s.Name = req.Name
+	if req.IsActive != nil {
+		s.IsActive = *req.IsActive
+	}
+
+	if _, err := h.DB.Exec("UPDATE stores SET name = ?, is_active = ? WHERE id = ?", s.Name, s.IsActive, id); err != nil {
+		http.Error(w, "Failed to update store; the name may already be in use", http.StatusConflict)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s)
+}
+
+// storeScope returns the store a request is limited to. Users with
+// stores:admin see every store (nil) unless they pick one with ?store_id=;
+// everyone else is limited to their own store.
+func storeScope(r *http.Request) (*int, error) {
+	u, ok := auth.UserFromContext(r.Context())
+	if !ok {
+		return nil, fmt.Errorf("authentication required")
+	}
+	if !auth.HasPermission(u.Role, auth.PermStoresAdmin) {
+		return &u.StoreID, nil
+	}
+	if v := r.URL.Query().Get("store_id"); v != "" {
+		id, err := strconv.Atoi(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid store_id")
+		}
+		return &id, nil
+	}
+	return nil, nil
+}
+
+// currentStoreID returns the store of the request's terminal session, which is
+// where new sales and purchase orders are booked.
+func currentStoreID(r *http.Request) int {
+	if sess, ok := auth.SessionFromContext(r.Context()); ok {
+		return sess.StoreID
+	}
+	return database.DefaultStoreID
+}
+
+// checkStore looks up the store an entity belongs to with storeQuery, which
+// takes the entity ID, and returns a non-zero status and message when the
+// entity doesn't exist or is outside scope. Entities of other stores are
+// reported as not found so their IDs can't be probed.
+func checkStore(q queryer, scope *int, storeQuery string, id int, notFound string) (int, string) {
+	var storeID int
+	if err := q.QueryRow(storeQuery, id).Scan(&storeID); err != nil {
+		if err == sql.ErrNoRows {
+			return http.StatusNotFound, notFound
+		}
+		return http.StatusInternalServerError, err.Error()
+	}
+	if scope != nil && *scope != storeID {
+		return http.StatusNotFound, notFound
+	}
+	return 0, ""
+}
@@ -0,0 +1,162 @@
+package handler
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"pos-app/internal/model"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+)
+
+type SupplierHandler struct {
+	DB *sql.DB
+}
+
+// GetSuppliers handles the request to get all suppliers.
+func (h *SupplierHandler) GetSuppliers(w http.ResponseWriter, r *http.Request) {
+	rows, err := h.DB.Query("SELECT id, name, contact_name, phone_number, email, address, created_at FROM suppliers")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	suppliers := []model.Supplier{}
+	for rows.Next() {
+		var s model.Supplier
+		if err := rows.Scan(&s.ID, &s.Name, &s.ContactName, &s.PhoneNumber, &s.Email, &s.Address, &s.CreatedAt); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		suppliers = append(suppliers, s)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(suppliers)
+}
+
+// CreateSupplier handles the request to create a new supplier.
+func (h *SupplierHandler) CreateSupplier(w http.ResponseWriter, r *http.Request) {
+	var s model.Supplier
+	if err := json.NewDecoder(r.Body).Decode(&s); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if s.Name == "" {
+		http.Error(w, "Supplier name is required", http.StatusBadRequest)
+		return
+	}
+
+	res, err := h.DB.Exec("INSERT INTO suppliers(name, contact_name, phone_number, email, address) VALUES(?, ?, ?, ?, ?)",
+		s.Name, s.ContactName, s.PhoneNumber, s.Email, s.Address)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	id, _ := res.LastInsertId()
+	s.ID = int(id)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(s)
+}
+
+// GetSupplier handles the request to get a single supplier by ID.
+func (h *SupplierHandler) GetSupplier(w http.ResponseWriter, r *http.Request) {
+	idStr := chi.URLParam(r, "id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		http.Error(w, "Invalid supplier ID", http.StatusBadRequest)
+		return
+	}
+
+	var s model.Supplier
+	err = h.DB.QueryRow("SELECT id, name, contact_name, phone_number, email, address, created_at FROM suppliers WHERE id = ?", id).
+		Scan(&s.ID, &s.Name, &s.ContactName, &s.PhoneNumber, &s.Email, &s.Address, &s.CreatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Supplier not found", http.StatusNotFound)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s)
+}
+
+// UpdateSupplier handles the request to update a supplier.
+func (h *SupplierHandler) UpdateSupplier(w http.ResponseWriter, r *http.Request) {
+	idStr := chi.URLParam(r, "id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		http.Error(w, "Invalid supplier ID", http.StatusBadRequest)
+		return
+	}
+
+	var s model.Supplier
+	if err := json.NewDecoder(r.Body).Decode(&s); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	res, err := h.DB.Exec("UPDATE suppliers SET name = ?, contact_name = ?, phone_number = ?, email = ?, address = ? WHERE id = ?",
+		s.Name, s.ContactName, s.PhoneNumber, s.Email, s.Address, id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	rowsAffected, _ := res.RowsAffected()
+	if rowsAffected == 0 {
+		http.Error(w, "Supplier not found", http.StatusNotFound)
+		return
+	}
+
+	s.ID = id
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s)
+}
+
+// DeleteSupplier handles the request to delete a supplier that has no purchase orders.
+func (h *SupplierHandler) DeleteSupplier(w http.ResponseWriter, r *http.Request) {
+	idStr := chi.URLParam(r, "id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		http.Error(w, "Invalid supplier ID", http.StatusBadRequest)
+		return
+	}
+
+	var orders int
+	if err := h.DB.QueryRow("SELECT COUNT(*) FROM purchase_orders WHERE supplier_id = ?", id).Scan(&orders); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if orders > 0 {
+		http.Error(w, "Supplier has purchase orders and cannot be deleted", http.StatusConflict)
+		return
+	}
+
+	res, err := h.DB.Exec("DELETE FROM suppliers WHERE id = ?", id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if rowsAffected == 0 {
+		http.Error(w, "Supplier not found", http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,89 @@
+package handler
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"pos-app/internal/model"
+	"pos-app/internal/money"
+	"strings"
+)
+
+// splitMethod is stored as a sale's payment_method when it was paid with
+// more than one method; the tenders themselves are in sale_payments.
+const splitMethod = "split"
+
+type TenderRequest struct {
+	PaymentMethod string      `json:"payment_method"`
+	Amount        money.Money `json:"amount"` // As handed over; may exceed what is due if the method allows change
+	Reference     *string     `json:"reference"`
+}
+
+// settleTenders checks that the tenders use active payment methods and cover
+// the amount due, and works out the change. Only methods that allow change can
+// be overpaid: the change comes out of those tenders, last first, so each
+// payment's Amount is what it actually contributed. A request with no payments
+// is paid in full with its legacy payment_method.
+// It returns a non-zero status and message if the tenders are unacceptable.
+func settleTenders(q queryer, req CreateSaleRequest, due money.Money) (payments []model.SalePayment, change money.Money, method string, status int, msg string) {
+	tenders := req.Payments
+	if len(tenders) == 0 {
+		if strings.TrimSpace(req.PaymentMethod) == "" {
+			return nil, 0, "", http.StatusBadRequest, "payment_method or payments is required"
+		}
+		tenders = []TenderRequest{{PaymentMethod: req.PaymentMethod, Amount: due}}
+	}
+
+	var tendered, changeable money.Money
+	allowsChange := map[string]bool{}
+	for _, t := range tenders {
+		code := normalizeMethod(t.PaymentMethod)
+		if code == "" {
+			return nil, 0, "", http.StatusBadRequest, "Each payment needs a payment_method"
+		}
+		if _, seen := allowsChange[code]; !seen {
+			var allows bool
+			err := q.QueryRow("SELECT allows_change FROM payment_methods WHERE code = ? AND is_active = TRUE", code).Scan(&allows)
+			if err == sql.ErrNoRows {
+				return nil, 0, "", http.StatusBadRequest, fmt.Sprintf("Unknown or inactive payment method %q", t.PaymentMethod)
+			} else if err != nil {
+				return nil, 0, "", http.StatusInternalServerError, err.Error()
+			}
+			allowsChange[code] = allows
+		}
+		// Only a legacy single payment may be for nothing, and only when
+		// discounts covered the whole sale
+		if t.Amount < 0 || (t.Amount == 0 && (len(req.Payments) > 0 || due != 0)) {
+			return nil, 0, "", http.StatusBadRequest, "Payment amounts must be positive"
+		}
+
+		payments = append(payments, model.SalePayment{PaymentMethod: code, Amount: t.Amount, Tendered: t.Amount, Reference: t.Reference})
+		tendered += t.Amount
+		if allowsChange[code] {
+			changeable += t.Amount
+		}
+	}
+	if tendered < due {
+		return nil, 0, "", http.StatusBadRequest, fmt.Sprintf("Payments total %s but %s is due", tendered, due)
+	}
+
+	change = tendered - due
+	if change > changeable {
+		return nil, 0, "", http.StatusBadRequest, fmt.Sprintf("Payments exceed the %s due by %s, more than can be given back as change", due, change)
+	}
+	remaining := change
+	for i := len(payments) - 1; i >= 0 && remaining > 0; i-- {
+		if !allowsChange[payments[i].PaymentMethod] {
+			continue
+		}
+		back := min(remaining, payments[i].Tendered)
+		payments[i].Amount = payments[i].Tendered - back
+		remaining -= back
+	}
+
+	method = payments[0].PaymentMethod
+	if len(allowsChange) > 1 {
+		method = splitMethod
+	}
+	return payments, change, method, 0, ""
+}
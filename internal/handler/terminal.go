@@ -0,0 +1,331 @@
+package handler
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"pos-app/internal/auth"
+	"pos-app/internal/database"
+	"pos-app/internal/model"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	// enrolmentCodeTTL is how long a new terminal's enrolment code can be used.
+	enrolmentCodeTTL = 24 * time.Hour
+	// Secret sizes in random bytes. The code is typed in once on the till; the
+	// credential is kept by the device and sent at every login.
+	enrolmentCodeBytes = 10
+	credentialBytes    = 32
+)
+
+type TerminalHandler struct {
+	DB       *sql.DB
+	Sessions *auth.Sessions
+}
+
+// TerminalEnrolment is returned when a terminal is created or its enrolment
+// code is reissued. The code is shown only this once.
+type TerminalEnrolment struct {
+	model.Terminal
+	EnrolmentCode      string    `json:"enrolment_code"`
+	EnrolmentExpiresAt time.Time `json:"enrolment_expires_at"`
+}
+
+// terminalStoreQuery looks up the store of a terminal's location for checkStore.
+const terminalStoreQuery = "SELECT l.store_id FROM terminals t JOIN locations l ON l.id = t.location_id WHERE t.id = ?"
+
+const terminalColumns = "t.id, t.location_id, t.name, t.is_active, t.credential_hash IS NOT NULL, t.enrolled_at, t.last_seen_at, t.created_at"
+
+// GetTerminals handles listing the terminals in scope, optionally filtered by location_id.
+func (h *TerminalHandler) GetTerminals(w http.ResponseWriter, r *http.Request) {
+	scope, err := storeScope(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	query := "SELECT " + terminalColumns + " FROM terminals t JOIN locations l ON l.id = t.location_id WHERE (? IS NULL OR l.store_id = ?)"
+	args := []any{scope, scope}
+	if locationID := r.URL.Query().Get("location_id"); locationID != "" {
+		query += " AND t.location_id = ?"
+		args = append(args, locationID)
+	}
+	query += " ORDER BY t.id"
+
+	rows, err := h.DB.Query(query, args...)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	terminals := []model.Terminal{}
+	for rows.Next() {
+		var t model.Terminal
+		if err := rows.Scan(&t.ID, &t.LocationID, &t.Name, &t.IsActive, &t.Enrolled, &t.EnrolledAt, &t.LastSeenAt, &t.CreatedAt); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		terminals = append(terminals, t)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(terminals)
+}
+
+// CreateTerminal handles registering a till at a location. The response
+// carries a one-time enrolment code to enter on the device.
+func (h *TerminalHandler) CreateTerminal(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Name       string `json:"name"`
+		LocationID *int   `json:"location_id"` // Optional; defaults to the caller's location
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		http.Error(w, "Terminal name is required", http.StatusBadRequest)
+		return
+	}
+
+	scope, err := storeScope(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	locationID := currentLocationID(r)
+	if req.LocationID != nil {
+		locationID = *req.LocationID
+	}
+	if status, msg := requireActiveLocation(h.DB, scope, locationID); status != 0 {
+		http.Error(w, msg, status)
+		return
+	}
+
+	code, codeHash, err := auth.NewSecret(enrolmentCodeBytes)
+	if err != nil {
+		http.Error(w, "Failed to generate enrolment code", http.StatusInternalServerError)
+		return
+	}
+	expiresAt := time.Now().UTC().Add(enrolmentCodeTTL)
+
+	res, err := h.DB.Exec("INSERT INTO terminals(location_id, name, enrolment_code_hash, enrolment_expires_at) VALUES(?, ?, ?, ?)",
+		locationID, req.Name, codeHash, expiresAt.Format(database.TimeFormat))
+	if err != nil {
+		http.Error(w, "Failed to create terminal; the name may already be in use at this location", http.StatusConflict)
+		return
+	}
+	id, _ := res.LastInsertId()
+
+	t, err := loadTerminal(h.DB, int(id))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(TerminalEnrolment{Terminal: *t, EnrolmentCode: code, EnrolmentExpiresAt: expiresAt.Truncate(time.Second)})
+}
+
+// UpdateTerminal handles renaming a terminal or changing whether it is active.
+// Deactivating a terminal ends every session on it.
+func (h *TerminalHandler) UpdateTerminal(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "Invalid terminal ID", http.StatusBadRequest)
+		return
+	}
+
+	var req struct {
+		Name     string `json:"name"`
+		IsActive *bool  `json:"is_active"` // Optional; omit to leave unchanged
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		http.Error(w, "Terminal name is required", http.StatusBadRequest)
+		return
+	}
+
+	scope, err := storeScope(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if status, msg := checkStore(h.DB, scope, terminalStoreQuery, id, "Terminal not found"); status != 0 {
+		http.Error(w, msg, status)
+		return
+	}
+
+	t, err := loadTerminal(h.DB, id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	t.Name = req.Name
+	if req.IsActive != nil {
+		t.IsActive = *req.IsActive
+	}
+
+	if _, err := h.DB.Exec("UPDATE terminals SET name = ?, is_active = ? WHERE id = ?", t.Name, t.IsActive, id); err != nil {
+		http.Error(w, "Failed to update terminal; the name may already be in use at this location", http.StatusConflict)
+		return
+	}
+	if !t.IsActive {
+		if err := h.Sessions.RevokeTerminal(id); err != nil {
+			http.Error(w, "Failed to revoke sessions", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(t)
+}
+
+// ReissueEnrolmentCode handles issuing a fresh enrolment code, e.g. when a
+// till is replaced. The old credential stops working and its sessions end.
+func (h *TerminalHandler) ReissueEnrolmentCode(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "Invalid terminal ID", http.StatusBadRequest)
+		return
+	}
+
+	scope, err := storeScope(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if status, msg := checkStore(h.DB, scope, terminalStoreQuery, id, "Terminal not found"); status != 0 {
+		http.Error(w, msg, status)
+		return
+	}
+
+	code, codeHash, err := auth.NewSecret(enrolmentCodeBytes)
+	if err != nil {
+		http.Error(w, "Failed to generate enrolment code", http.StatusInternalServerError)
+		return
+	}
+	expiresAt := time.Now().UTC().Add(enrolmentCodeTTL)
+
+	_, err = h.DB.Exec("UPDATE terminals SET credential_hash = NULL, enrolled_at = NULL, enrolment_code_hash = ?, enrolment_expires_at = ? WHERE id = ?",
+		codeHash, expiresAt.Format(database.TimeFormat), id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := h.Sessions.RevokeTerminal(id); err != nil {
+		http.Error(w, "Failed to revoke sessions", http.StatusInternalServerError)
+		return
+	}
+
+	t, err := loadTerminal(h.DB, id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(TerminalEnrolment{Terminal: *t, EnrolmentCode: code, EnrolmentExpiresAt: expiresAt.Truncate(time.Second)})
+}
+
+// EnrolTerminal handles a device swapping its enrolment code for the terminal
+// credential it sends with every login. Each code works once.
+func (h *TerminalHandler) EnrolTerminal(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		EnrolmentCode string `json:"enrolment_code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.EnrolmentCode == "" {
+		http.Error(w, "Enrolment code is required", http.StatusBadRequest)
+		return
+	}
+
+	credential, credentialHash, err := auth.NewSecret(credentialBytes)
+	if err != nil {
+		http.Error(w, "Failed to generate credential", http.StatusInternalServerError)
+		return
+	}
+
+	now := time.Now().UTC().Format(database.TimeFormat)
+	res, err := h.DB.Exec(`
+		UPDATE terminals SET credential_hash = ?, enrolled_at = ?, enrolment_code_hash = NULL, enrolment_expires_at = NULL
+		WHERE enrolment_code_hash = ? AND enrolment_expires_at > ? AND is_active = TRUE`,
+		credentialHash, now, auth.HashSecret(strings.ToUpper(strings.TrimSpace(req.EnrolmentCode))), now)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		http.Error(w, "Invalid or expired enrolment code", http.StatusUnauthorized)
+		return
+	}
+
+	var t model.Terminal
+	err = h.DB.QueryRow("SELECT "+terminalColumns+" FROM terminals t WHERE t.credential_hash = ?", credentialHash).
+		Scan(&t.ID, &t.LocationID, &t.Name, &t.IsActive, &t.Enrolled, &t.EnrolledAt, &t.LastSeenAt, &t.CreatedAt)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		model.Terminal
+		Credential string `json:"credential"`
+	}{t, credential})
+}
+
+// terminalFilter returns the terminal_id query parameter, or nil when it is absent.
+func terminalFilter(r *http.Request) (*int, error) {
+	v := r.URL.Query().Get("terminal_id")
+	if v == "" {
+		return nil, nil
+	}
+	id, err := strconv.Atoi(v)
+	if err != nil {
+		return nil, fmt.Errorf("invalid terminal_id")
+	}
+	return &id, nil
+}
+
+// terminalForCredential returns the active terminal holding the credential and
+// marks it as seen. It returns sql.ErrNoRows if there is none.
+func terminalForCredential(db *sql.DB, credential string) (*model.Terminal, error) {
+	var t model.Terminal
+	err := db.QueryRow("SELECT "+terminalColumns+" FROM terminals t WHERE t.credential_hash = ? AND t.is_active = TRUE", auth.HashSecret(credential)).
+		Scan(&t.ID, &t.LocationID, &t.Name, &t.IsActive, &t.Enrolled, &t.EnrolledAt, &t.LastSeenAt, &t.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := db.Exec("UPDATE terminals SET last_seen_at = ? WHERE id = ?", time.Now().UTC().Format(database.TimeFormat), t.ID); err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// loadTerminal fetches a terminal. It returns sql.ErrNoRows if it doesn't exist.
+func loadTerminal(q queryer, id int) (*model.Terminal, error) {
+	var t model.Terminal
+	err := q.QueryRow("SELECT "+terminalColumns+" FROM terminals t WHERE t.id = ?", id).
+		Scan(&t.ID, &t.LocationID, &t.Name, &t.IsActive, &t.Enrolled, &t.EnrolledAt, &t.LastSeenAt, &t.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
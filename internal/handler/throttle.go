@@ -0,0 +1,90 @@
+package handler
+
+import (
+	"database/sql"
+	"net"
+	"net/http"
+	"pos-app/internal/database"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Credential throttling: a key such as a username or a client address is
+// locked out for authLockout once it reaches its limit of consecutive
+// failures. Failures older than authLockout are forgotten.
+const (
+	authLockout             = 15 * time.Minute
+	maxLoginAttempts        = 5  // Per username
+	maxClientLoginAttempts  = 20 // Per client address; tills can share one behind NAT
+	maxPINAttempts          = 5  // Per terminal session, and per user on it
+	maxVoidApprovalAttempts = 5  // Per session, and per manager username
+)
+
+// dummyPasswordHash is checked against when there is no real hash to check,
+// e.g. for an unknown username, so those requests take as long as a wrong
+// password and usernames can't be probed by timing.
+const dummyPasswordHash = "$2a$10$rN1og63Q7H2NRuFTDh3WFONGkMennQj8e7rRusidStjad1Dn2E.JO"
+
+// secretMatches reports whether secret matches the bcrypt hash. A nil hash
+// never matches but costs the same as one that doesn't.
+func secretMatches(hash *string, secret string) bool {
+	if hash == nil {
+		bcrypt.CompareHashAndPassword([]byte(dummyPasswordHash), []byte(secret))
+		return false
+	}
+	return bcrypt.CompareHashAndPassword([]byte(*hash), []byte(secret)) == nil
+}
+
+// lockedOut reports whether any of the keys is locked out.
+func lockedOut(db *sql.DB, now time.Time, keys ...string) (bool, error) {
+	for _, key := range keys {
+		var locked bool
+		err := db.QueryRow("SELECT EXISTS(SELECT 1 FROM auth_failures WHERE key = ? AND locked_until > ?)", key, now.Format(database.TimeFormat)).Scan(&locked)
+		if err != nil || locked {
+			return locked, err
+		}
+	}
+	return false, nil
+}
+
+// recordFailure counts a failure against the key and locks it out once it
+// reaches limit consecutive failures.
+func recordFailure(db *sql.DB, now time.Time, key string, limit int) error {
+	ts := now.Format(database.TimeFormat)
+	// Housekeeping: drop counts that have expired
+	if _, err := db.Exec("DELETE FROM auth_failures WHERE last_failed_at < ? AND (locked_until IS NULL OR locked_until < ?)",
+		now.Add(-authLockout).Format(database.TimeFormat), ts); err != nil {
+		return err
+	}
+	if _, err := db.Exec("INSERT OR IGNORE INTO auth_failures(key, last_failed_at) VALUES(?, ?)", key, ts); err != nil {
+		return err
+	}
+	_, err := db.Exec(`
+		UPDATE auth_failures SET
+			failed_attempts = CASE WHEN failed_attempts + 1 >= ? THEN 0 ELSE failed_attempts + 1 END,
+			locked_until = CASE WHEN failed_attempts + 1 >= ? THEN ? ELSE locked_until END,
+			last_failed_at = ?
+		WHERE key = ?`,
+		limit, limit, now.Add(authLockout).Format(database.TimeFormat), ts, key)
+	return err
+}
+
+// clearFailures forgets the failures counted against the keys.
+func clearFailures(db *sql.DB, keys ...string) error {
+	for _, key := range keys {
+		if _, err := db.Exec("DELETE FROM auth_failures WHERE key = ?", key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// clientAddr returns the address the request came from, without its port.
+func clientAddr(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
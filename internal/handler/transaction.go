@@ -3,24 +3,33 @@ package handler
 import (
 	"database/sql"
 	"encoding/json"
-	"fmt"
 	"net/http"
+	"pos-app/internal/auth"
+	"pos-app/internal/events"
+	"pos-app/internal/inventory"
 	"pos-app/internal/model"
+	"pos-app/internal/money"
 	"strconv"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 )
 
 type TransactionHandler struct {
-	DB *sql.DB
+	DB         *sql.DB
+	Events     *events.Bus
+	VoidWindow time.Duration // How long a sale can be voided for; 0 means DefaultVoidWindow
 }
 
 type CreateSaleRequest struct {
-	CustomerID    *int          `json:"customer_id"`
-	PaymentMethod string        `json:"payment_method"`
-	Items         []RequestItem `json:"items"`
-	DiscountCodes []string      `json:"discount_codes"`
-	UserID        int           `json:"user_id"` // In a real app, this would come from auth middleware
+	CustomerID    *int            `json:"customer_id"`
+	PaymentMethod string          `json:"payment_method"` // Shorthand for a single payment of the full amount
+	Payments      []TenderRequest `json:"payments"`
+	Items         []RequestItem   `json:"items"`
+	DiscountCodes []string        `json:"discount_codes"`
+	// UserID is accepted only for backward compatibility. The cashier is always
+	// the authenticated user; a different value here is rejected.
+	UserID *int `json:"user_id,omitempty"`
 }
 
 type RequestItem struct {
@@ -36,6 +45,16 @@ func (h *TransactionHandler) CreateSale(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	user, ok := auth.UserFromContext(r.Context())
+	if !ok {
+		http.Error(w, "Authentication required", http.StatusUnauthorized)
+		return
+	}
+	if req.UserID != nil && *req.UserID != user.ID {
+		http.Error(w, "user_id cannot be overridden; sales are attributed to the logged-in user", http.StatusForbidden)
+		return
+	}
+
 	tx, err := h.DB.Begin()
 	if err != nil {
 		http.Error(w, "Failed to start transaction", http.StatusInternalServerError)
@@ -44,115 +63,130 @@ func (h *TransactionHandler) CreateSale(w http.ResponseWriter, r *http.Request)
 	// Defer rollback in case of panic or early return
 	defer tx.Rollback()
 
-	// 1. Calculate total amount and validate stock
-	totalAmount := 0.0
-	for _, item := range req.Items {
-		var price float64
-		var stock int
-		err := tx.QueryRow("SELECT p.price, i.quantity FROM products p JOIN inventory i ON p.id = i.product_id WHERE p.id = ?", item.ProductID).Scan(&price, &stock)
-		if err != nil {
-			if err == sql.ErrNoRows {
-				http.Error(w, fmt.Sprintf("Product with ID %d not found", item.ProductID), http.StatusBadRequest)
-				return
-			}
-			http.Error(w, "Failed to fetch product details", http.StatusInternalServerError)
-			return
-		}
+	saleID, changeDue, stockResults, status, msg := recordSale(tx, r, user.ID, req)
+	if status != 0 {
+		http.Error(w, msg, status)
+		return
+	}
 
-		if stock < item.Quantity {
-			http.Error(w, fmt.Sprintf("Not enough stock for product ID %d. Available: %d, Requested: %d", item.ProductID, stock, item.Quantity), http.StatusConflict)
-			return
-		}
-		totalAmount += price * float64(item.Quantity)
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "Failed to commit transaction", http.StatusInternalServerError)
+		return
 	}
 
-	// 2. Apply discounts
-	finalAmount := totalAmount
-	var totalDiscountAmount float64
-	appliedDiscounts := []model.Discount{}
-	for _, code := range req.DiscountCodes {
-		var d model.Discount
-		err := tx.QueryRow("SELECT id, discount_type, value, is_active FROM discounts WHERE code = ? AND is_active = TRUE", code).Scan(&d.ID, &d.DiscountType, &d.Value, &d.IsActive)
-		if err != nil {
-			// Ignore not found discounts, or return error? For now, ignore.
-			continue
-		}
+	publishLowStock(h.DB, h.Events, stockResults...)
 
-		var discountValue float64
-		if d.DiscountType == "percentage" {
-			discountValue = totalAmount * (d.Value / 100)
-		} else { // fixed_amount
-			discountValue = d.Value
-		}
-		finalAmount -= discountValue
-		totalDiscountAmount += discountValue
-		appliedDiscounts = append(appliedDiscounts, d)
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]any{"sale_id": saleID, "change_due": changeDue})
+}
+
+// recordSale prices the request, checks stock and payment, and writes the
+// sale, its items, stock movements, discounts and payments in tx. It is shared
+// by everything that turns a cart into a sale. It returns a non-zero status
+// and message if the sale can't be made.
+func recordSale(tx *sql.Tx, r *http.Request, userID int, req CreateSaleRequest) (saleID int64, changeDue money.Money, stockResults []inventory.Result, status int, msg string) {
+	// Stock is taken from the location the terminal is logged in at, and the
+	// sale is booked to that location's store
+	locationID := currentLocationID(r)
+	storeID := currentStoreID(r)
+
+	// Takings go into the drawer of the till's open shift
+	shiftID, err := openShiftFor(tx, locationID, currentTerminalID(r))
+	if err == sql.ErrNoRows {
+		return 0, 0, nil, http.StatusConflict, "No shift is open on this till; open one before selling"
+	} else if err != nil {
+		return 0, 0, nil, http.StatusInternalServerError, err.Error()
+	}
+
+	// 1-2. Price the items and apply discounts
+	quote, status, msg := quoteSale(tx, locationID, storeID, req.Items, req.DiscountCodes)
+	if status == 0 {
+		status, msg = checkQuoteStock(quote)
+	}
+	if status != 0 {
+		return 0, 0, nil, status, msg
 	}
-	if finalAmount < 0 {
-		finalAmount = 0
+
+	payments, changeDue, paymentMethod, status, msg := settleTenders(tx, req, quote.FinalAmount)
+	if status != 0 {
+		return 0, 0, nil, status, msg
 	}
 
 	// 3. Insert into sales table
 	saleRes, err := tx.Exec(
-		"INSERT INTO sales(user_id, customer_id, total_amount, final_amount, payment_method) VALUES(?, ?, ?, ?, ?)",
-		req.UserID, req.CustomerID, totalAmount, finalAmount, req.PaymentMethod,
+		"INSERT INTO sales(user_id, customer_id, total_amount, final_amount, payment_method, store_id, location_id, terminal_id, shift_id, change_due) VALUES(?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		userID, req.CustomerID, quote.TotalAmount, quote.FinalAmount, paymentMethod, storeID, locationID, currentTerminalID(r), shiftID, changeDue,
 	)
 	if err != nil {
-		http.Error(w, "Failed to create sale record", http.StatusInternalServerError)
-		return
+		return 0, 0, nil, http.StatusInternalServerError, "Failed to create sale record"
 	}
-	saleID, _ := saleRes.LastInsertId()
+	saleID, _ = saleRes.LastInsertId()
 
 	// 4. Insert sale items and update inventory
-	for _, item := range req.Items {
-		var price float64
-		// We fetch price again to be absolutely sure, though we could have stored it from the first loop
-		tx.QueryRow("SELECT price FROM products WHERE id = ?", item.ProductID).Scan(&price)
-
+	for _, line := range quote.Lines {
 		_, err := tx.Exec(
-			"INSERT INTO sale_items(sale_id, product_id, quantity, price_at_sale) VALUES(?, ?, ?, ?)",
-			saleID, item.ProductID, item.Quantity, price,
+			"INSERT INTO sale_items(sale_id, product_id, quantity, price_at_sale, cost_at_sale) VALUES(?, ?, ?, ?, ?)",
+			saleID, line.ProductID, line.Quantity, line.UnitPrice, quote.costs[line.ProductID],
 		)
 		if err != nil {
-			http.Error(w, "Failed to insert sale item", http.StatusInternalServerError)
-			return
+			return 0, 0, nil, http.StatusInternalServerError, "Failed to insert sale item"
 		}
 
-		_, err = tx.Exec("UPDATE inventory SET quantity = quantity - ? WHERE product_id = ?", item.Quantity, item.ProductID)
+		saleRef := int(saleID)
+		result, err := inventory.Record(tx, inventory.Movement{
+			ProductID:   line.ProductID,
+			Change:      -line.Quantity,
+			Type:        inventory.TypeSale,
+			LocationID:  locationID,
+			UserID:      &userID,
+			ReferenceID: &saleRef,
+		})
 		if err != nil {
-			http.Error(w, "Failed to update inventory", http.StatusInternalServerError)
-			return
+			return 0, 0, nil, http.StatusInternalServerError, "Failed to update inventory"
 		}
+		stockResults = append(stockResults, result)
 	}
 
 	// 5. Insert applied discounts
-	for _, d := range appliedDiscounts {
-		var discountValue float64
-		if d.DiscountType == "percentage" {
-			discountValue = totalAmount * (d.Value / 100)
-		} else {
-			discountValue = d.Value
-		}
-		_, err := tx.Exec("INSERT INTO applied_discounts(sale_id, discount_id, amount_discounted) VALUES (?, ?, ?)", saleID, d.ID, discountValue)
+	for _, d := range quote.Discounts {
+		_, err := tx.Exec("INSERT INTO applied_discounts(sale_id, discount_id, amount_discounted) VALUES (?, ?, ?)", saleID, d.DiscountID, d.Amount)
 		if err != nil {
-			http.Error(w, "Failed to apply discount", http.StatusInternalServerError)
-			return
+			return 0, 0, nil, http.StatusInternalServerError, "Failed to apply discount"
 		}
 	}
 
-	// 6. Commit transaction
-	if err := tx.Commit(); err != nil {
-		http.Error(w, "Failed to commit transaction", http.StatusInternalServerError)
-		return
+	// 6. Record how it was paid
+	for _, p := range payments {
+		_, err := tx.Exec("INSERT INTO sale_payments(sale_id, payment_method, amount, tendered, reference) VALUES (?, ?, ?, ?, ?)",
+			saleID, p.PaymentMethod, p.Amount, p.Tendered, p.Reference)
+		if err != nil {
+			return 0, 0, nil, http.StatusInternalServerError, "Failed to record payment"
+		}
 	}
 
-	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(map[string]int64{"sale_id": saleID})
+	return saleID, changeDue, stockResults, 0, ""
 }
 
-// GetSales handles listing all sales
+// GetSales handles listing all sales in scope, optionally filtered by terminal_id
 func (h *TransactionHandler) GetSales(w http.ResponseWriter, r *http.Request) {
-	rows, err := h.DB.Query("SELECT id, user_id, customer_id, final_amount, payment_method, transaction_time FROM sales ORDER BY transaction_time DESC")
+	scope, err := storeScope(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	terminalID, err := terminalFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// LEFT JOIN so sales by deactivated (or missing) users are still listed
+	rows, err := h.DB.Query(`
+		SELECT s.id, s.user_id, u.username, s.customer_id, s.final_amount, s.payment_method, s.store_id, s.location_id, s.terminal_id, s.status, s.transaction_time
+		FROM sales s
+		LEFT JOIN users u ON u.id = s.user_id
+		WHERE (? IS NULL OR s.store_id = ?) AND (? IS NULL OR s.terminal_id = ?)
+		ORDER BY s.transaction_time DESC`, scope, scope, terminalID, terminalID)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -162,7 +196,7 @@ func (h *TransactionHandler) GetSales(w http.ResponseWriter, r *http.Request) {
 	sales := []model.Sale{}
 	for rows.Next() {
 		var s model.Sale
-		if err := rows.Scan(&s.ID, &s.UserID, &s.CustomerID, &s.FinalAmount, &s.PaymentMethod, &s.TransactionTime); err != nil {
+		if err := rows.Scan(&s.ID, &s.UserID, &s.CashierName, &s.CustomerID, &s.FinalAmount, &s.PaymentMethod, &s.StoreID, &s.LocationID, &s.TerminalID, &s.Status, &s.TransactionTime); err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
@@ -173,7 +207,7 @@ func (h *TransactionHandler) GetSales(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(sales)
 }
 
-// GetSale handles getting a single sale with its items
+// GetSale handles getting a single sale with its items, payments and returns
 func (h *TransactionHandler) GetSale(w http.ResponseWriter, r *http.Request) {
 	idStr := chi.URLParam(r, "id")
 	id, err := strconv.Atoi(idStr)
@@ -182,8 +216,13 @@ func (h *TransactionHandler) GetSale(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var s model.Sale
-	err = h.DB.QueryRow("SELECT id, user_id, customer_id, total_amount, final_amount, payment_method, transaction_time FROM sales WHERE id = ?", id).Scan(&s.ID, &s.UserID, &s.CustomerID, &s.TotalAmount, &s.FinalAmount, &s.PaymentMethod, &s.TransactionTime)
+	scope, err := storeScope(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s, err := loadSale(h.DB, id, scope)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			http.Error(w, "Sale not found", http.StatusNotFound)
@@ -193,24 +232,78 @@ func (h *TransactionHandler) GetSale(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	rows, err := h.DB.Query("SELECT product_id, quantity, price_at_sale FROM sale_items WHERE sale_id = ?", id)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s)
+}
+
+// loadSale fetches a sale in scope with its items, payments and returns.
+// It returns sql.ErrNoRows if there is no such sale in scope.
+func loadSale(q queryer, id int, scope *int) (*model.Sale, error) {
+	var s model.Sale
+	err := q.QueryRow(`
+		SELECT s.id, s.user_id, u.username, s.customer_id, s.total_amount, s.final_amount, s.payment_method, s.store_id, s.location_id, s.terminal_id, s.shift_id, s.change_due,
+			s.status, s.voided_at, s.voided_by, s.void_approved_by, s.void_reason, s.transaction_time
+		FROM sales s
+		LEFT JOIN users u ON u.id = s.user_id
+		WHERE s.id = ? AND (? IS NULL OR s.store_id = ?)`, id, scope, scope).Scan(&s.ID, &s.UserID, &s.CashierName, &s.CustomerID, &s.TotalAmount, &s.FinalAmount, &s.PaymentMethod, &s.StoreID, &s.LocationID, &s.TerminalID, &s.ShiftID, &s.ChangeDue,
+		&s.Status, &s.VoidedAt, &s.VoidedBy, &s.VoidApprovedBy, &s.VoidReason, &s.TransactionTime)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+		return nil, err
+	}
+
+	rows, err := q.Query("SELECT product_id, quantity, price_at_sale, cost_at_sale FROM sale_items WHERE sale_id = ?", id)
+	if err != nil {
+		return nil, err
 	}
 	defer rows.Close()
 
-	items := []model.SaleItem{}
+	s.Items = []model.SaleItem{}
 	for rows.Next() {
 		var item model.SaleItem
-		if err := rows.Scan(&item.ProductID, &item.Quantity, &item.PriceAtSale); err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
+		if err := rows.Scan(&item.ProductID, &item.Quantity, &item.PriceAtSale, &item.CostAtSale); err != nil {
+			return nil, err
 		}
-		items = append(items, item)
+		s.Items = append(s.Items, item)
 	}
-	s.Items = items
+	rows.Close()
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(s)
+	payments, err := q.Query("SELECT id, sale_id, payment_method, amount, tendered, reference, created_at FROM sale_payments WHERE sale_id = ? ORDER BY id", id)
+	if err != nil {
+		return nil, err
+	}
+	defer payments.Close()
+
+	s.Payments = []model.SalePayment{}
+	for payments.Next() {
+		var p model.SalePayment
+		if err := payments.Scan(&p.ID, &p.SaleID, &p.PaymentMethod, &p.Amount, &p.Tendered, &p.Reference, &p.CreatedAt); err != nil {
+			return nil, err
+		}
+		s.Payments = append(s.Payments, p)
+	}
+	payments.Close()
+
+	returnIDs := []int{}
+	returnRows, err := q.Query("SELECT id FROM sale_returns WHERE sale_id = ? ORDER BY id", id)
+	if err != nil {
+		return nil, err
+	}
+	defer returnRows.Close()
+	for returnRows.Next() {
+		var returnID int
+		if err := returnRows.Scan(&returnID); err != nil {
+			return nil, err
+		}
+		returnIDs = append(returnIDs, returnID)
+	}
+	returnRows.Close()
+
+	for _, returnID := range returnIDs {
+		ret, err := loadReturn(q, returnID)
+		if err != nil {
+			return nil, err
+		}
+		s.Returns = append(s.Returns, *ret)
+	}
+	return &s, nil
 }
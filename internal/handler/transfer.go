@@ -0,0 +1,359 @@
+package handler
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"pos-app/internal/events"
+	"pos-app/internal/inventory"
+	"pos-app/internal/model"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// Stock transfer statuses
+const (
+	transferInTransit = "in_transit"
+	transferReceived  = "received"
+	transferCancelled = "cancelled"
+)
+
+type TransferHandler struct {
+	DB     *sql.DB
+	Events *events.Bus
+}
+
+type TransferRequest struct {
+	FromLocationID int                       `json:"from_location_id"`
+	ToLocationID   int                       `json:"to_location_id"`
+	Notes          *string                   `json:"notes"`
+	Items          []model.StockTransferItem `json:"items"`
+}
+
+// transferInScopeSQL matches transfers with either end in a store; it takes the scope twice.
+const transferInScopeSQL = "(? IS NULL OR EXISTS (SELECT 1 FROM locations l WHERE l.id IN (from_location_id, to_location_id) AND l.store_id = ?))"
+
+// GetTransfers handles listing stock transfers in scope, optionally filtered by status and location_id.
+// A transfer is in scope when either of its locations is.
+func (h *TransferHandler) GetTransfers(w http.ResponseWriter, r *http.Request) {
+	scope, err := storeScope(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	query := "SELECT id, from_location_id, to_location_id, status, notes, created_by, created_at, received_by, received_at, cancelled_at FROM stock_transfers WHERE " + transferInScopeSQL
+	args := []any{scope, scope}
+	if status := r.URL.Query().Get("status"); status != "" {
+		query += " AND status = ?"
+		args = append(args, status)
+	}
+	if locationID := r.URL.Query().Get("location_id"); locationID != "" {
+		query += " AND (from_location_id = ? OR to_location_id = ?)"
+		args = append(args, locationID, locationID)
+	}
+	query += " ORDER BY id DESC"
+
+	rows, err := h.DB.Query(query, args...)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	transfers := []model.StockTransfer{}
+	for rows.Next() {
+		var t model.StockTransfer
+		if err := rows.Scan(&t.ID, &t.FromLocationID, &t.ToLocationID, &t.Status, &t.Notes, &t.CreatedBy, &t.CreatedAt, &t.ReceivedBy, &t.ReceivedAt, &t.CancelledAt); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		transfers = append(transfers, t)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(transfers)
+}
+
+// GetTransfer handles getting a single transfer with its items.
+func (h *TransferHandler) GetTransfer(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "Invalid transfer ID", http.StatusBadRequest)
+		return
+	}
+
+	scope, err := storeScope(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if status, msg := checkTransferStore(h.DB, scope, id); status != 0 {
+		http.Error(w, msg, status)
+		return
+	}
+
+	t, err := loadTransfer(h.DB, id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Transfer not found", http.StatusNotFound)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(t)
+}
+
+// CreateTransfer handles dispatching stock from one location to another. The
+// stock leaves the source straight away and stays in transit until the
+// destination receives it.
+func (h *TransferHandler) CreateTransfer(w http.ResponseWriter, r *http.Request) {
+	var req TransferRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.FromLocationID == req.ToLocationID {
+		http.Error(w, "Source and destination locations must differ", http.StatusBadRequest)
+		return
+	}
+	if len(req.Items) == 0 {
+		http.Error(w, "A transfer needs at least one item", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := h.DB.Begin()
+	if err != nil {
+		http.Error(w, "Failed to start transaction", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	// Stock may be sent to another store, but only out of one in scope
+	scope, err := storeScope(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if status, msg := requireActiveLocation(tx, scope, req.FromLocationID); status != 0 {
+		http.Error(w, msg, status)
+		return
+	}
+	if status, msg := requireActiveLocation(tx, nil, req.ToLocationID); status != 0 {
+		http.Error(w, msg, status)
+		return
+	}
+
+	res, err := tx.Exec("INSERT INTO stock_transfers(from_location_id, to_location_id, status, notes, created_by) VALUES(?, ?, ?, ?, ?)",
+		req.FromLocationID, req.ToLocationID, transferInTransit, req.Notes, currentUserID(r))
+	if err != nil {
+		http.Error(w, "Failed to create transfer", http.StatusInternalServerError)
+		return
+	}
+	id64, _ := res.LastInsertId()
+	id := int(id64)
+
+	seen := map[int]bool{}
+	var results []inventory.Result
+	for _, item := range req.Items {
+		if seen[item.ProductID] {
+			http.Error(w, fmt.Sprintf("Product ID %d is listed more than once", item.ProductID), http.StatusBadRequest)
+			return
+		}
+		seen[item.ProductID] = true
+		if item.Quantity <= 0 {
+			http.Error(w, fmt.Sprintf("Quantity for product ID %d must be positive", item.ProductID), http.StatusBadRequest)
+			return
+		}
+
+		if _, err := tx.Exec("INSERT INTO stock_transfer_items(transfer_id, product_id, quantity) VALUES(?, ?, ?)", id, item.ProductID, item.Quantity); err != nil {
+			http.Error(w, "Failed to insert transfer item", http.StatusInternalServerError)
+			return
+		}
+
+		result, err := inventory.Record(tx, inventory.Movement{
+			ProductID:   item.ProductID,
+			Change:      -item.Quantity,
+			Type:        inventory.TypeTransfer,
+			Reason:      "transfer out",
+			LocationID:  req.FromLocationID,
+			UserID:      currentUserID(r),
+			ReferenceID: &id,
+		})
+		if err != nil {
+			if err == inventory.ErrNoInventory {
+				http.Error(w, fmt.Sprintf("Product with ID %d not found", item.ProductID), http.StatusBadRequest)
+			} else {
+				http.Error(w, "Failed to update inventory", http.StatusInternalServerError)
+			}
+			return
+		}
+		if result.LocationQuantityAfter < 0 {
+			http.Error(w, fmt.Sprintf("Not enough stock for product ID %d at location %d. Available: %d, Requested: %d",
+				item.ProductID, req.FromLocationID, result.LocationQuantityAfter+item.Quantity, item.Quantity), http.StatusConflict)
+			return
+		}
+		results = append(results, result)
+	}
+
+	t, err := loadTransfer(tx, id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "Failed to commit transaction", http.StatusInternalServerError)
+		return
+	}
+
+	publishLowStock(h.DB, h.Events, results...)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(t)
+}
+
+// ReceiveTransfer handles booking an in-transit transfer into its destination.
+func (h *TransferHandler) ReceiveTransfer(w http.ResponseWriter, r *http.Request) {
+	h.complete(w, r, transferReceived, "transfer in")
+}
+
+// CancelTransfer handles cancelling an in-transit transfer; the stock goes back to its source.
+func (h *TransferHandler) CancelTransfer(w http.ResponseWriter, r *http.Request) {
+	h.complete(w, r, transferCancelled, "transfer cancelled")
+}
+
+// complete moves an in-transit transfer to newStatus, putting its stock back
+// on the shelf at the destination (received) or the source (cancelled).
+func (h *TransferHandler) complete(w http.ResponseWriter, r *http.Request, newStatus, reason string) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "Invalid transfer ID", http.StatusBadRequest)
+		return
+	}
+
+	tx, err := h.DB.Begin()
+	if err != nil {
+		http.Error(w, "Failed to start transaction", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	scope, err := storeScope(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if status, msg := checkTransferStore(tx, scope, id); status != 0 {
+		http.Error(w, msg, status)
+		return
+	}
+
+	t, err := loadTransfer(tx, id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Transfer not found", http.StatusNotFound)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+	if t.Status != transferInTransit {
+		http.Error(w, fmt.Sprintf("Cannot change transfer from %s to %s", t.Status, newStatus), http.StatusConflict)
+		return
+	}
+
+	locationID := t.ToLocationID
+	if newStatus == transferCancelled {
+		locationID = t.FromLocationID
+	}
+
+	for _, item := range t.Items {
+		_, err := inventory.Record(tx, inventory.Movement{
+			ProductID:   item.ProductID,
+			Change:      item.Quantity,
+			Type:        inventory.TypeTransfer,
+			Reason:      reason,
+			LocationID:  locationID,
+			UserID:      currentUserID(r),
+			ReferenceID: &t.ID,
+		})
+		if err != nil {
+			if err == inventory.ErrNoInventory {
+				http.Error(w, fmt.Sprintf("Product ID %d no longer exists", item.ProductID), http.StatusConflict)
+			} else {
+				http.Error(w, "Failed to update inventory", http.StatusInternalServerError)
+			}
+			return
+		}
+	}
+
+	if newStatus == transferReceived {
+		_, err = tx.Exec("UPDATE stock_transfers SET status = ?, received_by = ?, received_at = CURRENT_TIMESTAMP WHERE id = ?", newStatus, currentUserID(r), id)
+	} else {
+		_, err = tx.Exec("UPDATE stock_transfers SET status = ?, cancelled_at = CURRENT_TIMESTAMP WHERE id = ?", newStatus, id)
+	}
+	if err != nil {
+		http.Error(w, "Failed to update transfer status", http.StatusInternalServerError)
+		return
+	}
+
+	t, err = loadTransfer(tx, id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "Failed to commit transaction", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(t)
+}
+
+// checkTransferStore returns a non-zero status and message unless the transfer
+// exists and one of its locations is in scope.
+func checkTransferStore(q queryer, scope *int, id int) (int, string) {
+	var n int
+	if err := q.QueryRow("SELECT COUNT(*) FROM stock_transfers WHERE id = ? AND "+transferInScopeSQL, id, scope, scope).Scan(&n); err != nil {
+		return http.StatusInternalServerError, err.Error()
+	}
+	if n == 0 {
+		return http.StatusNotFound, "Transfer not found"
+	}
+	return 0, ""
+}
+
+// loadTransfer fetches a transfer with its items. It returns sql.ErrNoRows if it doesn't exist.
+func loadTransfer(q queryer, id int) (*model.StockTransfer, error) {
+	var t model.StockTransfer
+	err := q.QueryRow("SELECT id, from_location_id, to_location_id, status, notes, created_by, created_at, received_by, received_at, cancelled_at FROM stock_transfers WHERE id = ?", id).
+		Scan(&t.ID, &t.FromLocationID, &t.ToLocationID, &t.Status, &t.Notes, &t.CreatedBy, &t.CreatedAt, &t.ReceivedBy, &t.ReceivedAt, &t.CancelledAt)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := q.Query("SELECT product_id, quantity FROM stock_transfer_items WHERE transfer_id = ? ORDER BY id", id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	t.Items = []model.StockTransferItem{}
+	for rows.Next() {
+		var item model.StockTransferItem
+		if err := rows.Scan(&item.ProductID, &item.Quantity); err != nil {
+			return nil, err
+		}
+		t.Items = append(t.Items, item)
+	}
+	return &t, rows.Err()
+}
@@ -3,24 +3,33 @@ package handler
 import (
 	"database/sql"
 	"encoding/json"
+	"fmt"
 	"net/http"
+	"pos-app/internal/auth"
+	"pos-app/internal/database"
 	"pos-app/internal/model"
 	"strconv"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"golang.org/x/crypto/bcrypt"
 )
 
 type UserHandler struct {
-	DB *sql.DB
+	DB       *sql.DB
+	Sessions *auth.Sessions
 }
 
 type RegisterUserRequest struct {
 	Username string `json:"username"`
 	Password string `json:"password"`
 	Role     string `json:"role"`
+	StoreID  *int   `json:"store_id"` // Optional; defaults to the caller's store
 }
 
+// userStoreQuery looks up the store of a user for checkStore.
+const userStoreQuery = "SELECT store_id FROM users WHERE id = ?"
+
 // RegisterUser handles creating a new user with a hashed password.
 func (h *UserHandler) RegisterUser(w http.ResponseWriter, r *http.Request) {
 	var req RegisterUserRequest
@@ -34,6 +43,35 @@ func (h *UserHandler) RegisterUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Set default role if not provided
+	if req.Role == "" {
+		req.Role = auth.RoleCashier
+	}
+	if !auth.ValidRole(req.Role) {
+		http.Error(w, "Invalid role", http.StatusBadRequest)
+		return
+	}
+
+	scope, err := storeScope(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	storeID := currentStoreID(r)
+	switch {
+	case req.StoreID != nil && scope != nil && *req.StoreID != *scope:
+		http.Error(w, fmt.Sprintf("Store with ID %d not found", *req.StoreID), http.StatusBadRequest)
+		return
+	case req.StoreID != nil:
+		storeID = *req.StoreID
+	case scope != nil:
+		storeID = *scope
+	}
+	if status, _ := checkStore(h.DB, nil, "SELECT id FROM stores WHERE id = ?", storeID, ""); status != 0 {
+		http.Error(w, fmt.Sprintf("Store with ID %d not found", storeID), http.StatusBadRequest)
+		return
+	}
+
 	// Hash the password
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
 	if err != nil {
@@ -41,18 +79,13 @@ func (h *UserHandler) RegisterUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Set default role if not provided
-	if req.Role == "" {
-		req.Role = "cashier"
-	}
-
-	stmt, err := h.DB.Prepare("INSERT INTO users(username, password_hash, role) VALUES(?, ?, ?)")
+	stmt, err := h.DB.Prepare("INSERT INTO users(username, password_hash, role, store_id) VALUES(?, ?, ?, ?)")
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	res, err := stmt.Exec(req.Username, string(hashedPassword), req.Role)
+	res, err := stmt.Exec(req.Username, string(hashedPassword), req.Role, storeID)
 	if err != nil {
 		// Handle unique constraint violation for username
 		http.Error(w, "Username already exists", http.StatusConflict)
@@ -66,9 +99,15 @@ func (h *UserHandler) RegisterUser(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(map[string]int64{"user_id": id})
 }
 
-// GetUsers handles listing all users (omitting password hash).
+// GetUsers handles listing the users in scope (omitting password hash).
 func (h *UserHandler) GetUsers(w http.ResponseWriter, r *http.Request) {
-	rows, err := h.DB.Query("SELECT id, username, role, created_at FROM users")
+	scope, err := storeScope(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	rows, err := h.DB.Query("SELECT id, username, role, store_id, is_active, deactivated_at, created_at FROM users WHERE ? IS NULL OR store_id = ?", scope, scope)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -78,7 +117,7 @@ func (h *UserHandler) GetUsers(w http.ResponseWriter, r *http.Request) {
 	users := []model.User{}
 	for rows.Next() {
 		var u model.User
-		if err := rows.Scan(&u.ID, &u.Username, &u.Role, &u.CreatedAt); err != nil {
+		if err := rows.Scan(&u.ID, &u.Username, &u.Role, &u.StoreID, &u.IsActive, &u.DeactivatedAt, &u.CreatedAt); err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
@@ -89,8 +128,8 @@ func (h *UserHandler) GetUsers(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(users)
 }
 
-// DeleteUser handles deleting a user.
-func (h *UserHandler) DeleteUser(w http.ResponseWriter, r *http.Request) {
+// UpdateUserRole handles changing a user's role.
+func (h *UserHandler) UpdateUserRole(w http.ResponseWriter, r *http.Request) {
 	idStr := chi.URLParam(r, "id")
 	id, err := strconv.Atoi(idStr)
 	if err != nil {
@@ -98,8 +137,150 @@ func (h *UserHandler) DeleteUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Add check to prevent deleting the last admin or self, etc. in a real app
-	res, err := h.DB.Exec("DELETE FROM users WHERE id = ?", id)
+	var req struct {
+		Role string `json:"role"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if !auth.ValidRole(req.Role) {
+		http.Error(w, "Invalid role", http.StatusBadRequest)
+		return
+	}
+	if status, msg := h.checkScope(r, id); status != 0 {
+		http.Error(w, msg, status)
+		return
+	}
+
+	if req.Role != auth.RoleAdmin {
+		lastAdmin, err := h.isLastAdmin(id)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if lastAdmin {
+			http.Error(w, "Cannot demote the last active admin", http.StatusConflict)
+			return
+		}
+	}
+
+	res, err := h.DB.Exec("UPDATE users SET role = ? WHERE id = ?", req.Role, id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	rowsAffected, _ := res.RowsAffected()
+	if rowsAffected == 0 {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// ResetUserPassword handles setting a new password for a user and signs them out everywhere.
+func (h *UserHandler) ResetUserPassword(w http.ResponseWriter, r *http.Request) {
+	idStr := chi.URLParam(r, "id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	var req struct {
+		Password string `json:"password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.Password == "" {
+		http.Error(w, "Password is required", http.StatusBadRequest)
+		return
+	}
+	if status, msg := h.checkScope(r, id); status != 0 {
+		http.Error(w, msg, status)
+		return
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	if err != nil {
+		http.Error(w, "Failed to hash password", http.StatusInternalServerError)
+		return
+	}
+
+	res, err := h.DB.Exec("UPDATE users SET password_hash = ? WHERE id = ?", string(hashedPassword), id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	rowsAffected, _ := res.RowsAffected()
+	if rowsAffected == 0 {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	if err := h.Sessions.RevokeUser(id); err != nil {
+		http.Error(w, "Failed to revoke sessions", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// DeactivateUser handles disabling a user's account without deleting it.
+// The row is kept so historical sales still resolve to their cashier.
+func (h *UserHandler) DeactivateUser(w http.ResponseWriter, r *http.Request) {
+	idStr := chi.URLParam(r, "id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	if status, msg := h.checkRemovable(r, id); status != 0 {
+		http.Error(w, msg, status)
+		return
+	}
+
+	res, err := h.DB.Exec("UPDATE users SET is_active = FALSE, deactivated_at = COALESCE(deactivated_at, ?) WHERE id = ?",
+		time.Now().UTC().Format(database.TimeFormat), id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	rowsAffected, _ := res.RowsAffected()
+	if rowsAffected == 0 {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	if err := h.Sessions.RevokeUser(id); err != nil {
+		http.Error(w, "Failed to revoke sessions", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ReactivateUser handles re-enabling a deactivated user's account.
+func (h *UserHandler) ReactivateUser(w http.ResponseWriter, r *http.Request) {
+	idStr := chi.URLParam(r, "id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+	if status, msg := h.checkScope(r, id); status != 0 {
+		http.Error(w, msg, status)
+		return
+	}
+
+	res, err := h.DB.Exec("UPDATE users SET is_active = TRUE, deactivated_at = NULL WHERE id = ?", id)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -113,3 +294,54 @@ func (h *UserHandler) DeleteUser(w http.ResponseWriter, r *http.Request) {
 
 	w.WriteHeader(http.StatusNoContent)
 }
+
+// DeleteUser handles deleting a user. Users are soft-deleted because sales
+// reference them; this is equivalent to DeactivateUser.
+func (h *UserHandler) DeleteUser(w http.ResponseWriter, r *http.Request) {
+	h.DeactivateUser(w, r)
+}
+
+// checkRemovable guards deactivation and deletion against locking everyone out.
+// It returns a non-zero status and message when the user may not be removed.
+func (h *UserHandler) checkRemovable(r *http.Request, id int) (int, string) {
+	if status, msg := h.checkScope(r, id); status != 0 {
+		return status, msg
+	}
+	if caller, ok := auth.UserFromContext(r.Context()); ok && caller.ID == id {
+		return http.StatusConflict, "Cannot remove your own account"
+	}
+
+	lastAdmin, err := h.isLastAdmin(id)
+	if err != nil {
+		return http.StatusInternalServerError, err.Error()
+	}
+	if lastAdmin {
+		return http.StatusConflict, "Cannot remove the last active admin"
+	}
+	return 0, ""
+}
+
+// checkScope returns a non-zero status and message unless the user exists and
+// belongs to a store in scope.
+func (h *UserHandler) checkScope(r *http.Request, id int) (int, string) {
+	scope, err := storeScope(r)
+	if err != nil {
+		return http.StatusBadRequest, err.Error()
+	}
+	return checkStore(h.DB, scope, userStoreQuery, id, "User not found")
+}
+
+// isLastAdmin reports whether the user is an active admin and no other active admin exists.
+func (h *UserHandler) isLastAdmin(id int) (bool, error) {
+	var isAdmin bool
+	var others int
+	err := h.DB.QueryRow(`
+		SELECT
+			EXISTS (SELECT 1 FROM users WHERE id = ? AND role = ? AND is_active = TRUE),
+			(SELECT COUNT(*) FROM users WHERE id != ? AND role = ? AND is_active = TRUE)`,
+		id, auth.RoleAdmin, id, auth.RoleAdmin).Scan(&isAdmin, &others)
+	if err != nil {
+		return false, err
+	}
+	return isAdmin && others == 0, nil
+}
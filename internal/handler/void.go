@@ -0,0 +1,247 @@
+package handler
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"pos-app/internal/auth"
+	"pos-app/internal/database"
+	"pos-app/internal/inventory"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// Sale statuses
+const (
+	saleCompleted = "completed"
+	saleVoided    = "voided"
+)
+
+// DefaultVoidWindow is how long after being rung up a sale can be voided,
+// unless TransactionHandler.VoidWindow says otherwise.
+const DefaultVoidWindow = 15 * time.Minute
+
+type VoidSaleRequest struct {
+	ManagerUsername string `json:"manager_username"`
+	ManagerPassword string `json:"manager_password"`
+	Reason          string `json:"reason"`
+}
+
+// VoidSale handles cancelling a sale outright, e.g. one rung up for the wrong
+// customer. The sale is kept but marked voided, its stock goes back where it
+// came from and its discounts are marked reversed. A manager must approve it
+// with their own credentials, and only within the void window.
+func (h *TransactionHandler) VoidSale(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "Invalid sale ID", http.StatusBadRequest)
+		return
+	}
+
+	var req VoidSaleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	req.Reason = strings.TrimSpace(req.Reason)
+	if req.ManagerUsername == "" || req.ManagerPassword == "" {
+		http.Error(w, "manager_username and manager_password are required", http.StatusBadRequest)
+		return
+	}
+	if req.Reason == "" {
+		http.Error(w, "A reason is required to void a sale", http.StatusBadRequest)
+		return
+	}
+
+	scope, err := storeScope(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Credentials are checked before the transaction so failures are counted
+	// even though the void is rolled back
+	approver, status, msg := checkVoidApprover(h.DB, r, req)
+	if status != 0 {
+		http.Error(w, msg, status)
+		return
+	}
+
+	tx, err := h.DB.Begin()
+	if err != nil {
+		http.Error(w, "Failed to start transaction", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	var (
+		saleStatus  string
+		storeID     int
+		locationID  *int
+		shiftStatus *string
+		rungUp      time.Time
+		returns     int
+	)
+	err = tx.QueryRow(`
+		SELECT s.status, s.store_id, s.location_id, sh.status, s.transaction_time,
+			(SELECT COUNT(*) FROM sale_returns sr WHERE sr.sale_id = s.id)
+		FROM sales s
+		LEFT JOIN shifts sh ON sh.id = s.shift_id
+		WHERE s.id = ? AND (? IS NULL OR s.store_id = ?)`, id, scope, scope).
+		Scan(&saleStatus, &storeID, &locationID, &shiftStatus, &rungUp, &returns)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Sale not found", http.StatusNotFound)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	if approver.storeID != storeID && !auth.HasPermission(approver.role, auth.PermStoresAdmin) {
+		http.Error(w, "This manager belongs to another store", http.StatusForbidden)
+		return
+	}
+
+	window := h.VoidWindow
+	if window == 0 {
+		window = DefaultVoidWindow
+	}
+	switch {
+	case saleStatus == saleVoided:
+		http.Error(w, "Sale is already voided", http.StatusConflict)
+		return
+	case time.Since(rungUp) > window:
+		http.Error(w, fmt.Sprintf("Sales can only be voided within %s of being rung up; take a return instead", window), http.StatusConflict)
+		return
+	case returns > 0:
+		http.Error(w, "Sale has returns against it and can't be voided", http.StatusConflict)
+		return
+	case shiftStatus != nil && *shiftStatus != shiftOpen:
+		http.Error(w, "The sale's shift has been closed", http.StatusConflict)
+		return
+	}
+
+	now := time.Now().UTC().Format(database.TimeFormat)
+	_, err = tx.Exec("UPDATE sales SET status = ?, voided_at = ?, voided_by = ?, void_approved_by = ?, void_reason = ? WHERE id = ?",
+		saleVoided, now, currentUserID(r), approver.id, req.Reason, id)
+	if err != nil {
+		http.Error(w, "Failed to void sale", http.StatusInternalServerError)
+		return
+	}
+
+	// Put the stock back at the location it was sold from
+	rows, err := tx.Query("SELECT product_id, quantity FROM sale_items WHERE sale_id = ?", id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	type line struct{ productID, quantity int }
+	lines := []line{}
+	for rows.Next() {
+		var l line
+		if err := rows.Scan(&l.productID, &l.quantity); err != nil {
+			rows.Close()
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		lines = append(lines, l)
+	}
+	rows.Close()
+
+	for _, l := range lines {
+		m := inventory.Movement{
+			ProductID:   l.productID,
+			Change:      l.quantity,
+			Type:        inventory.TypeVoid,
+			Note:        req.Reason,
+			UserID:      currentUserID(r),
+			ReferenceID: &id,
+		}
+		if locationID != nil {
+			m.LocationID = *locationID
+		}
+		if _, err := inventory.Record(tx, m); err != nil {
+			http.Error(w, "Failed to update inventory", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if _, err := tx.Exec("UPDATE applied_discounts SET reversed_at = ? WHERE sale_id = ?", now, id); err != nil {
+		http.Error(w, "Failed to reverse discounts", http.StatusInternalServerError)
+		return
+	}
+
+	s, err := loadSale(tx, id, scope)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		http.Error(w, "Failed to commit transaction", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s)
+}
+
+type voidApprover struct {
+	id      int
+	storeID int
+	role    string
+}
+
+// checkVoidApprover checks the manager credentials on a void request and
+// returns the approving user. It returns a non-zero status and message if
+// they are wrong or the user may not approve voids. Repeated wrong
+// credentials lock out the requesting session and the manager username.
+func checkVoidApprover(db *sql.DB, r *http.Request, req VoidSaleRequest) (voidApprover, int, string) {
+	var a voidApprover
+	now := time.Now().UTC()
+	keys := []string{"void:manager:" + req.ManagerUsername}
+	if sess, ok := auth.SessionFromContext(r.Context()); ok {
+		keys = append(keys, "void:session:"+sess.ID)
+	}
+	if locked, err := lockedOut(db, now, keys...); err != nil {
+		return a, http.StatusInternalServerError, err.Error()
+	} else if locked {
+		return a, http.StatusTooManyRequests, "Too many failed void approvals; try again later"
+	}
+
+	var (
+		passwordHash string
+		active       bool
+	)
+	err := db.QueryRow("SELECT id, store_id, password_hash, role, is_active FROM users WHERE username = ?", req.ManagerUsername).
+		Scan(&a.id, &a.storeID, &passwordHash, &a.role, &active)
+	if err != nil && err != sql.ErrNoRows {
+		return a, http.StatusInternalServerError, err.Error()
+	}
+	// Unknown and inactive users are checked against a dummy hash and get the
+	// same message as wrong passwords, so usernames can't be probed.
+	hash := &passwordHash
+	if err == sql.ErrNoRows || !active {
+		hash = nil
+	}
+	if !secretMatches(hash, req.ManagerPassword) {
+		for _, key := range keys {
+			if err := recordFailure(db, now, key, maxVoidApprovalAttempts); err != nil {
+				return a, http.StatusInternalServerError, err.Error()
+			}
+		}
+		return a, http.StatusUnauthorized, "Invalid manager username or password"
+	}
+	if err := clearFailures(db, keys...); err != nil {
+		return a, http.StatusInternalServerError, err.Error()
+	}
+	if !auth.HasPermission(a.role, auth.PermSalesVoid) {
+		return a, http.StatusForbidden, "This user can't approve voids"
+	}
+	return a, 0, ""
+}
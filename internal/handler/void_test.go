@@ -0,0 +1,44 @@
+package handler_test
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestVoidApproval(t *testing.T) {
+	s := newTestServer(t)
+	s.addUser("cashier", "cashier")
+	s.addUser("manager", "manager")
+	s.addUser("manager2", "manager")
+	tea := s.addProduct("TEA", 3.33, 10)
+
+	till := s.login("cashier", "cashier-password")
+	s.openShift(till)
+	sale := s.sell(till, tea, 2)
+	path := fmt.Sprintf("/sales/%d/void", sale)
+	approval := func(username, password string) map[string]string {
+		return map[string]string{"manager_username": username, "manager_password": password, "reason": "wrong customer"}
+	}
+
+	// A cashier can't approve their own void
+	s.call(till, "POST", path, approval("cashier", "cashier-password"), http.StatusForbidden)
+	// Unknown managers get the same answer as wrong passwords
+	s.call(s.login("cashier", "cashier-password"), "POST", path, approval("nobody", "wrong"), http.StatusUnauthorized)
+
+	for i := 0; i < 5; i++ {
+		s.call(till, "POST", path, approval("manager", "wrong"), http.StatusUnauthorized)
+	}
+	// Both the till and the manager are locked out, even with the right password
+	s.call(till, "POST", path, approval("manager2", "manager2-password"), http.StatusTooManyRequests)
+	s.call(s.login("cashier", "cashier-password"), "POST", path, approval("manager", "manager-password"), http.StatusTooManyRequests)
+	if got := s.stock(tea); got != 8 {
+		t.Fatalf("stock after refused voids = %d, want 8", got)
+	}
+
+	s.call(s.login("cashier", "cashier-password"), "POST", path, approval("manager2", "manager2-password"), http.StatusOK)
+	if got := s.stock(tea); got != 10 {
+		t.Errorf("stock after void = %d, want 10", got)
+	}
+	s.call(s.login("cashier", "cashier-password"), "POST", path, approval("manager2", "manager2-password"), http.StatusConflict)
+}
@@ -0,0 +1,37 @@
+package inventory
+
+import "fmt"
+
+// Reason codes accepted for manual stock adjustments.
+const (
+	ReasonDamaged = "damaged"
+	ReasonLost    = "lost"
+	ReasonFound   = "found"
+	ReasonRecount = "recount"
+)
+
+// adjustmentDirection is the sign of delta each reason code allows; 0 means either.
+var adjustmentDirection = map[string]int{
+	ReasonDamaged: -1,
+	ReasonLost:    -1,
+	ReasonFound:   1,
+	ReasonRecount: 0,
+}
+
+// ValidateAdjustment checks that the reason code is known and agrees with the sign of delta.
+func ValidateAdjustment(reasonCode string, delta int) error {
+	dir, ok := adjustmentDirection[reasonCode]
+	if !ok {
+		return fmt.Errorf("unknown reason code %q; use damaged, lost, found or recount", reasonCode)
+	}
+	if delta == 0 {
+		return fmt.Errorf("delta must not be zero")
+	}
+	if dir < 0 && delta > 0 {
+		return fmt.Errorf("reason %q requires a negative delta", reasonCode)
+	}
+	if dir > 0 && delta < 0 {
+		return fmt.Errorf("reason %q requires a positive delta", reasonCode)
+	}
+	return nil
+}
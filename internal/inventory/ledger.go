@@ -0,0 +1,108 @@
+package inventory
+
+import (
+	"database/sql"
+	"errors"
+	"pos-app/internal/database"
+	"pos-app/internal/money"
+)
+
+// Movement types recorded in inventory_movements.
+const (
+	TypeSale       = "sale"
+	TypeReceive    = "receive"
+	TypeAdjustment = "adjustment"
+	TypeReturn     = "return"
+	TypeTransfer   = "transfer"
+	TypeStocktake  = "stocktake"
+	TypeVoid       = "void"
+)
+
+// ErrNoInventory is returned when a product has no inventory row to move stock against.
+var ErrNoInventory = errors.New("product has no inventory record")
+
+// Movement describes a single change to a product's stock.
+type Movement struct {
+	ProductID   int
+	Change      int // Signed: negative removes stock
+	Type        string
+	Reason      string
+	Note        string
+	UnitCost    *money.Money // Cost paid per unit, for receipts
+	LocationID  int          // Where the stock moved; 0 means the default location
+	UserID      *int
+	ReferenceID *int // e.g. the sale ID for TypeSale
+}
+
+// Result is the state of a product's stock after a movement. QuantityBefore
+// and QuantityAfter are totals across all locations.
+type Result struct {
+	ProductID             int
+	QuantityBefore        int
+	QuantityAfter         int
+	LocationID            int
+	LocationQuantityAfter int
+	ReorderPoint          *int
+	ReorderQuantity       *int
+}
+
+// CrossedReorderPoint reports whether the movement took stock from above the
+// reorder point to at or below it.
+func (r Result) CrossedReorderPoint() bool {
+	if r.ReorderPoint == nil {
+		return false
+	}
+	return r.QuantityBefore > *r.ReorderPoint && r.QuantityAfter <= *r.ReorderPoint
+}
+
+// Record applies the movement to inventory.quantity and to the stock held at
+// the movement's location, and appends it to the ledger in the same transaction.
+func Record(tx *sql.Tx, m Movement) (Result, error) {
+	if m.LocationID == 0 {
+		m.LocationID = database.DefaultLocationID
+	}
+
+	res, err := tx.Exec("UPDATE inventory SET quantity = quantity + ?, last_updated = CURRENT_TIMESTAMP WHERE product_id = ?", m.Change, m.ProductID)
+	if err != nil {
+		return Result{}, err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return Result{}, ErrNoInventory
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO inventory_locations(product_id, location_id, quantity) VALUES(?, ?, ?)
+		ON CONFLICT(product_id, location_id) DO UPDATE SET quantity = quantity + excluded.quantity`,
+		m.ProductID, m.LocationID, m.Change)
+	if err != nil {
+		return Result{}, err
+	}
+
+	result := Result{ProductID: m.ProductID, LocationID: m.LocationID}
+	err = tx.QueryRow(`
+		SELECT i.quantity, il.quantity, i.reorder_point, i.reorder_quantity
+		FROM inventory i
+		JOIN inventory_locations il ON il.product_id = i.product_id AND il.location_id = ?
+		WHERE i.product_id = ?`, m.LocationID, m.ProductID).
+		Scan(&result.QuantityAfter, &result.LocationQuantityAfter, &result.ReorderPoint, &result.ReorderQuantity)
+	if err != nil {
+		return Result{}, err
+	}
+	result.QuantityBefore = result.QuantityAfter - m.Change
+
+	_, err = tx.Exec(
+		"INSERT INTO inventory_movements(product_id, quantity_change, quantity_after, movement_type, reason, note, unit_cost, location_id, user_id, reference_id) VALUES(?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		m.ProductID, m.Change, result.QuantityAfter, m.Type, nullIfEmpty(m.Reason), nullIfEmpty(m.Note), m.UnitCost, m.LocationID, m.UserID, m.ReferenceID,
+	)
+	if err != nil {
+		return Result{}, err
+	}
+	return result, nil
+}
+
+func nullIfEmpty(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
@@ -1,14 +1,31 @@
 package model
 
-import "time"
+import (
+	"encoding/json"
+	"pos-app/internal/money"
+	"time"
+)
 
 // User represents the users table
 type User struct {
-	ID           int       `json:"id"`
-	Username     string    `json:"username"`
-	PasswordHash string    `json:"-"` // Do not expose password hash
-	Role         string    `json:"role"`
-	CreatedAt    time.Time `json:"created_at"`
+	ID            int        `json:"id"`
+	StoreID       int        `json:"store_id"`
+	Username      string     `json:"username"`
+	PasswordHash  string     `json:"-"` // Do not expose password hash
+	PINHash       *string    `json:"-"` // Optional quick-switch PIN, hashed like the password
+	Role          string     `json:"role"`
+	IsActive      bool       `json:"is_active"`
+	DeactivatedAt *time.Time `json:"deactivated_at"`
+	CreatedAt     time.Time  `json:"created_at"`
+}
+
+// Store represents the stores table. Users, locations, sales and purchase
+// orders belong to a store; products, customers and suppliers are shared.
+type Store struct {
+	ID        int       `json:"id"`
+	Name      string    `json:"name"`
+	IsActive  bool      `json:"is_active"`
+	CreatedAt time.Time `json:"created_at"`
 }
 
 // Customer represents the customers table
@@ -23,28 +40,195 @@ type Customer struct {
 
 // Product represents the products table
 type Product struct {
+	ID          int         `json:"id"`
+	SKU         string      `json:"sku"`
+	Name        string      `json:"name"`
+	Description *string     `json:"description"`
+	Price       money.Money `json:"price"`
+	CostPrice   money.Money `json:"cost_price"` // What the store pays per unit
+	CreatedAt   time.Time   `json:"created_at"`
+}
+
+// Inventory represents the inventory table
+type Inventory struct {
+	ProductID       int       `json:"product_id"`
+	Quantity        int       `json:"quantity"`         // Total across all locations
+	ReorderPoint    *int      `json:"reorder_point"`    // Stock level at or below which to reorder
+	ReorderQuantity *int      `json:"reorder_quantity"` // How much to order when reordering
+	LastUpdated     time.Time `json:"last_updated"`
+}
+
+// InventoryMovement represents the inventory_movements table (the stock ledger)
+type InventoryMovement struct {
+	ID             int          `json:"id"`
+	ProductID      int          `json:"product_id"`
+	QuantityChange int          `json:"quantity_change"`
+	QuantityAfter  int          `json:"quantity_after"`
+	MovementType   string       `json:"movement_type"` // 'sale', 'receive', 'adjustment', 'return', 'transfer' or 'stocktake'
+	Reason         *string      `json:"reason"`
+	Note           *string      `json:"note"`
+	UnitCost       *money.Money `json:"unit_cost"`
+	LocationID     *int         `json:"location_id"`
+	UserID         *int         `json:"user_id"`
+	Username       *string      `json:"username"`
+	ReferenceID    *int         `json:"reference_id"`
+	CreatedAt      time.Time    `json:"created_at"`
+}
+
+// Location represents the locations table: a shop floor, warehouse or branch that holds stock
+type Location struct {
+	ID        int       `json:"id"`
+	StoreID   int       `json:"store_id"`
+	Name      string    `json:"name"`
+	IsActive  bool      `json:"is_active"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Terminal represents the terminals table: a till enrolled at a location.
+// Its credential is only ever stored hashed.
+type Terminal struct {
+	ID         int        `json:"id"`
+	LocationID int        `json:"location_id"`
+	Name       string     `json:"name"`
+	IsActive   bool       `json:"is_active"`
+	Enrolled   bool       `json:"enrolled"` // Whether a device holds a credential for it
+	EnrolledAt *time.Time `json:"enrolled_at"`
+	LastSeenAt *time.Time `json:"last_seen_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// LocationStock represents a row of the inventory_locations table
+type LocationStock struct {
+	ProductID    int    `json:"product_id"`
+	ProductName  string `json:"product_name,omitempty"`
+	LocationID   int    `json:"location_id"`
+	LocationName string `json:"location_name,omitempty"`
+	Quantity     int    `json:"quantity"`
+}
+
+// StockTransfer represents the stock_transfers table
+type StockTransfer struct {
+	ID             int                 `json:"id"`
+	FromLocationID int                 `json:"from_location_id"`
+	ToLocationID   int                 `json:"to_location_id"`
+	Status         string              `json:"status"` // 'in_transit', 'received' or 'cancelled'
+	Notes          *string             `json:"notes"`
+	CreatedBy      *int                `json:"created_by"`
+	CreatedAt      time.Time           `json:"created_at"`
+	ReceivedBy     *int                `json:"received_by"`
+	ReceivedAt     *time.Time          `json:"received_at"`
+	CancelledAt    *time.Time          `json:"cancelled_at"`
+	Items          []StockTransferItem `json:"items"`
+}
+
+// StockTransferItem represents the stock_transfer_items table
+type StockTransferItem struct {
+	ProductID int `json:"product_id"`
+	Quantity  int `json:"quantity"`
+}
+
+// Supplier represents the suppliers table
+type Supplier struct {
 	ID          int       `json:"id"`
-	SKU         string    `json:"sku"`
 	Name        string    `json:"name"`
-	Description *string   `json:"description"`
-	Price       float64   `json:"price"`
+	ContactName *string   `json:"contact_name"`
+	PhoneNumber *string   `json:"phone_number"`
+	Email       *string   `json:"email"`
+	Address     *string   `json:"address"`
 	CreatedAt   time.Time `json:"created_at"`
 }
 
-// Inventory represents the inventory table
-type Inventory struct {
-	ProductID   int       `json:"product_id"`
-	Quantity    int       `json:"quantity"`
-	LastUpdated time.Time `json:"last_updated"`
+// PurchaseOrder represents the purchase_orders table
+type PurchaseOrder struct {
+	ID          int                 `json:"id"`
+	SupplierID  int                 `json:"supplier_id"`
+	StoreID     int                 `json:"store_id"`
+	Status      string              `json:"status"` // 'draft', 'sent', 'partially_received', 'received' or 'cancelled'
+	Notes       *string             `json:"notes"`
+	CreatedBy   *int                `json:"created_by"`
+	CreatedAt   time.Time           `json:"created_at"`
+	SentAt      *time.Time          `json:"sent_at"`
+	ReceivedAt  *time.Time          `json:"received_at"`
+	CancelledAt *time.Time          `json:"cancelled_at"`
+	Items       []PurchaseOrderItem `json:"items"`
+}
+
+// PurchaseOrderItem represents the purchase_order_items table
+type PurchaseOrderItem struct {
+	ID               int         `json:"id"`
+	PurchaseOrderID  int         `json:"purchase_order_id"`
+	ProductID        int         `json:"product_id"`
+	QuantityOrdered  int         `json:"quantity_ordered"`
+	QuantityReceived int         `json:"quantity_received"`
+	UnitCost         money.Money `json:"unit_cost"`
+}
+
+// Stocktake represents the stocktakes table
+type Stocktake struct {
+	ID          int             `json:"id"`
+	Status      string          `json:"status"` // 'open', 'closed' or 'cancelled'
+	LocationID  int             `json:"location_id"`
+	Notes       *string         `json:"notes"`
+	OpenedBy    *int            `json:"opened_by"`
+	OpenedAt    time.Time       `json:"opened_at"`
+	ClosedBy    *int            `json:"closed_by"`
+	ClosedAt    *time.Time      `json:"closed_at"`
+	CancelledAt *time.Time      `json:"cancelled_at"`
+	Items       []StocktakeItem `json:"items"`
+}
+
+// Shift represents the shifts table: one cash drawer session on a till, from
+// the opening float to the counted close. Drawers are identified by terminal,
+// or by location for sessions not on an enrolled terminal.
+type Shift struct {
+	ID           int                 `json:"id"`
+	Status       string              `json:"status"` // 'open' or 'closed'
+	LocationID   int                 `json:"location_id"`
+	TerminalID   *int                `json:"terminal_id"`
+	OpeningFloat money.Money         `json:"opening_float"`
+	Notes        *string             `json:"notes"`
+	OpenedBy     *int                `json:"opened_by"`
+	OpenedAt     time.Time           `json:"opened_at"`
+	ClosedBy     *int                `json:"closed_by"`
+	ClosedAt     *time.Time          `json:"closed_at"`
+	CountedCash  *money.Money        `json:"counted_cash"`
+	ExpectedCash *money.Money        `json:"expected_cash"` // Fixed when the shift closes
+	OverShort    *money.Money        `json:"over_short"`    // Counted minus expected; negative is short
+	Movements    []ShiftCashMovement `json:"movements"`
+}
+
+// ShiftCashMovement represents the shift_cash_movements table: cash put into
+// (paid_in) or taken out of (paid_out) the drawer other than through sales.
+type ShiftCashMovement struct {
+	ID           int         `json:"id"`
+	ShiftID      int         `json:"shift_id"`
+	MovementType string      `json:"movement_type"` // 'paid_in' or 'paid_out'
+	Amount       money.Money `json:"amount"`
+	Reason       *string     `json:"reason"`
+	UserID       *int        `json:"user_id"`
+	CreatedAt    time.Time   `json:"created_at"`
+}
+
+// StocktakeItem represents the stocktake_items table. ExpectedQuantity is the
+// snapshot taken when the session opened; MovementsDuringCount is the net
+// ledger change between the snapshot and the product's latest count.
+type StocktakeItem struct {
+	ProductID            int    `json:"product_id"`
+	ProductName          string `json:"product_name"`
+	ExpectedQuantity     int    `json:"expected_quantity"`
+	MovementsDuringCount int    `json:"movements_during_count"`
+	CountedQuantity      *int   `json:"counted_quantity"`
+	Variance             *int   `json:"variance"` // Counted minus expected adjusted for movements; nil until counted
 }
 
 // Discount represents the discounts table
 type Discount struct {
 	ID           int        `json:"id"`
 	Code         string     `json:"code"`
+	StoreID      *int       `json:"store_id"` // nil means every store
 	Description  *string    `json:"description"`
 	DiscountType string     `json:"discount_type"` // 'percentage' or 'fixed_amount'
-	Value        float64    `json:"value"`
+	Value        float64    `json:"value"`         // Percent, or an amount for fixed_amount
 	IsActive     bool       `json:"is_active"`
 	ValidFrom    *time.Time `json:"valid_from"`
 	ValidUntil   *time.Time `json:"valid_until"`
@@ -53,28 +237,135 @@ type Discount struct {
 
 // Sale represents the sales table (transactions)
 type Sale struct {
-	ID              int        `json:"id"`
-	UserID          int        `json:"user_id"`
-	CustomerID      *int       `json:"customer_id"`
-	TotalAmount     float64    `json:"total_amount"`
-	FinalAmount     float64    `json:"final_amount"`
-	PaymentMethod   string     `json:"payment_method"`
-	TransactionTime time.Time  `json:"transaction_time"`
-	Items           []SaleItem `json:"items"`           // Used for creating a transaction
-	Discounts       []Discount `json:"discounts"`       // Used for applying discounts
+	ID              int           `json:"id"`
+	UserID          int           `json:"user_id"`
+	CashierName     *string       `json:"cashier_name,omitempty"` // Resolved from users, including deactivated ones
+	CustomerID      *int          `json:"customer_id"`
+	TotalAmount     money.Money   `json:"total_amount"`
+	FinalAmount     money.Money   `json:"final_amount"`
+	PaymentMethod   string        `json:"payment_method"`
+	StoreID         *int          `json:"store_id"`
+	LocationID      *int          `json:"location_id"` // Where the stock was taken from
+	TerminalID      *int          `json:"terminal_id"` // The till it was rung up on, if enrolled
+	ShiftID         *int          `json:"shift_id"`
+	ChangeDue       money.Money   `json:"change_due"` // Cash handed back to the customer
+	Status          string        `json:"status"`     // completed or voided
+	VoidedAt        *time.Time    `json:"voided_at,omitempty"`
+	VoidedBy        *int          `json:"voided_by,omitempty"`
+	VoidApprovedBy  *int          `json:"void_approved_by,omitempty"` // The manager who authorised the void
+	VoidReason      *string       `json:"void_reason,omitempty"`
+	TransactionTime time.Time     `json:"transaction_time"`
+	Items           []SaleItem    `json:"items"`     // Used for creating a transaction
+	Discounts       []Discount    `json:"discounts"` // Used for applying discounts
+	Payments        []SalePayment `json:"payments,omitempty"`
+	Returns         []SaleReturn  `json:"returns,omitempty"`
+}
+
+// SalePayment represents the sale_payments table: one tender towards a sale
+type SalePayment struct {
+	ID            int         `json:"id"`
+	SaleID        int         `json:"sale_id"`
+	PaymentMethod string      `json:"payment_method"`
+	Amount        money.Money `json:"amount"`   // Applied to the sale, net of any change
+	Tendered      money.Money `json:"tendered"` // As handed over by the customer
+	Reference     *string     `json:"reference"`
+	CreatedAt     time.Time   `json:"created_at"`
+}
+
+// HeldCart represents the held_carts table: a cart parked at the till to be
+// recalled and paid for later
+type HeldCart struct {
+	ID            int            `json:"id"`
+	Status        string         `json:"status"` // 'held', 'completed' or 'discarded'
+	StoreID       int            `json:"store_id"`
+	LocationID    int            `json:"location_id"`
+	TerminalID    *int           `json:"terminal_id"`
+	CustomerID    *int           `json:"customer_id"`
+	Note          *string        `json:"note"`
+	HeldBy        *int           `json:"held_by"`
+	HeldAt        time.Time      `json:"held_at"`
+	ClosedBy      *int           `json:"closed_by"`
+	ClosedAt      *time.Time     `json:"closed_at"`
+	SaleID        *int           `json:"sale_id"` // The sale it became when recalled
+	Items         []HeldCartItem `json:"items"`
+	DiscountCodes []string       `json:"discount_codes"`
+}
+
+// HeldCartItem represents the held_cart_items table
+type HeldCartItem struct {
+	ProductID int `json:"product_id"`
+	Quantity  int `json:"quantity"`
+}
+
+// SaleReturn represents the sale_returns table: goods brought back against a
+// sale and the refund paid for them
+type SaleReturn struct {
+	ID            int              `json:"id"`
+	SaleID        int              `json:"sale_id"`
+	UserID        int              `json:"user_id"`
+	StoreID       int              `json:"store_id"`
+	LocationID    int              `json:"location_id"` // Where the goods were taken back into stock
+	TerminalID    *int             `json:"terminal_id"`
+	ShiftID       *int             `json:"shift_id"`
+	RefundAmount  money.Money      `json:"refund_amount"`
+	PaymentMethod string           `json:"payment_method"` // How the refund was paid
+	Reference     *string          `json:"reference"`
+	Reason        *string          `json:"reason"`
+	CreatedAt     time.Time        `json:"created_at"`
+	Items         []SaleReturnItem `json:"items"`
+}
+
+// SaleReturnItem represents the sale_return_items table
+type SaleReturnItem struct {
+	ReturnID       int          `json:"return_id"`
+	ProductID      int          `json:"product_id"`
+	Quantity       int          `json:"quantity"`
+	PriceAtSale    money.Money  `json:"price_at_sale"`
+	CostAtSale     *money.Money `json:"cost_at_sale"`
+	DiscountAmount money.Money  `json:"discount_amount"` // The line's share of the sale's discounts
+	RefundAmount   money.Money  `json:"refund_amount"`
+	Damaged        bool         `json:"damaged"` // Written off rather than put back on sale
+}
+
+// PaymentMethod represents the payment_methods table
+type PaymentMethod struct {
+	ID           int       `json:"id"`
+	Code         string    `json:"code"` // What sales record, e.g. "cash"
+	Name         string    `json:"name"`
+	OpensDrawer  bool      `json:"opens_drawer"`  // Takings go into the till's cash drawer
+	AllowsChange bool      `json:"allows_change"` // May be overpaid, with change given back
+	IsActive     bool      `json:"is_active"`
+	CreatedAt    time.Time `json:"created_at"`
 }
 
 // SaleItem represents the sale_items table
 type SaleItem struct {
-	SaleID      int     `json:"sale_id"`
-	ProductID   int     `json:"product_id"`
-	Quantity    int     `json:"quantity"`
-	PriceAtSale float64 `json:"price_at_sale"`
+	SaleID      int          `json:"sale_id"`
+	ProductID   int          `json:"product_id"`
+	Quantity    int          `json:"quantity"`
+	PriceAtSale money.Money  `json:"price_at_sale"`
+	CostAtSale  *money.Money `json:"cost_at_sale"`
 }
 
 // AppliedDiscount represents the applied_discounts table
 type AppliedDiscount struct {
-	SaleID           int     `json:"sale_id"`
-	DiscountID       int     `json:"discount_id"`
-	AmountDiscounted float64 `json:"amount_discounted"`
-}
\ No newline at end of file
+	SaleID           int         `json:"sale_id"`
+	DiscountID       int         `json:"discount_id"`
+	AmountDiscounted money.Money `json:"amount_discounted"`
+}
+
+// AuditEntry represents the audit_log table
+type AuditEntry struct {
+	ID         int             `json:"id"`
+	UserID     *int            `json:"user_id"`
+	Username   *string         `json:"username"`
+	Method     string          `json:"method"`
+	Path       string          `json:"path"`
+	EntityType string          `json:"entity_type"`
+	EntityID   *int            `json:"entity_id"`
+	Status     int             `json:"status"`
+	Before     json.RawMessage `json:"before"`
+	After      json.RawMessage `json:"after"`
+	Diff       json.RawMessage `json:"diff"`
+	CreatedAt  time.Time       `json:"created_at"`
+}
@@ -0,0 +1,164 @@
+// Package money handles amounts as whole minor units (cents), so they add up
+// exactly. Amounts are stored as INTEGER cents and still go over JSON as
+// decimal numbers in major units, e.g. 9.99.
+package money
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Money is an amount in cents.
+type Money int64
+
+// Scale is the number of minor units in a major one.
+const Scale = 100
+
+// Parse reads a decimal amount in major units such as "9.99" or "-3". Digits
+// past the cent are rounded, halves away from zero, so "1.005" is 1.01.
+func Parse(s string) (Money, error) {
+	s = strings.TrimSpace(s)
+	if strings.ContainsAny(s, "eE") {
+		// Exponents are rare enough to go through a float; 'f' formatting never has one
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid amount %q", s)
+		}
+		s = strconv.FormatFloat(f, 'f', -1, 64)
+	}
+
+	neg := strings.HasPrefix(s, "-")
+	digits := strings.TrimPrefix(strings.TrimPrefix(s, "-"), "+")
+	whole, frac, _ := strings.Cut(digits, ".")
+	if (whole == "" && frac == "") || !isDigits(whole) || !isDigits(frac) || len(whole) > 15 {
+		return 0, fmt.Errorf("invalid amount %q", s)
+	}
+
+	var cents int64
+	for _, c := range whole {
+		cents = cents*10 + int64(c-'0')
+	}
+	frac += "000"
+	cents = cents*Scale + int64(frac[0]-'0')*10 + int64(frac[1]-'0')
+	if frac[2] >= '5' {
+		cents++
+	}
+	if neg {
+		cents = -cents
+	}
+	return Money(cents), nil
+}
+
+func isDigits(s string) bool {
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// FromFloat converts an amount in major units, rounding it to the cent the
+// way Parse does its shortest decimal form. It is for values that are still
+// floats, such as fixed-amount discounts.
+func FromFloat(f float64) Money {
+	m, err := Parse(strconv.FormatFloat(f, 'f', -1, 64))
+	if err != nil {
+		return Money(math.Round(f * Scale))
+	}
+	return m
+}
+
+// Float returns the amount in major units, for ratios such as margins.
+func (m Money) Float() float64 {
+	return float64(m) / Scale
+}
+
+// Times returns the amount for qty units.
+func (m Money) Times(qty int) Money {
+	return m * Money(qty)
+}
+
+// Percent returns pct percent of the amount, rounded to the cent with
+// halves away from zero.
+func (m Money) Percent(pct float64) Money {
+	return Money(math.Round(float64(m) * pct / 100))
+}
+
+// Share returns the amount scaled by part/whole, rounded to the cent with
+// halves away from zero. It is zero if whole is.
+func (m Money) Share(part, whole Money) Money {
+	if whole == 0 {
+		return 0
+	}
+	n, d := int64(m)*int64(part), int64(whole)
+	if d < 0 {
+		n, d = -n, -d
+	}
+	if n < 0 {
+		return Money(-((-n*2 + d) / (2 * d)))
+	}
+	return Money((n*2 + d) / (2 * d))
+}
+
+// String formats the amount in major units with two decimals, e.g. "-1.05".
+func (m Money) String() string {
+	sign := ""
+	abs := int64(m)
+	if abs < 0 {
+		sign, abs = "-", -abs
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, abs/Scale, abs%Scale)
+}
+
+// MarshalJSON writes the amount as a JSON number in major units.
+func (m Money) MarshalJSON() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+// UnmarshalJSON reads a JSON number, or a string holding one, in major units.
+func (m *Money) UnmarshalJSON(b []byte) error {
+	s := string(b)
+	if s == "null" {
+		return nil
+	}
+	if unquoted, err := strconv.Unquote(s); err == nil {
+		s = unquoted
+	}
+	v, err := Parse(s)
+	if err != nil {
+		return err
+	}
+	*m = v
+	return nil
+}
+
+// Scan reads a column of INTEGER cents. Use *Money for nullable columns.
+func (m *Money) Scan(src any) error {
+	switch v := src.(type) {
+	case int64:
+		*m = Money(v)
+	case float64:
+		// SQLite hands back REAL for some expressions over INTEGER columns
+		*m = Money(math.Round(v))
+	case []byte:
+		return m.Scan(string(v))
+	case string:
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return fmt.Errorf("money: can't scan %q", v)
+		}
+		*m = Money(n)
+	default:
+		return fmt.Errorf("money: can't scan %T", src)
+	}
+	return nil
+}
+
+// Value stores the amount as INTEGER cents.
+func (m Money) Value() (driver.Value, error) {
+	return int64(m), nil
+}
@@ -0,0 +1,121 @@
+package money
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Money
+	}{
+		{"0", 0},
+		{"9.99", 999},
+		{"12.5", 1250},
+		{"3", 300},
+		{".5", 50},
+		{"5.", 500},
+		{"-1.05", -105},
+		{"1.005", 101},
+		{"1.004", 100},
+		{"-1.005", -101},
+		{"0.335", 34},
+		{"1e2", 10000},
+		{"1.5E-1", 15},
+	}
+	for _, tt := range tests {
+		got, err := Parse(tt.in)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", tt.in, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("Parse(%q) = %d, want %d", tt.in, got, tt.want)
+		}
+	}
+
+	for _, in := range []string{"", "-", ".", "abc", "1.2.3", "1,50", "12345678901234567"} {
+		if _, err := Parse(in); err == nil {
+			t.Errorf("Parse(%q) should fail", in)
+		}
+	}
+}
+
+func TestFromFloat(t *testing.T) {
+	tests := []struct {
+		in   float64
+		want Money
+	}{
+		{3.33, 333},
+		{0.1 + 0.2, 30},
+		{1.005, 101}, // 1.005 * 100 is 100.49999... as a float
+		{26.991, 2699},
+		{-2.5, -250},
+	}
+	for _, tt := range tests {
+		if got := FromFloat(tt.in); got != tt.want {
+			t.Errorf("FromFloat(%v) = %d, want %d", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestArithmetic(t *testing.T) {
+	tests := []struct {
+		name string
+		got  Money
+		want Money
+	}{
+		{"times", Money(333).Times(3), 999},
+		{"percent", Money(2249).Percent(10), 225},
+		{"percent rounds half away from zero", Money(25).Percent(10), 3},
+		{"negative percent rounds half away from zero", Money(-25).Percent(10), -3},
+		{"share", Money(999).Share(225, 2249), 100},
+		{"share rounds half up", Money(1).Share(1, 2), 1},
+		{"share rounds half away from zero", Money(-1).Share(1, 2), -1},
+		{"share of nothing", Money(999).Share(1, 0), 0},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("%s = %d, want %d", tt.name, tt.got, tt.want)
+		}
+	}
+}
+
+func TestJSON(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Money
+		out  string
+	}{
+		{`9.99`, 999, `9.99`},
+		{`12.5`, 1250, `12.50`},
+		{`3`, 300, `3.00`},
+		{`-0.05`, -5, `-0.05`},
+		{`"4.20"`, 420, `4.20`}, // Strings are accepted too
+	}
+	for _, tt := range tests {
+		var m Money
+		if err := json.Unmarshal([]byte(tt.in), &m); err != nil {
+			t.Errorf("Unmarshal(%s): %v", tt.in, err)
+			continue
+		}
+		if m != tt.want {
+			t.Errorf("Unmarshal(%s) = %d, want %d", tt.in, m, tt.want)
+		}
+		out, err := json.Marshal(m)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(out) != tt.out {
+			t.Errorf("Marshal(%d) = %s, want %s", m, out, tt.out)
+		}
+	}
+
+	var p struct {
+		Amount *Money `json:"amount"`
+	}
+	if err := json.Unmarshal([]byte(`{"amount": null}`), &p); err != nil || p.Amount != nil {
+		t.Errorf("null should leave a *Money nil, got %v, %v", p.Amount, err)
+	}
+}
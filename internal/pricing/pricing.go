@@ -0,0 +1,132 @@
+// Package pricing works out what a cart costs and what a return refunds. It
+// does no I/O: callers look up prices, stock and discount rules and pass them
+// in, so sales, quotes, returns and held carts all agree on the maths.
+package pricing
+
+import (
+	"fmt"
+	"pos-app/internal/money"
+)
+
+// Discount types, as stored in discounts.discount_type.
+const (
+	Percentage  = "percentage"
+	FixedAmount = "fixed_amount"
+)
+
+// Item is a product in a cart at its current price.
+type Item struct {
+	ProductID int
+	Name      string
+	Quantity  int
+	UnitPrice money.Money
+	Available int // Stock on hand where the cart is being sold
+}
+
+type Cart struct {
+	Items []Item
+}
+
+// Rule is a discount to apply to a cart.
+type Rule struct {
+	DiscountID int
+	Code       string
+	Type       string  // Percentage or FixedAmount
+	Value      float64 // Percent, or major units for FixedAmount
+}
+
+type Line struct {
+	ProductID int         `json:"product_id"`
+	Name      string      `json:"name"`
+	Quantity  int         `json:"quantity"`
+	UnitPrice money.Money `json:"unit_price"`
+	LineTotal money.Money `json:"line_total"`
+	Available int         `json:"available"`
+}
+
+type Discount struct {
+	DiscountID   int         `json:"discount_id"`
+	Code         string      `json:"code"`
+	DiscountType string      `json:"discount_type"`
+	Value        float64     `json:"value"`
+	Amount       money.Money `json:"amount"`
+}
+
+// Breakdown is a priced cart. DiscountAmount is the sum of the discounts'
+// amounts, and TotalAmount less DiscountAmount is FinalAmount.
+type Breakdown struct {
+	Lines          []Line      `json:"lines"`
+	Discounts      []Discount  `json:"discounts"`
+	TotalAmount    money.Money `json:"total_amount"`
+	DiscountAmount money.Money `json:"discount_amount"`
+	FinalAmount    money.Money `json:"final_amount"`
+}
+
+// Price prices a cart and applies the rules in order. Each discount is
+// rounded to the cent, halves away from zero. Percentages are taken off the
+// cart's total before any discounts, so stacking them doesn't compound.
+// Discounts never take the total below zero: the one that would is cut short
+// and any after it come to nothing. Totals are floored at zero too, so a cart
+// that somehow holds a negative quantity can't price as money owed back.
+func Price(cart Cart, rules []Rule) Breakdown {
+	b := Breakdown{Lines: []Line{}, Discounts: []Discount{}}
+	for _, it := range cart.Items {
+		line := Line{
+			ProductID: it.ProductID,
+			Name:      it.Name,
+			Quantity:  it.Quantity,
+			UnitPrice: it.UnitPrice,
+			LineTotal: it.UnitPrice.Times(it.Quantity),
+			Available: it.Available,
+		}
+		b.TotalAmount += line.LineTotal
+		b.Lines = append(b.Lines, line)
+	}
+	b.TotalAmount = max(0, b.TotalAmount)
+
+	remaining := b.TotalAmount
+	for _, rule := range rules {
+		var amount money.Money
+		if rule.Type == Percentage {
+			amount = b.TotalAmount.Percent(rule.Value)
+		} else {
+			amount = money.FromFloat(rule.Value)
+		}
+		amount = max(0, min(amount, remaining))
+		remaining -= amount
+		b.DiscountAmount += amount
+		b.Discounts = append(b.Discounts, Discount{
+			DiscountID:   rule.DiscountID,
+			Code:         rule.Code,
+			DiscountType: rule.Type,
+			Value:        rule.Value,
+			Amount:       amount,
+		})
+	}
+	b.FinalAmount = max(0, remaining)
+	return b
+}
+
+// ShortageError reports a product the cart wants more of than is in stock.
+type ShortageError struct {
+	ProductID int
+	Available int
+	Requested int
+}
+
+func (e *ShortageError) Error() string {
+	return fmt.Sprintf("Not enough stock for product ID %d. Available: %d, Requested: %d", e.ProductID, e.Available, e.Requested)
+}
+
+// CheckStock returns a *ShortageError for the first product the cart wants
+// more of than is available, counting every line it appears on.
+func CheckStock(cart Cart) error {
+	requested := map[int]int{}
+	for _, it := range cart.Items {
+		requested[it.ProductID] += it.Quantity
+		if requested[it.ProductID] > it.Available {
+			return &ShortageError{ProductID: it.ProductID, Available: it.Available, Requested: requested[it.ProductID]}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,323 @@
+package pricing
+
+import (
+	"pos-app/internal/money"
+	"testing"
+)
+
+func TestPrice(t *testing.T) {
+	tea := Item{ProductID: 1, Quantity: 3, UnitPrice: 333, Available: 10}
+	cake := Item{ProductID: 2, Quantity: 1, UnitPrice: 1250, Available: 10}
+	tenPercent := Rule{DiscountID: 1, Code: "TEN", Type: Percentage, Value: 10}
+	fivePercent := Rule{DiscountID: 2, Code: "FIVE", Type: Percentage, Value: 5}
+	fiveOff := Rule{DiscountID: 3, Code: "FIVEOFF", Type: FixedAmount, Value: 5}
+	twentyOff := Rule{DiscountID: 4, Code: "TWENTYOFF", Type: FixedAmount, Value: 20}
+
+	tests := []struct {
+		name      string
+		cart      Cart
+		rules     []Rule
+		lines     []money.Money
+		discounts []money.Money
+		total     money.Money
+		final     money.Money
+	}{
+		{
+			name:  "empty cart",
+			total: 0,
+			final: 0,
+		},
+		{
+			name:  "no discounts",
+			cart:  Cart{Items: []Item{tea, cake}},
+			lines: []money.Money{999, 1250},
+			total: 2249,
+			final: 2249,
+		},
+		{
+			name:      "half a cent is rounded away from zero",
+			cart:      Cart{Items: []Item{{ProductID: 3, Quantity: 1, UnitPrice: 25}}},
+			rules:     []Rule{tenPercent},
+			lines:     []money.Money{25},
+			discounts: []money.Money{3},
+			total:     25,
+			final:     22,
+		},
+		{
+			name:      "fixed amounts are rounded to the cent",
+			cart:      Cart{Items: []Item{cake}},
+			rules:     []Rule{{DiscountID: 7, Code: "ODD", Type: FixedAmount, Value: 1.005}},
+			lines:     []money.Money{1250},
+			discounts: []money.Money{101},
+			total:     1250,
+			final:     1149,
+		},
+		{
+			name:      "percentages are rounded to cents",
+			cart:      Cart{Items: []Item{tea}},
+			rules:     []Rule{tenPercent},
+			lines:     []money.Money{999},
+			discounts: []money.Money{100},
+			total:     999,
+			final:     899,
+		},
+		{
+			name:      "stacked percentages are each taken off the undiscounted total",
+			cart:      Cart{Items: []Item{tea, cake}},
+			rules:     []Rule{tenPercent, fivePercent},
+			lines:     []money.Money{999, 1250},
+			discounts: []money.Money{225, 112},
+			total:     2249,
+			final:     1912,
+		},
+		{
+			name:      "percentage and fixed stack",
+			cart:      Cart{Items: []Item{tea, cake}},
+			rules:     []Rule{fiveOff, tenPercent},
+			lines:     []money.Money{999, 1250},
+			discounts: []money.Money{500, 225},
+			total:     2249,
+			final:     1524,
+		},
+		{
+			name:      "a fixed amount larger than the cart stops at zero",
+			cart:      Cart{Items: []Item{tea}},
+			rules:     []Rule{twentyOff},
+			lines:     []money.Money{999},
+			discounts: []money.Money{999},
+			total:     999,
+			final:     0,
+		},
+		{
+			name:      "discounts after the total reaches zero come to nothing",
+			cart:      Cart{Items: []Item{tea}},
+			rules:     []Rule{fiveOff, fiveOff, tenPercent},
+			lines:     []money.Money{999},
+			discounts: []money.Money{500, 499, 0},
+			total:     999,
+			final:     0,
+		},
+		{
+			name:      "over 100 percent stops at zero",
+			cart:      Cart{Items: []Item{cake}},
+			rules:     []Rule{{DiscountID: 5, Code: "ALL", Type: Percentage, Value: 150}},
+			lines:     []money.Money{1250},
+			discounts: []money.Money{1250},
+			total:     1250,
+			final:     0,
+		},
+		{
+			name:      "negative discounts don't add to the total",
+			cart:      Cart{Items: []Item{cake}},
+			rules:     []Rule{{DiscountID: 6, Code: "NEG", Type: FixedAmount, Value: -3}},
+			lines:     []money.Money{1250},
+			discounts: []money.Money{0},
+			total:     1250,
+			final:     1250,
+		},
+		{
+			name:  "a negative quantity floors the totals at zero",
+			cart:  Cart{Items: []Item{{ProductID: 1, Quantity: -5, UnitPrice: 333}}},
+			lines: []money.Money{-1665},
+			total: 0,
+			final: 0,
+		},
+		{
+			name:      "a negative line can't take a cart below zero",
+			cart:      Cart{Items: []Item{cake, {ProductID: 1, Quantity: -5, UnitPrice: 333}}},
+			rules:     []Rule{fiveOff},
+			lines:     []money.Money{1250, -1665},
+			discounts: []money.Money{0},
+			total:     0,
+			final:     0,
+		},
+		{
+			name:      "a zero quantity comes to nothing",
+			cart:      Cart{Items: []Item{{ProductID: 1, Quantity: 0, UnitPrice: 333}}},
+			rules:     []Rule{tenPercent},
+			lines:     []money.Money{0},
+			discounts: []money.Money{0},
+			total:     0,
+			final:     0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := Price(tt.cart, tt.rules)
+
+			if len(b.Lines) != len(tt.lines) {
+				t.Fatalf("got %d lines, want %d", len(b.Lines), len(tt.lines))
+			}
+			for i, want := range tt.lines {
+				if b.Lines[i].LineTotal != want {
+					t.Errorf("line %d total = %v, want %v", i, b.Lines[i].LineTotal, want)
+				}
+			}
+			if len(b.Discounts) != len(tt.discounts) {
+				t.Fatalf("got %d discounts, want %d", len(b.Discounts), len(tt.discounts))
+			}
+			var sum money.Money
+			for i, want := range tt.discounts {
+				if b.Discounts[i].Amount != want {
+					t.Errorf("discount %d amount = %v, want %v", i, b.Discounts[i].Amount, want)
+				}
+				sum += b.Discounts[i].Amount
+			}
+			if b.TotalAmount != tt.total {
+				t.Errorf("TotalAmount = %v, want %v", b.TotalAmount, tt.total)
+			}
+			if b.FinalAmount != tt.final {
+				t.Errorf("FinalAmount = %v, want %v", b.FinalAmount, tt.final)
+			}
+			if b.DiscountAmount != sum || b.TotalAmount-b.DiscountAmount != b.FinalAmount {
+				t.Errorf("DiscountAmount = %v; discounts sum to %v and total less final is %v",
+					b.DiscountAmount, sum, b.TotalAmount-b.FinalAmount)
+			}
+		})
+	}
+}
+
+func TestCheckStock(t *testing.T) {
+	tests := []struct {
+		name  string
+		items []Item
+		short *ShortageError
+	}{
+		{
+			name:  "enough stock",
+			items: []Item{{ProductID: 1, Quantity: 5, Available: 5}},
+		},
+		{
+			name:  "one line short",
+			items: []Item{{ProductID: 1, Quantity: 6, Available: 5}},
+			short: &ShortageError{ProductID: 1, Available: 5, Requested: 6},
+		},
+		{
+			name: "lines for the same product are added up",
+			items: []Item{
+				{ProductID: 1, Quantity: 3, Available: 5},
+				{ProductID: 2, Quantity: 1, Available: 1},
+				{ProductID: 1, Quantity: 3, Available: 5},
+			},
+			short: &ShortageError{ProductID: 1, Available: 5, Requested: 6},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := CheckStock(Cart{Items: tt.items})
+			if tt.short == nil {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			short, ok := err.(*ShortageError)
+			if !ok {
+				t.Fatalf("got %v, want a *ShortageError", err)
+			}
+			if *short != *tt.short {
+				t.Errorf("got %+v, want %+v", *short, *tt.short)
+			}
+		})
+	}
+}
+
+func TestPriceReturn(t *testing.T) {
+	tests := []struct {
+		name     string
+		sale     Sold
+		items    []ReturnItem
+		discount []money.Money
+		refund   []money.Money
+		amount   money.Money
+	}{
+		{
+			name:     "undiscounted sale",
+			sale:     Sold{TotalAmount: 2249, FinalAmount: 2249},
+			items:    []ReturnItem{{ProductID: 1, Quantity: 3, PriceAtSale: 333}},
+			discount: []money.Money{0},
+			refund:   []money.Money{999},
+			amount:   999,
+		},
+		{
+			name:     "discount is shared in proportion and rounded",
+			sale:     Sold{TotalAmount: 2249, DiscountAmount: 225, FinalAmount: 2024},
+			items:    []ReturnItem{{ProductID: 1, Quantity: 3, PriceAtSale: 333}},
+			discount: []money.Money{100},
+			refund:   []money.Money{899},
+			amount:   899,
+		},
+		{
+			name:     "discounts recorded above the total count as the whole total",
+			sale:     Sold{TotalAmount: 999, DiscountAmount: 2000, FinalAmount: 0},
+			items:    []ReturnItem{{ProductID: 1, Quantity: 3, PriceAtSale: 333}},
+			discount: []money.Money{999},
+			refund:   []money.Money{0},
+			amount:   0,
+		},
+		{
+			name: "a third off is shared to the cent",
+			sale: Sold{TotalAmount: 300, DiscountAmount: 100, FinalAmount: 200, Refunded: 133},
+			items: []ReturnItem{
+				{ProductID: 1, Quantity: 1, PriceAtSale: 100},
+			},
+			discount: []money.Money{33},
+			refund:   []money.Money{67},
+			amount:   67,
+		},
+		{
+			name:     "the cap on what is left wins over the lines",
+			sale:     Sold{TotalAmount: 1000, FinalAmount: 1000, Refunded: 950},
+			items:    []ReturnItem{{ProductID: 1, Quantity: 1, PriceAtSale: 100}},
+			discount: []money.Money{0},
+			refund:   []money.Money{50},
+			amount:   50,
+		},
+		{
+			name: "the cap trims the last lines first",
+			sale: Sold{TotalAmount: 1000, FinalAmount: 1000, Refunded: 880},
+			items: []ReturnItem{
+				{ProductID: 1, Quantity: 1, PriceAtSale: 100},
+				{ProductID: 2, Quantity: 1, PriceAtSale: 30},
+			},
+			discount: []money.Money{0, 0},
+			refund:   []money.Money{100, 20},
+			amount:   120,
+		},
+		{
+			name:     "nothing left to refund",
+			sale:     Sold{TotalAmount: 1000, FinalAmount: 1000, Refunded: 1000},
+			items:    []ReturnItem{{ProductID: 1, Quantity: 1, PriceAtSale: 100}},
+			discount: []money.Money{0},
+			refund:   []money.Money{0},
+			amount:   0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := PriceReturn(tt.sale, tt.items)
+			if len(r.Lines) != len(tt.items) {
+				t.Fatalf("got %d lines, want %d", len(r.Lines), len(tt.items))
+			}
+			var sum money.Money
+			for i := range r.Lines {
+				sum += r.Lines[i].RefundAmount
+				if r.Lines[i].DiscountAmount != tt.discount[i] {
+					t.Errorf("line %d discount = %v, want %v", i, r.Lines[i].DiscountAmount, tt.discount[i])
+				}
+				if r.Lines[i].RefundAmount != tt.refund[i] {
+					t.Errorf("line %d refund = %v, want %v", i, r.Lines[i].RefundAmount, tt.refund[i])
+				}
+			}
+			if r.Amount != tt.amount {
+				t.Errorf("Amount = %v, want %v", r.Amount, tt.amount)
+			}
+			if sum != r.Amount {
+				t.Errorf("line refunds sum to %v, want the Amount %v", sum, r.Amount)
+			}
+		})
+	}
+}
@@ -0,0 +1,58 @@
+package pricing
+
+import "pos-app/internal/money"
+
+// Sold is what a sale charged, and how much of it has been refunded so far.
+type Sold struct {
+	TotalAmount    money.Money // Before discounts
+	DiscountAmount money.Money
+	FinalAmount    money.Money
+	Refunded       money.Money
+}
+
+// ReturnItem is goods taken back, at the price they were sold for.
+type ReturnItem struct {
+	ProductID   int
+	Quantity    int
+	PriceAtSale money.Money
+}
+
+type RefundLine struct {
+	ProductID      int
+	Quantity       int
+	DiscountAmount money.Money // The line's share of the sale's discounts
+	RefundAmount   money.Money
+}
+
+type Refund struct {
+	Lines  []RefundLine
+	Amount money.Money
+}
+
+// PriceReturn works out the refund for goods taken back against a sale. Each
+// line gets a share of the sale's discounts in proportion to its value,
+// rounded to the cent with halves away from zero. The refund is capped at
+// what is left of the sale's final amount, so rounding can never pay back
+// more than was paid; when the cap applies, line refunds are trimmed, last
+// line first, so they still add up to the refund.
+func PriceReturn(sale Sold, items []ReturnItem) Refund {
+	discounted := min(sale.DiscountAmount, sale.TotalAmount)
+
+	refund := Refund{Lines: []RefundLine{}}
+	for _, it := range items {
+		value := it.PriceAtSale.Times(it.Quantity)
+		line := RefundLine{ProductID: it.ProductID, Quantity: it.Quantity, DiscountAmount: value.Share(discounted, sale.TotalAmount)}
+		line.RefundAmount = value - line.DiscountAmount
+		refund.Amount += line.RefundAmount
+		refund.Lines = append(refund.Lines, line)
+	}
+	capped := max(0, min(refund.Amount, sale.FinalAmount-sale.Refunded))
+	excess := refund.Amount - capped
+	for i := len(refund.Lines) - 1; i >= 0 && excess > 0; i-- {
+		trim := min(excess, refund.Lines[i].RefundAmount)
+		refund.Lines[i].RefundAmount -= trim
+		excess -= trim
+	}
+	refund.Amount = capped
+	return refund
+}
@@ -4,13 +4,17 @@ import (
 	"database/sql"
 	"net/http"
 	"os"
+	"pos-app/internal/audit"
+	"pos-app/internal/auth"
+	"pos-app/internal/events"
 	"pos-app/internal/handler"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 )
 
-func SetupRouter(db *sql.DB) *chi.Mux {
+func SetupRouter(db *sql.DB, sessions *auth.Sessions, bus *events.Bus, voidWindow time.Duration) *chi.Mux {
 	r := chi.NewRouter()
 
 	// Middleware
@@ -18,59 +22,246 @@ func SetupRouter(db *sql.DB) *chi.Mux {
 	r.Use(middleware.Recoverer)
 
 	// Handlers
-	productHandler := &handler.ProductHandler{DB: db}
+	productHandler := &handler.ProductHandler{DB: db, Events: bus}
 	customerHandler := &handler.CustomerHandler{DB: db}
 	discountHandler := &handler.DiscountHandler{DB: db}
-	transactionHandler := &handler.TransactionHandler{DB: db}
-	userHandler := &handler.UserHandler{DB: db}
+	transactionHandler := &handler.TransactionHandler{DB: db, Events: bus, VoidWindow: voidWindow}
+	userHandler := &handler.UserHandler{DB: db, Sessions: sessions}
 	reportHandler := &handler.ReportHandler{DB: db}
+	authHandler := &handler.AuthHandler{DB: db, Sessions: sessions}
+	auditHandler := &handler.AuditHandler{DB: db}
+	inventoryHandler := &handler.InventoryHandler{DB: db, Events: bus}
+	supplierHandler := &handler.SupplierHandler{DB: db}
+	purchaseOrderHandler := &handler.PurchaseOrderHandler{DB: db}
+	stocktakeHandler := &handler.StocktakeHandler{DB: db, Events: bus}
+	storeHandler := &handler.StoreHandler{DB: db}
+	terminalHandler := &handler.TerminalHandler{DB: db, Sessions: sessions}
+	shiftHandler := &handler.ShiftHandler{DB: db}
+	paymentMethodHandler := &handler.PaymentMethodHandler{DB: db}
+	heldCartHandler := &handler.HeldCartHandler{DB: db, Events: bus}
+	locationHandler := &handler.LocationHandler{DB: db}
+	transferHandler := &handler.TransferHandler{DB: db, Events: bus}
+	auditRecorder := &audit.Recorder{DB: db, ReadOnly: map[string]bool{
+		"POST /api/sales/quote": true,
+	}}
 
 	// API routes
 	r.Route("/api", func(r chi.Router) {
-		// Product routes
-		r.Route("/products", func(r chi.Router) {
-			r.Get("/", productHandler.GetProducts)
-			r.Post("/", productHandler.CreateProduct)
-			r.Get("/{id}", productHandler.GetProduct)
-			r.Put("/{id}", productHandler.UpdateProduct)
-			r.Delete("/{id}", productHandler.DeleteProduct)
-		})
+		// Public routes
+		r.Post("/auth/login", authHandler.Login)
+		r.Get("/auth/bootstrap", authHandler.BootstrapStatus)
+		r.Post("/auth/bootstrap", authHandler.Bootstrap)
+		r.Post("/terminals/enrol", terminalHandler.EnrolTerminal)
 
-		// Customer routes
-		r.Route("/customers", func(r chi.Router) {
-			r.Get("/", customerHandler.GetCustomers)
-			r.Post("/", customerHandler.CreateCustomer)
-			r.Get("/{id}", customerHandler.GetCustomer)
-			r.Put("/{id}", customerHandler.UpdateCustomer)
-			r.Delete("/{id}", customerHandler.DeleteCustomer)
-		})
+		// Everything below requires a valid session token
+		r.Group(func(r chi.Router) {
+			r.Use(sessions.Middleware)
+			r.Use(auditRecorder.Middleware)
 
-		// Discount routes
-		r.Route("/discounts", func(r chi.Router) {
-			r.Get("/", discountHandler.GetDiscounts)
-			r.Post("/", discountHandler.CreateDiscount)
-			r.Get("/{id}", discountHandler.GetDiscount)
-			r.Put("/{id}", discountHandler.UpdateDiscount)
-			r.Delete("/{id}", discountHandler.DeleteDiscount)
-		})
+			// Auth routes
+			r.Post("/auth/logout", authHandler.Logout)
+			r.Get("/auth/me", authHandler.Me)
+			r.Put("/auth/pin", authHandler.SetPIN)
+			r.Post("/auth/pin", authHandler.SwitchCashier)
 
-		// Sales (Transaction) routes
-		r.Route("/sales", func(r chi.Router) {
-			r.Post("/", transactionHandler.CreateSale)
-			r.Get("/", transactionHandler.GetSales)
-			r.Get("/{id}", transactionHandler.GetSale)
-		})
+			// Product routes
+			r.Route("/products", func(r chi.Router) {
+				r.Get("/", productHandler.GetProducts)
+				r.Get("/{id}", productHandler.GetProduct)
+				r.Get("/{id}/movements", inventoryHandler.GetProductMovements)
+				r.With(auth.Require(auth.PermInventoryAdjust)).Post("/{id}/stock-adjustments", inventoryHandler.CreateStockAdjustment)
 
-		// User routes
-		r.Route("/users", func(r chi.Router) {
-			r.Post("/register", userHandler.RegisterUser)
-			r.Get("/", userHandler.GetUsers)
-			r.Delete("/{id}", userHandler.DeleteUser)
-		})
+				r.Group(func(r chi.Router) {
+					r.Use(auth.Require(auth.PermProductsWrite))
+					r.Post("/", productHandler.CreateProduct)
+					r.Put("/{id}", productHandler.UpdateProduct)
+					r.Delete("/{id}", productHandler.DeleteProduct)
+				})
+			})
+
+			// Inventory routes
+			r.Route("/inventory", func(r chi.Router) {
+				r.Get("/low-stock", inventoryHandler.GetLowStock)
+				r.With(auth.Require(auth.PermReportsRead)).Get("/reconciliation", inventoryHandler.GetReconciliation)
+			})
+
+			// Store routes
+			r.Route("/stores", func(r chi.Router) {
+				r.Get("/", storeHandler.GetStores)
+
+				r.Group(func(r chi.Router) {
+					r.Use(auth.Require(auth.PermStoresAdmin))
+					r.Post("/", storeHandler.CreateStore)
+					r.Put("/{id}", storeHandler.UpdateStore)
+				})
+			})
+
+			// Terminal routes
+			r.Route("/terminals", func(r chi.Router) {
+				r.Use(auth.Require(auth.PermTerminalsManage))
+				r.Get("/", terminalHandler.GetTerminals)
+				r.Post("/", terminalHandler.CreateTerminal)
+				r.Put("/{id}", terminalHandler.UpdateTerminal)
+				r.Post("/{id}/enrolment-code", terminalHandler.ReissueEnrolmentCode)
+			})
+
+			// Location routes
+			r.Route("/locations", func(r chi.Router) {
+				r.Get("/", locationHandler.GetLocations)
+				r.Get("/{id}/stock", locationHandler.GetLocationStock)
+
+				r.Group(func(r chi.Router) {
+					r.Use(auth.Require(auth.PermInventoryAdjust))
+					r.Post("/", locationHandler.CreateLocation)
+					r.Put("/{id}", locationHandler.UpdateLocation)
+				})
+			})
+
+			// Stock transfer routes
+			r.Route("/transfers", func(r chi.Router) {
+				r.Use(auth.Require(auth.PermInventoryAdjust))
+				r.Get("/", transferHandler.GetTransfers)
+				r.Post("/", transferHandler.CreateTransfer)
+				r.Get("/{id}", transferHandler.GetTransfer)
+				r.Post("/{id}/receive", transferHandler.ReceiveTransfer)
+				r.Post("/{id}/cancel", transferHandler.CancelTransfer)
+			})
+
+			// Stocktake routes
+			r.Route("/stocktakes", func(r chi.Router) {
+				r.Use(auth.Require(auth.PermInventoryAdjust))
+				r.Get("/", stocktakeHandler.GetStocktakes)
+				r.Post("/", stocktakeHandler.OpenStocktake)
+				r.Get("/{id}", stocktakeHandler.GetStocktake)
+				r.Post("/{id}/counts", stocktakeHandler.SubmitStocktakeCounts)
+				r.Post("/{id}/close", stocktakeHandler.CloseStocktake)
+				r.Post("/{id}/cancel", stocktakeHandler.CancelStocktake)
+			})
+
+			// Supplier routes
+			r.Route("/suppliers", func(r chi.Router) {
+				r.Use(auth.Require(auth.PermPurchasing))
+				r.Get("/", supplierHandler.GetSuppliers)
+				r.Post("/", supplierHandler.CreateSupplier)
+				r.Get("/{id}", supplierHandler.GetSupplier)
+				r.Put("/{id}", supplierHandler.UpdateSupplier)
+				r.Delete("/{id}", supplierHandler.DeleteSupplier)
+			})
+
+			// Purchase order routes
+			r.Route("/purchase-orders", func(r chi.Router) {
+				r.Use(auth.Require(auth.PermPurchasing))
+				r.Get("/", purchaseOrderHandler.GetPurchaseOrders)
+				r.Post("/", purchaseOrderHandler.CreatePurchaseOrder)
+				r.Get("/{id}", purchaseOrderHandler.GetPurchaseOrder)
+				r.Put("/{id}", purchaseOrderHandler.UpdatePurchaseOrder)
+				r.Post("/{id}/send", purchaseOrderHandler.SendPurchaseOrder)
+				r.Post("/{id}/receive", purchaseOrderHandler.ReceivePurchaseOrder)
+				r.Post("/{id}/cancel", purchaseOrderHandler.CancelPurchaseOrder)
+			})
+
+			// Customer routes
+			r.Route("/customers", func(r chi.Router) {
+				r.Get("/", customerHandler.GetCustomers)
+				r.Get("/{id}", customerHandler.GetCustomer)
+
+				r.Group(func(r chi.Router) {
+					r.Use(auth.Require(auth.PermCustomersWrite))
+					r.Post("/", customerHandler.CreateCustomer)
+					r.Put("/{id}", customerHandler.UpdateCustomer)
+				})
+
+				r.With(auth.Require(auth.PermCustomersDelete)).Delete("/{id}", customerHandler.DeleteCustomer)
+			})
+
+			// Discount routes
+			r.Route("/discounts", func(r chi.Router) {
+				r.Get("/", discountHandler.GetDiscounts)
+				r.Get("/{id}", discountHandler.GetDiscount)
+
+				r.Group(func(r chi.Router) {
+					r.Use(auth.Require(auth.PermDiscountsWrite))
+					r.Post("/", discountHandler.CreateDiscount)
+					r.Put("/{id}", discountHandler.UpdateDiscount)
+					r.Delete("/{id}", discountHandler.DeleteDiscount)
+				})
+			})
+
+			// Payment method routes
+			r.Route("/payment-methods", func(r chi.Router) {
+				r.Get("/", paymentMethodHandler.GetPaymentMethods)
+
+				r.Group(func(r chi.Router) {
+					r.Use(auth.Require(auth.PermPaymentsAdmin))
+					r.Post("/", paymentMethodHandler.CreatePaymentMethod)
+					r.Put("/{id}", paymentMethodHandler.UpdatePaymentMethod)
+				})
+			})
+
+			// Cash drawer shift routes
+			r.Route("/shifts", func(r chi.Router) {
+				r.Group(func(r chi.Router) {
+					r.Use(auth.Require(auth.PermSalesCreate))
+					r.Post("/", shiftHandler.OpenShift)
+					r.Post("/{id}/cash-movements", shiftHandler.AddCashMovement)
+					r.Post("/{id}/close", shiftHandler.CloseShift)
+				})
+
+				r.Group(func(r chi.Router) {
+					r.Use(auth.Require(auth.PermSalesRead))
+					r.Get("/", shiftHandler.GetShifts)
+					r.Get("/current", shiftHandler.GetCurrentShift)
+					r.Get("/{id}", shiftHandler.GetShift)
+					r.Get("/{id}/z-report", shiftHandler.GetZReport)
+				})
+			})
+
+			// Sales (Transaction) routes
+			r.Route("/sales", func(r chi.Router) {
+				r.With(auth.Require(auth.PermSalesCreate)).Post("/", transactionHandler.CreateSale)
+				r.With(auth.Require(auth.PermSalesCreate)).Post("/quote", transactionHandler.QuoteSale)
+				r.With(auth.Require(auth.PermSalesRefund)).Post("/{id}/returns", transactionHandler.CreateReturn)
+				// The approving manager's credentials are checked by the handler
+				r.With(auth.Require(auth.PermSalesCreate)).Post("/{id}/void", transactionHandler.VoidSale)
+
+				r.Group(func(r chi.Router) {
+					r.Use(auth.Require(auth.PermSalesRead))
+					r.Get("/", transactionHandler.GetSales)
+					r.Get("/{id}", transactionHandler.GetSale)
+				})
+			})
+
+			// Held (parked) cart routes
+			r.Route("/held-carts", func(r chi.Router) {
+				r.Use(auth.Require(auth.PermSalesCreate))
+				r.Get("/", heldCartHandler.GetHeldCarts)
+				r.Post("/", heldCartHandler.HoldCart)
+				r.Get("/{id}", heldCartHandler.GetHeldCart)
+				r.Post("/{id}/recall", heldCartHandler.RecallCart)
+				r.Delete("/{id}", heldCartHandler.DiscardCart)
+			})
+
+			// User routes
+			r.Route("/users", func(r chi.Router) {
+				r.Use(auth.Require(auth.PermUsersAdmin))
+				r.Post("/register", userHandler.RegisterUser)
+				r.Get("/", userHandler.GetUsers)
+				r.Put("/{id}/role", userHandler.UpdateUserRole)
+				r.Put("/{id}/password", userHandler.ResetUserPassword)
+				r.Post("/{id}/deactivate", userHandler.DeactivateUser)
+				r.Post("/{id}/reactivate", userHandler.ReactivateUser)
+				r.Delete("/{id}", userHandler.DeleteUser)
+			})
+
+			// Report routes
+			r.Route("/reports", func(r chi.Router) {
+				r.Use(auth.Require(auth.PermReportsRead))
+				r.Get("/sales", reportHandler.GetSalesReport)
+				r.Get("/exceptions", reportHandler.GetExceptionsReport)
+			})
 
-		// Report routes
-		r.Route("/reports", func(r chi.Router) {
-			r.Get("/sales", reportHandler.GetSalesReport)
+			// Audit log routes
+			r.With(auth.Require(auth.PermAuditRead)).Get("/audit", auditHandler.GetAuditLog)
 		})
 	})
 
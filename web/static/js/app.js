@@ -1,7 +1,7 @@
 document.addEventListener('DOMContentLoaded', () => {
     // Check login status on load
     const loggedInUserId = localStorage.getItem('loggedInUserId');
-    if (loggedInUserId) {
+    if (loggedInUserId && localStorage.getItem('sessionToken')) {
         document.getElementById('user-id-display').textContent = loggedInUserId;
         showPage('pos'); // Default to POS page if logged in
     } else {
@@ -10,6 +10,24 @@ document.addEventListener('DOMContentLoaded', () => {
 });
 
 const API_BASE_URL = '/api';
+
+// Attach the session token to every API call and send the user back to the
+// login page when the session has expired or been revoked.
+const nativeFetch = window.fetch.bind(window);
+window.fetch = async (url, options = {}) => {
+    const token = localStorage.getItem('sessionToken');
+    if (token && String(url).startsWith(API_BASE_URL)) {
+        options = { ...options, headers: { ...(options.headers || {}), Authorization: `Bearer ${token}` } };
+    }
+    const response = await nativeFetch(url, options);
+    if (response.status === 401 && token) {
+        localStorage.removeItem('sessionToken');
+        localStorage.removeItem('loggedInUserId');
+        document.getElementById('user-id-display').textContent = 'None';
+        showPage('login');
+    }
+    return response;
+};
 const contentContainer = document.getElementById('app-content');
 
 function showPage(page) {
@@ -17,6 +35,7 @@ function showPage(page) {
     switch (page) {
         case 'login':
             contentContainer.innerHTML = getLoginPageHTML();
+            checkSetupRequired();
             break;
         case 'pos':
             contentContainer.innerHTML = getPosPageHTML();
@@ -56,13 +75,12 @@ function getLoginPageHTML() {
         <div class="page-content">
             <h2>Login</h2>
             <form onsubmit="handleLogin(event)">
-                <p>Since this is a lightweight demo without full authentication, please enter your User ID to 'log in'.</p>
-                <p>You can create a user via the API or assume User ID 1 exists.</p>
-                <input type="number" id="login-user-id" placeholder="Enter User ID" required>
+                <input type="text" id="login-username" placeholder="Username" required>
+                <input type="password" id="login-password" placeholder="Password" required>
                 <button type="submit">Login</button>
             </form>
-            <h2>Register New User</h2>
-            <form onsubmit="handleRegister(event)">
+            <h2 class="setup-only" style="display: none;">Create Admin Account</h2>
+            <form class="setup-only" style="display: none;" onsubmit="handleSetup(event)">
                 <input type="text" id="register-username" placeholder="Username" required>
                 <input type="password" id="register-password" placeholder="Password" required>
                 <button type="submit">Register</button>
@@ -73,36 +91,67 @@ function getLoginPageHTML() {
 
 async function handleLogin(event) {
     event.preventDefault();
-    const userId = document.getElementById('login-user-id').value;
-    if (userId) {
-        localStorage.setItem('loggedInUserId', userId);
-        document.getElementById('user-id-display').textContent = userId;
+    const username = document.getElementById('login-username').value;
+    const password = document.getElementById('login-password').value;
+
+    try {
+        const response = await fetch(`${API_BASE_URL}/auth/login`, {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify({ username, password })
+        });
+
+        if (!response.ok) {
+            const errorText = await response.text();
+            throw new Error(`Login failed: ${errorText}`);
+        }
+
+        const result = await response.json();
+        localStorage.setItem('sessionToken', result.token);
+        localStorage.setItem('loggedInUserId', result.user.id);
+        document.getElementById('user-id-display').textContent = result.user.id;
         showPage('pos');
+    } catch (error) {
+        console.error('Login error:', error);
+        alert(error.message);
+    }
+}
+
+// The setup form is only shown on a fresh install, before any user exists.
+async function checkSetupRequired() {
+    try {
+        const response = await fetch(`${API_BASE_URL}/auth/bootstrap`);
+        if (!response.ok) return;
+        const status = await response.json();
+        if (status.required) {
+            document.querySelectorAll('.setup-only').forEach(el => el.style.display = '');
+        }
+    } catch (error) {
+        console.error('Setup check error:', error);
     }
 }
 
-async function handleRegister(event) {
+async function handleSetup(event) {
     event.preventDefault();
     const username = document.getElementById('register-username').value;
     const password = document.getElementById('register-password').value;
 
     try {
-        const response = await fetch(`${API_BASE_URL}/users/register`, {
+        const response = await fetch(`${API_BASE_URL}/auth/bootstrap`, {
             method: 'POST',
             headers: { 'Content-Type': 'application/json' },
-            body: JSON.stringify({ username, password, role: 'cashier' })
+            body: JSON.stringify({ username, password })
         });
 
         if (!response.ok) {
             const errorText = await response.text();
-            throw new Error(`Registration failed: ${errorText}`);
+            throw new Error(`Setup failed: ${errorText}`);
         }
 
-        const result = await response.json();
-        alert(`User registered successfully! Your new User ID is: ${result.user_id}. Please log in with it.`);
+        alert('Admin account created. You can now log in with your username.');
         showPage('login'); // Refresh login page
     } catch (error) {
-        console.error('Registration error:', error);
+        console.error('Setup error:', error);
         alert(error.message);
     }
 }
@@ -216,7 +265,6 @@ async function handleCheckout(event) {
     const paymentMethod = document.getElementById('payment-method').value;
 
     const saleData = {
-        user_id: parseInt(loggedInUserId),
         customer_id: customerId ? parseInt(customerId) : null,
         payment_method: paymentMethod,
         items: cart.map(item => ({ product_id: item.id, quantity: item.quantity })),